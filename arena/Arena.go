@@ -0,0 +1,120 @@
+package arena
+
+import "alex_go/shared"
+
+// Handle Compact reference to a value of an Arena, stable for the lifetime of the value.
+// It fits in a payload slot of a data node, so shifts and resizes only move handles and never the values.
+type Handle int
+
+// Arena Append-only storage of values of type V, allocated in fixed size slabs so that growing never copies the
+// values already stored.
+// Handles go through an indirection table: freed values leave holes that Compact reclaims by moving the live
+// values together, without invalidating their handles.
+type Arena[V any] struct {
+	slabs [][]V
+	// Number of positions used in the slabs, live or not
+	numPositions int
+	// Position of the value of each handle, -1 for free handles
+	positions []int
+	// Handle owning the value at each position, -1 for freed values
+	owners      []Handle
+	freeHandles []Handle
+	numLive     int
+}
+
+func NewArena[V any]() *Arena[V] {
+	return &Arena[V]{}
+}
+
+func (self *Arena[V]) slot(position int) *V {
+	return &self.slabs[position/shared.KArenaSlabSize][position%shared.KArenaSlabSize]
+}
+
+// Put Stores value and returns its handle
+func (self *Arena[V]) Put(value V) Handle {
+	if self.numPositions == len(self.slabs)*shared.KArenaSlabSize {
+		self.slabs = append(self.slabs, make([]V, shared.KArenaSlabSize))
+	}
+	position := self.numPositions
+	self.numPositions++
+	*self.slot(position) = value
+
+	var handle Handle
+	if len(self.freeHandles) > 0 {
+		handle = self.freeHandles[len(self.freeHandles)-1]
+		self.freeHandles = self.freeHandles[:len(self.freeHandles)-1]
+		self.positions[handle] = position
+	} else {
+		handle = Handle(len(self.positions))
+		self.positions = append(self.positions, position)
+	}
+	self.owners = append(self.owners, handle)
+	self.numLive++
+	return handle
+}
+
+// Get Returns the value of handle
+func (self *Arena[V]) Get(handle Handle) V {
+	return *self.slot(self.positions[handle])
+}
+
+// Set Replaces the value of handle in place
+func (self *Arena[V]) Set(handle Handle, value V) {
+	*self.slot(self.positions[handle]) = value
+}
+
+// Free Releases the value of handle, the handle may be returned again by a later Put.
+// Compacts the arena once enough values are freed.
+func (self *Arena[V]) Free(handle Handle) {
+	position := self.positions[handle]
+	if position < 0 {
+		return
+	}
+	var zero V
+	*self.slot(position) = zero
+	self.owners[position] = -1
+	self.positions[handle] = -1
+	self.freeHandles = append(self.freeHandles, handle)
+	self.numLive--
+
+	if float64(self.numPositions-self.numLive) > shared.KArenaCompactionRatio*float64(self.numPositions) &&
+		self.numPositions >= shared.KArenaSlabSize {
+		self.Compact()
+	}
+}
+
+// Compact Moves the live values together, in the order they were stored, and releases the slabs left empty
+func (self *Arena[V]) Compact() {
+	numSlabs := (self.numLive + shared.KArenaSlabSize - 1) / shared.KArenaSlabSize
+	compacted := &Arena[V]{
+		slabs:     make([][]V, 0, numSlabs),
+		positions: self.positions,
+		owners:    make([]Handle, 0, self.numLive),
+	}
+	for position := 0; position < self.numPositions; position++ {
+		handle := self.owners[position]
+		if handle < 0 {
+			continue
+		}
+		if compacted.numPositions == len(compacted.slabs)*shared.KArenaSlabSize {
+			compacted.slabs = append(compacted.slabs, make([]V, shared.KArenaSlabSize))
+		}
+		*compacted.slot(compacted.numPositions) = *self.slot(position)
+		compacted.positions[handle] = compacted.numPositions
+		compacted.owners = append(compacted.owners, handle)
+		compacted.numPositions++
+	}
+	self.slabs = compacted.slabs
+	self.owners = compacted.owners
+	self.numPositions = compacted.numPositions
+}
+
+// Len Number of live values
+func (self *Arena[V]) Len() int {
+	return self.numLive
+}
+
+// Capacity Number of values the allocated slabs can hold
+func (self *Arena[V]) Capacity() int {
+	return len(self.slabs) * shared.KArenaSlabSize
+}
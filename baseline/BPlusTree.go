@@ -0,0 +1,159 @@
+package baseline
+
+import (
+	"alex_go/shared"
+	"sort"
+)
+
+// KBPlusTreeNodeSize Maximum number of keys of a node of the B+-tree baseline
+const KBPlusTreeNodeSize = 64
+
+type bPlusTreeNode struct {
+	keys []shared.KeyType
+	// Internal nodes only: children[i] holds the keys in [keys[i-1], keys[i])
+	children []*bPlusTreeNode
+	// Leaves only
+	payloads []shared.PayloadType
+	next     *bPlusTreeNode
+}
+
+func (self *bPlusTreeNode) isLeaf() bool {
+	return self.children == nil
+}
+
+// Position of the child of an internal node holding key
+func (self *bPlusTreeNode) childPosition(key shared.KeyType) int {
+	return sort.Search(len(self.keys), func(i int) bool {
+		return self.keys[i] > key
+	})
+}
+
+// Position of the first key of a leaf no less than key
+func (self *bPlusTreeNode) lowerBound(key shared.KeyType) int {
+	return sort.Search(len(self.keys), func(i int) bool {
+		return self.keys[i] >= key
+	})
+}
+
+// BPlusTree In-memory B+-tree holding each key once, the classic ordered index learned indexes are compared with.
+// Nodes hold up to KBPlusTreeNodeSize keys and leaves are chained for scans.
+type BPlusTree struct {
+	root    *bPlusTreeNode
+	numKeys int
+	height  int
+}
+
+func NewBPlusTree() *BPlusTree {
+	return &BPlusTree{root: &bPlusTreeNode{}, height: 1}
+}
+
+// Returns the leaf that holds key if it is in the tree
+func (self *BPlusTree) leaf(key shared.KeyType) *bPlusTreeNode {
+	current := self.root
+	for !current.isLeaf() {
+		current = current.children[current.childPosition(key)]
+	}
+	return current
+}
+
+// Find Returns the payload of key and whether it is in the tree
+func (self *BPlusTree) Find(key shared.KeyType) (shared.PayloadType, bool) {
+	leaf := self.leaf(key)
+	position := leaf.lowerBound(key)
+	if position < len(leaf.keys) && leaf.keys[position] == key {
+		return leaf.payloads[position], true
+	}
+	var missing shared.PayloadType
+	return missing, false
+}
+
+// Put Sets the payload of key, inserting key if it is not in the tree
+func (self *BPlusTree) Put(key shared.KeyType, payload shared.PayloadType) {
+	separator, right := self.insert(self.root, key, payload)
+	if right != nil {
+		self.root = &bPlusTreeNode{
+			keys:     []shared.KeyType{separator},
+			children: []*bPlusTreeNode{self.root, right},
+		}
+		self.height++
+	}
+}
+
+// Inserts key under current. If current overflows, it is split and the new right sibling is returned with the
+// smallest key it holds.
+func (self *BPlusTree) insert(current *bPlusTreeNode, key shared.KeyType, payload shared.PayloadType) (shared.KeyType, *bPlusTreeNode) {
+	if current.isLeaf() {
+		position := current.lowerBound(key)
+		if position < len(current.keys) && current.keys[position] == key {
+			current.payloads[position] = payload
+			return 0, nil
+		}
+		current.keys = insertAt(current.keys, position, key)
+		current.payloads = insertAt(current.payloads, position, payload)
+		self.numKeys++
+		if len(current.keys) <= KBPlusTreeNodeSize {
+			return 0, nil
+		}
+		middle := len(current.keys) / 2
+		right := &bPlusTreeNode{
+			keys:     append([]shared.KeyType(nil), current.keys[middle:]...),
+			payloads: append([]shared.PayloadType(nil), current.payloads[middle:]...),
+			next:     current.next,
+		}
+		current.keys, current.payloads = current.keys[:middle], current.payloads[:middle]
+		current.next = right
+		return right.keys[0], right
+	}
+
+	position := current.childPosition(key)
+	separator, child := self.insert(current.children[position], key, payload)
+	if child == nil {
+		return 0, nil
+	}
+	current.keys = insertAt(current.keys, position, separator)
+	current.children = insertAt(current.children, position+1, child)
+	if len(current.keys) <= KBPlusTreeNodeSize {
+		return 0, nil
+	}
+	// The middle key moves up, it separates the two halves
+	middle := len(current.keys) / 2
+	separator = current.keys[middle]
+	right := &bPlusTreeNode{
+		keys:     append([]shared.KeyType(nil), current.keys[middle+1:]...),
+		children: append([]*bPlusTreeNode(nil), current.children[middle+1:]...),
+	}
+	current.keys, current.children = current.keys[:middle], current.children[:middle+1]
+	return separator, right
+}
+
+// Scan Calls yield for every key greater than or equal to from in ascending order, with its payload. Stops as soon
+// as yield returns false.
+func (self *BPlusTree) Scan(from shared.KeyType, yield func(shared.KeyType, shared.PayloadType) bool) {
+	leaf := self.leaf(from)
+	for position := leaf.lowerBound(from); leaf != nil; leaf, position = leaf.next, 0 {
+		for ; position < len(leaf.keys); position++ {
+			if !yield(leaf.keys[position], leaf.payloads[position]) {
+				return
+			}
+		}
+	}
+}
+
+// Len Number of keys in the tree
+func (self *BPlusTree) Len() int {
+	return self.numKeys
+}
+
+// Height Number of levels of the tree, leaves included
+func (self *BPlusTree) Height() int {
+	return self.height
+}
+
+// Inserts value at position, shifting the following elements
+func insertAt[T any](values []T, position int, value T) []T {
+	var zero T
+	values = append(values, zero)
+	copy(values[position+1:], values[position:])
+	values[position] = value
+	return values
+}
@@ -0,0 +1,59 @@
+package baseline
+
+import (
+	"alex_go/shared"
+	"sort"
+)
+
+// SortedSlice Keys kept sorted in a slice and searched with binary search, each key held once.
+// Lookups and scans are as fast as it gets without a model, inserts shift half of the keys on average.
+type SortedSlice struct {
+	keys     []shared.KeyType
+	payloads []shared.PayloadType
+}
+
+func NewSortedSlice() *SortedSlice {
+	return &SortedSlice{}
+}
+
+func (self *SortedSlice) lowerBound(key shared.KeyType) int {
+	return sort.Search(len(self.keys), func(i int) bool {
+		return self.keys[i] >= key
+	})
+}
+
+// Find Returns the payload of key and whether it is in the slice
+func (self *SortedSlice) Find(key shared.KeyType) (shared.PayloadType, bool) {
+	position := self.lowerBound(key)
+	if position < len(self.keys) && self.keys[position] == key {
+		return self.payloads[position], true
+	}
+	var missing shared.PayloadType
+	return missing, false
+}
+
+// Put Sets the payload of key, inserting key if it is not in the slice
+func (self *SortedSlice) Put(key shared.KeyType, payload shared.PayloadType) {
+	position := self.lowerBound(key)
+	if position < len(self.keys) && self.keys[position] == key {
+		self.payloads[position] = payload
+		return
+	}
+	self.keys = insertAt(self.keys, position, key)
+	self.payloads = insertAt(self.payloads, position, payload)
+}
+
+// Scan Calls yield for every key greater than or equal to from in ascending order, with its payload. Stops as soon
+// as yield returns false.
+func (self *SortedSlice) Scan(from shared.KeyType, yield func(shared.KeyType, shared.PayloadType) bool) {
+	for position := self.lowerBound(from); position < len(self.keys); position++ {
+		if !yield(self.keys[position], self.payloads[position]) {
+			return
+		}
+	}
+}
+
+// Len Number of keys in the slice
+func (self *SortedSlice) Len() int {
+	return len(self.keys)
+}
@@ -1,8 +1,34 @@
 package bitmap
 
 type Bitmap interface {
+	// Count Number of set bits
 	Count() int
 	Contains(value uint32) bool
-	Set(value uint32)
-	Remove(value uint32)
+
+	// Set Sets the bit at value, returns true if the bit was previously unset
+	Set(value uint32) bool
+	// Remove Clears the bit at value, returns true if the bit was previously set
+	Remove(value uint32) bool
+
+	// SetRange Sets every bit in the range [start, end)
+	SetRange(start uint32, end uint32)
+	// RemoveRange Clears every bit in the range [start, end)
+	RemoveRange(start uint32, end uint32)
+
+	// Rank Number of set bits strictly before value
+	Rank(value uint32) int
+	// CountRange Number of set bits in the range [start, end), only scans the blocks of the range
+	CountRange(start uint32, end uint32) int
+	// Select Position of the k-th set bit (0-based), false if fewer than k+1 bits are set
+	Select(k int) (uint32, bool)
+
+	// Range Calls yield for every set bit in [start, end) in ascending order, stops as soon as
+	// yield returns false
+	Range(start uint32, end uint32, yield func(uint32) bool)
+	// RangeReverse Calls yield for every set bit in [start, end) in descending order, stops as soon as
+	// yield returns false
+	RangeReverse(start uint32, end uint32, yield func(uint32) bool)
+
+	// SizeInBytes Memory held by the bitmap, in bytes
+	SizeInBytes() int64
 }
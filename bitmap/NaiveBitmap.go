@@ -1,5 +1,7 @@
 package bitmap
 
+import "unsafe"
+
 type NaiveBitmap struct {
 	bits  []bool
 	count int
@@ -10,17 +12,95 @@ func (n *NaiveBitmap) Count() int {
 }
 
 func (n *NaiveBitmap) Contains(value uint32) bool {
-	return n.bits[value]
+	return int(value) < len(n.bits) && n.bits[value]
 }
 
-func (n *NaiveBitmap) Set(value uint32) {
+func (n *NaiveBitmap) Set(value uint32) bool {
+	for int(value) >= len(n.bits) {
+		n.bits = append(n.bits, false)
+	}
+	if n.bits[value] {
+		return false
+	}
 	n.bits[value] = true
 	n.count++
+	return true
 }
 
-func (n *NaiveBitmap) Remove(value uint32) {
+func (n *NaiveBitmap) Remove(value uint32) bool {
+	if !n.Contains(value) {
+		return false
+	}
 	n.bits[value] = false
 	n.count--
+	return true
+}
+
+func (n *NaiveBitmap) SetRange(start uint32, end uint32) {
+	for i := start; i < end; i++ {
+		n.Set(i)
+	}
+}
+
+func (n *NaiveBitmap) RemoveRange(start uint32, end uint32) {
+	for i := start; i < end; i++ {
+		n.Remove(i)
+	}
+}
+
+func (n *NaiveBitmap) Rank(value uint32) int {
+	rank := 0
+	for i := 0; i < min(int(value), len(n.bits)); i++ {
+		if n.bits[i] {
+			rank++
+		}
+	}
+	return rank
+}
+
+func (n *NaiveBitmap) CountRange(start uint32, end uint32) int {
+	count := 0
+	for i := int(start); i < min(int(end), len(n.bits)); i++ {
+		if n.bits[i] {
+			count++
+		}
+	}
+	return count
+}
+
+func (n *NaiveBitmap) Select(k int) (uint32, bool) {
+	if k < 0 {
+		return 0, false
+	}
+	for i := 0; i < len(n.bits); i++ {
+		if n.bits[i] {
+			if k == 0 {
+				return uint32(i), true
+			}
+			k--
+		}
+	}
+	return 0, false
+}
+
+func (n *NaiveBitmap) Range(start uint32, end uint32, yield func(uint32) bool) {
+	for i := int(start); i < min(int(end), len(n.bits)); i++ {
+		if n.bits[i] && !yield(uint32(i)) {
+			return
+		}
+	}
+}
+
+func (n *NaiveBitmap) RangeReverse(start uint32, end uint32, yield func(uint32) bool) {
+	for i := min(int(end), len(n.bits)) - 1; i >= int(start); i-- {
+		if n.bits[i] && !yield(uint32(i)) {
+			return
+		}
+	}
+}
+
+func (n *NaiveBitmap) SizeInBytes() int64 {
+	return int64(unsafe.Sizeof(*n)) + int64(cap(n.bits))
 }
 
 func NewNaiveBitmap(dataCapacity int) *NaiveBitmap {
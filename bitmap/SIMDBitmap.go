@@ -0,0 +1,160 @@
+package bitmap
+
+import (
+	"github.com/kelindar/bitmap"
+	"math/bits"
+	"unsafe"
+)
+
+// SIMDBitmap Wraps the SIMD accelerated bitmap and keeps track of the number of set bits so that
+// Count does not have to scan every block
+type SIMDBitmap struct {
+	bits  bitmap.Bitmap
+	count int
+}
+
+func (s *SIMDBitmap) Count() int {
+	return s.count
+}
+
+func (s *SIMDBitmap) Contains(value uint32) bool {
+	return s.bits.Contains(value)
+}
+
+func (s *SIMDBitmap) Set(value uint32) bool {
+	if s.bits.Contains(value) {
+		return false
+	}
+	s.bits.Set(value)
+	s.count++
+	return true
+}
+
+func (s *SIMDBitmap) Remove(value uint32) bool {
+	if !s.bits.Contains(value) {
+		return false
+	}
+	s.bits.Remove(value)
+	s.count--
+	return true
+}
+
+// rangeMask Mask of the bits of block blkAt that fall in [start, end)
+func rangeMask(blkAt int, start uint32, end uint32) uint64 {
+	mask := ^uint64(0)
+	blkStart := uint32(blkAt << 6)
+	if start > blkStart {
+		mask &= ^uint64(0) << (start - blkStart)
+	}
+	if end < blkStart+64 {
+		mask &= ^uint64(0) >> (blkStart + 64 - end)
+	}
+	return mask
+}
+
+func (s *SIMDBitmap) SetRange(start uint32, end uint32) {
+	if start >= end {
+		return
+	}
+	s.bits.Grow(end - 1)
+	for blkAt := int(start >> 6); blkAt <= int((end-1)>>6); blkAt++ {
+		mask := rangeMask(blkAt, start, end)
+		s.count += bits.OnesCount64(mask &^ s.bits[blkAt])
+		s.bits[blkAt] |= mask
+	}
+}
+
+func (s *SIMDBitmap) RemoveRange(start uint32, end uint32) {
+	end = min(end, uint32(len(s.bits)<<6))
+	if start >= end {
+		return
+	}
+	for blkAt := int(start >> 6); blkAt <= int((end-1)>>6); blkAt++ {
+		mask := rangeMask(blkAt, start, end)
+		s.count -= bits.OnesCount64(mask & s.bits[blkAt])
+		s.bits[blkAt] &^= mask
+	}
+}
+
+func (s *SIMDBitmap) Rank(value uint32) int {
+	return s.bits.CountTo(value)
+}
+
+func (s *SIMDBitmap) CountRange(start uint32, end uint32) int {
+	end = min(end, uint32(len(s.bits)<<6))
+	if start >= end {
+		return 0
+	}
+	count := 0
+	for blkAt := int(start >> 6); blkAt <= int((end-1)>>6); blkAt++ {
+		count += bits.OnesCount64(s.bits[blkAt] & rangeMask(blkAt, start, end))
+	}
+	return count
+}
+
+func (s *SIMDBitmap) Select(k int) (uint32, bool) {
+	if k < 0 || k >= s.count {
+		return 0, false
+	}
+	for blkAt, blk := range s.bits {
+		blkCount := bits.OnesCount64(blk)
+		if k >= blkCount {
+			k -= blkCount
+			continue
+		}
+		// Drop the k lowest set bits of the block, the answer is then its lowest set bit
+		for ; k > 0; k-- {
+			blk &= blk - 1
+		}
+		return uint32(blkAt<<6 + bits.TrailingZeros64(blk)), true
+	}
+	return 0, false
+}
+
+func (s *SIMDBitmap) Range(start uint32, end uint32, yield func(uint32) bool) {
+	end = min(end, uint32(len(s.bits)<<6))
+	if start >= end {
+		return
+	}
+	for blkAt := int(start >> 6); blkAt <= int((end-1)>>6); blkAt++ {
+		blk := s.bits[blkAt] & rangeMask(blkAt, start, end)
+		for blk != 0 {
+			if !yield(uint32(blkAt<<6 + bits.TrailingZeros64(blk))) {
+				return
+			}
+			blk &= blk - 1
+		}
+	}
+}
+
+func (s *SIMDBitmap) RangeReverse(start uint32, end uint32, yield func(uint32) bool) {
+	end = min(end, uint32(len(s.bits)<<6))
+	if start >= end {
+		return
+	}
+	for blkAt := int((end - 1) >> 6); blkAt >= int(start>>6); blkAt-- {
+		blk := s.bits[blkAt] & rangeMask(blkAt, start, end)
+		for blk != 0 {
+			offset := 63 - bits.LeadingZeros64(blk)
+			if !yield(uint32(blkAt<<6 + offset)) {
+				return
+			}
+			blk &^= 1 << offset
+		}
+	}
+}
+
+func (s *SIMDBitmap) SizeInBytes() int64 {
+	return int64(unsafe.Sizeof(*s)) + int64(cap(s.bits))*8
+}
+
+func NewSIMDBitmap(dataCapacity int) *SIMDBitmap {
+	simdBitmap := &SIMDBitmap{
+		bits:  bitmap.Bitmap{},
+		count: 0,
+	}
+	if dataCapacity > 0 {
+		simdBitmap.bits.Grow(uint32(dataCapacity - 1))
+	}
+	return simdBitmap
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"alex_go/shared"
+	"alex_go/workload"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Loads up to numKeys keys from path.
+// Binary files hold the keys back to back as little-endian 64-bit integers, as written by the reference
+// benchmark. SOSD files hold the number of keys followed by the keys. Text files hold one key per line, optionally
+// followed by a payload which is ignored, as read by tests.ReadValuesFromFile.
+func loadKeys(path string, fileType string, numKeys int) ([]shared.KeyType, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []shared.KeyType
+	switch fileType {
+	case "binary":
+		keys, err = readBinaryKeys(bufio.NewReader(file), numKeys)
+	case "sosd":
+		keys, err = workload.ReadSOSDPrefix(bufio.NewReader(file), numKeys)
+	case "text":
+		keys, err = readTextKeys(bufio.NewReader(file), numKeys)
+	default:
+		return nil, fmt.Errorf("unknown keys file type %q, expected binary, sosd or text", fileType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(keys) < numKeys {
+		return nil, fmt.Errorf("%s holds %d keys, %d requested", path, len(keys), numKeys)
+	}
+	return keys, nil
+}
+
+func readBinaryKeys(reader io.Reader, numKeys int) ([]shared.KeyType, error) {
+	keys := make([]shared.KeyType, 0, numKeys)
+	var buffer [8]byte
+	for len(keys) < numKeys {
+		if _, err := io.ReadFull(reader, buffer[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		keys = append(keys, shared.KeyType(int64(binary.LittleEndian.Uint64(buffer[:]))))
+	}
+	return keys, nil
+}
+
+func readTextKeys(reader io.Reader, numKeys int) ([]shared.KeyType, error) {
+	keys := make([]shared.KeyType, 0, numKeys)
+	scanner := bufio.NewScanner(reader)
+	for len(keys) < numKeys && scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var key shared.KeyType
+		if _, err := fmt.Sscan(strings.Fields(line)[0], &key); err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
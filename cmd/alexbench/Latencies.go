@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Latencies of the operations of one kind
+type latencies struct {
+	samples []time.Duration
+	total   time.Duration
+}
+
+func (self *latencies) record(latency time.Duration) {
+	self.samples = append(self.samples, latency)
+	self.total += latency
+}
+
+func (self *latencies) count() int {
+	return len(self.samples)
+}
+
+// Operations per second over the time spent in them
+func (self *latencies) throughput() float64 {
+	if self.total == 0 {
+		return 0
+	}
+	return float64(len(self.samples)) / self.total.Seconds()
+}
+
+// Latency below which a fraction q of the operations completed, the samples must be sorted
+func (self *latencies) percentile(q float64) time.Duration {
+	if len(self.samples) == 0 {
+		return 0
+	}
+	return self.samples[min(int(q*float64(len(self.samples))), len(self.samples)-1)]
+}
+
+func (self *latencies) report(name string) {
+	if len(self.samples) == 0 {
+		return
+	}
+	slices.Sort(self.samples)
+	fmt.Printf("\t%-8s %10d ops %14.0f ops/sec   p50 %8v   p90 %8v   p99 %8v   p99.9 %8v   max %8v\n",
+		name, len(self.samples), self.throughput(), self.percentile(0.5), self.percentile(0.9),
+		self.percentile(0.99), self.percentile(0.999), self.samples[len(self.samples)-1])
+}
@@ -0,0 +1,332 @@
+// Command alexbench mirrors the benchmark of the reference ALEX implementation.
+// It loads keys from a file, inserts an initial fraction of them as one sorted batch, then runs batches of
+// lookups, range scans, deletes and inserts of the remaining keys until they run out or the time limit is reached.
+// It reports the throughput and latency percentiles of every kind of operation and the statistics of the index.
+//
+// Usage:
+//
+//	alexbench --keys_file=keys.bin --keys_file_type=binary --init_num_keys=1000000 --total_num_keys=2000000 \
+//		--batch_size=100000 --insert_frac=0.5 --lookup_distribution=zipf --print_batch_stats
+package main
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"time"
+)
+
+type config struct {
+	keysFile           string
+	keysFileType       string
+	initNumKeys        int
+	totalNumKeys       int
+	batchSize          int
+	insertFrac         float64
+	scanFrac           float64
+	deleteFrac         float64
+	scanLength         int
+	lookupDistribution string
+	searchStrategy     node.SearchStrategy
+	layout             node.DataNodeLayout
+	slotLayout         node.SlotLayout
+	exportTree         string
+	timeLimit          time.Duration
+	printBatchStats    bool
+	shuffleKeys        bool
+	seed               int64
+}
+
+func parseFlags() (config, error) {
+	var cfg config
+	flag.StringVar(&cfg.keysFile, "keys_file", "", "file holding the keys")
+	flag.StringVar(&cfg.keysFileType, "keys_file_type", "binary", "binary (little-endian 64-bit keys), sosd (SOSD benchmark format) or text (one key per line)")
+	flag.IntVar(&cfg.initNumKeys, "init_num_keys", 1_000_000, "number of keys inserted before the batches")
+	flag.IntVar(&cfg.totalNumKeys, "total_num_keys", 2_000_000, "number of keys read from the file")
+	flag.IntVar(&cfg.batchSize, "batch_size", 100_000, "number of operations per batch")
+	flag.Float64Var(&cfg.insertFrac, "insert_frac", 0.5, "fraction of the operations that insert a new key")
+	flag.Float64Var(&cfg.scanFrac, "scan_frac", 0, "fraction of the operations that scan a range of keys")
+	flag.Float64Var(&cfg.deleteFrac, "delete_frac", 0, "fraction of the operations that delete a key")
+	flag.IntVar(&cfg.scanLength, "scan_length", 100, "number of keys visited by a range scan")
+	flag.StringVar(&cfg.lookupDistribution, "lookup_distribution", "uniform", "uniform or zipf, how looked up keys are drawn from the inserted keys")
+	searchStrategy := flag.String("search_strategy", "adaptive", "adaptive, exponential, linear or binary, how data nodes search around predicted positions")
+	flag.StringVar(&cfg.exportTree, "export_tree", "", "file the tree of the index is written to at the end, with the model error bounds of the data nodes")
+	layout := flag.String("layout", "gapped", "gapped or pma, how data nodes make room for keys inserted into filled slots")
+	slotLayout := flag.String("slot_layout", "separate", "separate or interleaved, how data nodes store their keys and payloads")
+	timeLimit := flag.Float64("time_limit", 0.5, "time limit in minutes, 0 for none")
+	flag.BoolVar(&cfg.printBatchStats, "print_batch_stats", false, "report every batch")
+	flag.BoolVar(&cfg.shuffleKeys, "shuffle_keys", false, "shuffle the keys after loading them, SOSD files hold them sorted")
+	flag.Int64Var(&cfg.seed, "seed", 42, "seed of the random choices")
+	flag.Parse()
+	cfg.timeLimit = time.Duration(*timeLimit * float64(time.Minute))
+	cfg.searchStrategy = -1
+	for _, strategy := range []node.SearchStrategy{node.AdaptiveSearch, node.ExponentialSearch, node.LinearSearch, node.BinarySearch} {
+		if strategy.String() == *searchStrategy {
+			cfg.searchStrategy = strategy
+		}
+	}
+	cfg.layout = -1
+	for _, dataNodeLayout := range []node.DataNodeLayout{node.GappedArrayLayout, node.PackedMemoryArrayLayout} {
+		if dataNodeLayout.String() == *layout {
+			cfg.layout = dataNodeLayout
+		}
+	}
+	cfg.slotLayout = -1
+	for _, layout := range []node.SlotLayout{node.SeparateSlots, node.InterleavedSlots} {
+		if layout.String() == *slotLayout {
+			cfg.slotLayout = layout
+		}
+	}
+
+	switch {
+	case cfg.keysFile == "":
+		return cfg, fmt.Errorf("--keys_file is required")
+	case cfg.initNumKeys < 1 || cfg.totalNumKeys < cfg.initNumKeys:
+		return cfg, fmt.Errorf("expected 1 <= --init_num_keys <= --total_num_keys")
+	case cfg.batchSize < 1:
+		return cfg, fmt.Errorf("--batch_size must be positive")
+	case cfg.insertFrac < 0 || cfg.scanFrac < 0 || cfg.deleteFrac < 0 || cfg.insertFrac+cfg.scanFrac+cfg.deleteFrac > 1:
+		return cfg, fmt.Errorf("the insert, scan and delete fractions must be non-negative and add up to at most 1")
+	case cfg.lookupDistribution != "uniform" && cfg.lookupDistribution != "zipf":
+		return cfg, fmt.Errorf("unknown lookup distribution %q, expected uniform or zipf", cfg.lookupDistribution)
+	case cfg.searchStrategy < 0:
+		return cfg, fmt.Errorf("unknown search strategy %q, expected adaptive, exponential, linear or binary", *searchStrategy)
+	case cfg.layout < 0:
+		return cfg, fmt.Errorf("unknown layout %q, expected gapped or pma", *layout)
+	case cfg.slotLayout < 0:
+		return cfg, fmt.Errorf("unknown slot layout %q, expected separate or interleaved", *slotLayout)
+	case cfg.timeLimit <= 0 && cfg.insertFrac == 0:
+		return cfg, fmt.Errorf("without inserts the batches only stop at the time limit, set --time_limit")
+	}
+	return cfg, nil
+}
+
+// Latencies of every kind of operation
+type operations struct {
+	lookups latencies
+	scans   latencies
+	deletes latencies
+	inserts latencies
+}
+
+func (self *operations) count() int {
+	return self.lookups.count() + self.scans.count() + self.deletes.count() + self.inserts.count()
+}
+
+func (self *operations) total() time.Duration {
+	return self.lookups.total + self.scans.total + self.deletes.total + self.inserts.total
+}
+
+func (self *operations) report() {
+	fmt.Printf("\t%-8s %10d ops %14.0f ops/sec\n", "all", self.count(), float64(self.count())/self.total().Seconds())
+	self.lookups.report("lookups")
+	self.scans.report("scans")
+	self.deletes.report("deletes")
+	self.inserts.report("inserts")
+}
+
+// Appends the latencies of batch to cumulative
+func (self *operations) add(batch *operations) {
+	for _, pair := range [][2]*latencies{
+		{&self.lookups, &batch.lookups},
+		{&self.scans, &batch.scans},
+		{&self.deletes, &batch.deletes},
+		{&self.inserts, &batch.inserts},
+	} {
+		pair[0].samples = append(pair[0].samples, pair[1].samples...)
+		pair[0].total += pair[1].total
+	}
+}
+
+// State of a benchmark run
+type benchmark struct {
+	cfg  config
+	alex *index.Index
+	rng  *rand.Rand
+	keys []shared.KeyType
+	// Keys inserted and not deleted, in insertion order
+	live []shared.KeyType
+	// Position in keys of the next key to insert
+	nextInsert int
+	// Lookups of keys deleted as duplicates of another key
+	numMisses int
+	// Sum of the payloads found, printed so that the lookups have an observable result
+	checksum int
+}
+
+// Draws the key of a lookup or scan among the live keys
+func (self *benchmark) sampler() func() shared.KeyType {
+	if self.cfg.lookupDistribution == "zipf" && len(self.live) > 1 {
+		zipf := rand.NewZipf(self.rng, 1.1, 1, uint64(len(self.live)-1))
+		return func() shared.KeyType {
+			return self.live[zipf.Uint64()]
+		}
+	}
+	return func() shared.KeyType {
+		return self.live[self.rng.Intn(len(self.live))]
+	}
+}
+
+func (self *benchmark) runBatch(batch *operations) error {
+	numInserts := min(int(float64(self.cfg.batchSize)*self.cfg.insertFrac), len(self.keys)-self.nextInsert)
+	numScans := int(float64(self.cfg.batchSize) * self.cfg.scanFrac)
+	numDeletes := min(int(float64(self.cfg.batchSize)*self.cfg.deleteFrac), len(self.live)-1)
+	numLookups := self.cfg.batchSize - int(float64(self.cfg.batchSize)*(self.cfg.insertFrac+self.cfg.scanFrac+self.cfg.deleteFrac))
+
+	sample := self.sampler()
+	for i := 0; i < numLookups; i++ {
+		key := sample()
+		start := time.Now()
+		payload, err := self.alex.Find(key)
+		batch.lookups.record(time.Since(start))
+		if err != nil {
+			self.numMisses++
+		} else {
+			self.checksum += payload
+		}
+	}
+
+	for i := 0; i < numScans; i++ {
+		from := sample()
+		visited := 0
+		start := time.Now()
+		self.alex.Scan(from, func(key shared.KeyType, payload shared.PayloadType) bool {
+			self.checksum += payload
+			visited++
+			return visited < self.cfg.scanLength
+		})
+		batch.scans.record(time.Since(start))
+	}
+
+	for i := 0; i < numDeletes; i++ {
+		position := self.rng.Intn(len(self.live))
+		key := self.live[position]
+		self.live[position] = self.live[len(self.live)-1]
+		self.live = self.live[:len(self.live)-1]
+		start := time.Now()
+		self.alex.Delete(key)
+		batch.deletes.record(time.Since(start))
+	}
+
+	for i := 0; i < numInserts; i++ {
+		key := self.keys[self.nextInsert]
+		payload := self.rng.Int()
+		start := time.Now()
+		err := self.alex.Insert(key, payload)
+		batch.inserts.record(time.Since(start))
+		if err != nil {
+			return fmt.Errorf("inserting key %d: %w", key, err)
+		}
+		self.live = append(self.live, key)
+		self.nextInsert++
+	}
+	return nil
+}
+
+func run(cfg config) error {
+	keys, err := loadKeys(cfg.keysFile, cfg.keysFileType, cfg.totalNumKeys)
+	if err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(cfg.seed))
+	if cfg.shuffleKeys {
+		rng.Shuffle(len(keys), func(i int, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+	}
+	bench := &benchmark{
+		cfg:        cfg,
+		alex:       index.NewIndex(),
+		rng:        rng,
+		keys:       keys,
+		live:       slices.Clone(keys[:cfg.initNumKeys]),
+		nextInsert: cfg.initNumKeys,
+	}
+	bench.alex.SetSearchStrategy(cfg.searchStrategy)
+	bench.alex.SetDataNodeLayout(cfg.layout)
+	bench.alex.SetSlotLayout(cfg.slotLayout)
+
+	// There is no bulk loading yet, the initial keys are inserted as one sorted batch
+	initKeys := slices.Clone(keys[:cfg.initNumKeys])
+	slices.Sort(initKeys)
+	initPayloads := make([]shared.PayloadType, len(initKeys))
+	for i := range initPayloads {
+		initPayloads[i] = bench.rng.Int()
+	}
+	start := time.Now()
+	if err := bench.alex.InsertBatch(initKeys, initPayloads); err != nil {
+		return fmt.Errorf("loading the initial keys: %w", err)
+	}
+	fmt.Printf("Loaded %d initial keys in %v\n", len(initKeys), time.Since(start))
+
+	var cumulative operations
+	started := time.Now()
+	for batchNo := 1; ; batchNo++ {
+		if cfg.insertFrac > 0 && bench.nextInsert >= len(keys) {
+			break
+		}
+		if cfg.timeLimit > 0 && time.Since(started) >= cfg.timeLimit {
+			break
+		}
+		var batch operations
+		err := bench.runBatch(&batch)
+		cumulative.add(&batch)
+		if cfg.printBatchStats {
+			fmt.Printf("Batch %d, cumulative ops: %d\n", batchNo, cumulative.count())
+			batch.report()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Cumulative stats: %d ops in %v\n", cumulative.count(), time.Since(started))
+	cumulative.report()
+	fmt.Printf("\tmissed lookups: %d, checksum: %d\n", bench.numMisses, bench.checksum)
+
+	stats := bench.alex.GetStats()
+	fmt.Println("Index stats:")
+	fmt.Printf("\tkeys: %d, model nodes: %d, data nodes: %d, memory: %d bytes\n",
+		stats.NumKeys, stats.NumModelNodes, stats.NumDataNodes, bench.alex.MemoryFootprint())
+	fmt.Printf("\texpand and scales: %d, expand and retrains: %d\n", stats.NumExpandAndScales, stats.NumExpandAndRetrains)
+	fmt.Printf("\tdownward splits: %d (%d keys), sideways splits: %d (%d keys)\n",
+		stats.NumDownwardSplits, stats.NumDownwardSplitKeys, stats.NumSidewaysSplits, stats.NumSidewaysSplitKeys)
+	fmt.Printf("\tmodel node expansions: %d (%d pointers), model node splits: %d (%d pointers)\n",
+		stats.NumModelNodeExpansions, stats.NumModelNodeExpansionPointers, stats.NumModelNodeSplits, stats.NumModelNodeSplitPointers)
+	fmt.Printf("\tlookups: %d, inserts: %d, node lookups: %d\n", stats.NumLookups, stats.NumInserts, stats.NumNodeLookups)
+	strategies := bench.alex.SearchStrategies()
+	fmt.Printf("\tdata nodes searching linearly: %d, exponentially: %d, with a binary search: %d\n",
+		strategies[node.LinearSearch], strategies[node.ExponentialSearch], strategies[node.BinarySearch])
+	modelErrors := bench.alex.ModelErrors()
+	fmt.Printf("\tmodel errors: [%d, %d], average error window: %.1f, degraded data nodes: %d\n",
+		modelErrors.MinError, modelErrors.MaxError, modelErrors.AvgErrorWindow, modelErrors.NumDegradedDataNodes)
+	if cfg.exportTree != "" {
+		file, err := os.Create(cfg.exportTree)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := bench.alex.ExportTree(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	cfg, err := parseFlags()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
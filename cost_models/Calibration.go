@@ -0,0 +1,136 @@
+package cost_models
+
+import (
+	"alex_go/shared"
+	"math"
+	"math/rand"
+	"time"
+	"unsafe"
+)
+
+// CalibrationConfig Parameters of the micro-benchmarks run by Calibrate
+type CalibrationConfig struct {
+	// WorkingSetBytes Size of the arrays the micro-benchmarks operate on.
+	// It should exceed the last level cache so that search iterations and node hops pay for cache misses
+	WorkingSetBytes int
+	// NumSamples Number of timed operations per micro-benchmark
+	NumSamples int
+	// Seed Seed of the random positions used by the micro-benchmarks
+	Seed int64
+}
+
+func DefaultCalibrationConfig() CalibrationConfig {
+	return CalibrationConfig{
+		WorkingSetBytes: 64 << 20,
+		NumSamples:      1 << 18,
+		Seed:            42,
+	}
+}
+
+// calibrationNode Mimics a model node: a linear model and a pointer to the next node
+type calibrationNode struct {
+	a    float64
+	b    float64
+	next int
+}
+
+// Prevents the compiler from optimising the measured loops away
+var calibrationSink int
+
+// measureSearchIteration Nanoseconds spent per binary search probe in a sorted array larger than the cache
+func measureSearchIteration(config CalibrationConfig, rng *rand.Rand) float64 {
+	numSlots := max(config.WorkingSetBytes/shared.KeySize, 2)
+	keys := make([]shared.KeyType, numSlots)
+	for i := range keys {
+		keys[i] = shared.KeyType(2 * i)
+	}
+	queries := make([]shared.KeyType, config.NumSamples)
+	for i := range queries {
+		queries[i] = shared.KeyType(rng.Intn(2 * numSlots))
+	}
+
+	iterations := 0
+	start := time.Now()
+	for _, query := range queries {
+		l, r := 0, numSlots
+		for l < r {
+			m := l + (r-l)/2
+			if keys[m] <= query {
+				l = m + 1
+			} else {
+				r = m
+			}
+			iterations++
+		}
+		calibrationSink += l
+	}
+	return float64(time.Since(start).Nanoseconds()) / float64(max(iterations, 1))
+}
+
+// measureShift Nanoseconds spent per slot when shifting keys and payloads by one position towards a gap
+func measureShift(config CalibrationConfig, rng *rand.Rand) float64 {
+	numSlots := max(config.WorkingSetBytes/shared.BlockSize, 2)
+	keys := make([]shared.KeyType, numSlots)
+	payloads := make([]shared.PayloadType, numSlots)
+	maxShift := min(numSlots-1, 256)
+
+	shifted := 0
+	start := time.Now()
+	for sample := 0; sample < config.NumSamples; sample++ {
+		distance := 1 + rng.Intn(maxShift)
+		pos := rng.Intn(numSlots - distance)
+		gapPos := pos + distance
+		for i := gapPos; i > pos; i-- {
+			keys[i] = keys[i-1]
+			payloads[i] = payloads[i-1]
+		}
+		shifted += distance
+	}
+	calibrationSink += keys[rng.Intn(numSlots)] + payloads[rng.Intn(numSlots)]
+	return float64(time.Since(start).Nanoseconds()) / float64(max(shifted, 1))
+}
+
+// measureNodeHop Nanoseconds spent per model prediction followed by a dependent random pointer chase
+func measureNodeHop(config CalibrationConfig, rng *rand.Rand) float64 {
+	numNodes := max(config.WorkingSetBytes/int(unsafe.Sizeof(calibrationNode{})), 2)
+	nodes := make([]calibrationNode, numNodes)
+	// A single random cycle through every node, so that the hardware prefetcher cannot guess the next hop
+	order := rng.Perm(numNodes)
+	for i := 0; i < numNodes; i++ {
+		nodes[order[i]] = calibrationNode{
+			a:    rng.Float64(),
+			b:    rng.Float64(),
+			next: order[(i+1)%numNodes],
+		}
+	}
+
+	current := order[0]
+	prediction := 0.0
+	start := time.Now()
+	for sample := 0; sample < config.NumSamples; sample++ {
+		currentNode := &nodes[current]
+		prediction += currentNode.a*float64(sample) + currentNode.b
+		current = currentNode.next
+	}
+	calibrationSink += current + int(prediction)
+	return float64(time.Since(start).Nanoseconds()) / float64(max(config.NumSamples, 1))
+}
+
+// Calibrate Micro-benchmarks search iterations, shifts and node hops on the current machine and returns a
+// cost model weighing them in the measured proportions.
+// The default weights are unitless relative weights, so the measured costs are scaled to make the traversal weight
+// the default KNodeLookupsWeight, the other weights keep their measured proportions to it.
+func Calibrate(config CalibrationConfig) *LinearCostModel {
+	rng := rand.New(rand.NewSource(config.Seed))
+	searchIteration := measureSearchIteration(config, rng)
+	shift := measureShift(config, rng)
+	nodeHop := measureNodeHop(config, rng)
+
+	scale := shared.KNodeLookupsWeight / max(nodeHop, math.SmallestNonzeroFloat64)
+	return NewLinearCostModel(
+		searchIteration*scale,
+		shift*scale,
+		shared.KNodeLookupsWeight,
+		shared.KModelSizeWeight,
+	)
+}
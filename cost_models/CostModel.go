@@ -0,0 +1,61 @@
+package cost_models
+
+import "alex_go/shared"
+
+// CostModel Turns the statistics gathered on nodes into comparable costs.
+// Data nodes, the fanout tree and the split decisions of the index all consult the same cost model
+type CostModel interface {
+	// DataNodeCost Cost of an average operation on a data node given its average number of exponential
+	// search iterations per operation, its average number of shifts per insert and its fraction of inserts
+	DataNodeCost(expSearchIterations float64, shifts float64, fracInserts float64) float64
+
+	// ModelSizeCost Cost of modelSize bytes of model nodes, amortised over the numKeys keys they index out
+	// of the totalKeys keys of the index
+	ModelSizeCost(modelSize float64, totalKeys int, numKeys int) float64
+
+	// NodeLookupsWeight Cost of traversing one additional node
+	NodeLookupsWeight() float64
+}
+
+// LinearCostModel Cost model that weighs each statistic linearly, as in the ALEX paper
+type LinearCostModel struct {
+	// ExpSearchIterationsWeight Intra-node cost of one exponential search iteration
+	ExpSearchIterationsWeight float64
+	// ShiftsWeight Intra-node cost of shifting one slot
+	ShiftsWeight float64
+	// TraversalWeight Cost of traversing one node
+	TraversalWeight float64
+	// ModelSizeWeight Cost of one byte of model
+	ModelSizeWeight float64
+}
+
+func (self *LinearCostModel) DataNodeCost(expSearchIterations float64, shifts float64, fracInserts float64) float64 {
+	return self.ExpSearchIterationsWeight*expSearchIterations + self.ShiftsWeight*shifts*fracInserts
+}
+
+func (self *LinearCostModel) ModelSizeCost(modelSize float64, totalKeys int, numKeys int) float64 {
+	return self.ModelSizeWeight * modelSize * float64(totalKeys) / float64(numKeys)
+}
+
+func (self *LinearCostModel) NodeLookupsWeight() float64 {
+	return self.TraversalWeight
+}
+
+func NewLinearCostModel(expSearchIterationsWeight float64, shiftsWeight float64, traversalWeight float64, modelSizeWeight float64) *LinearCostModel {
+	return &LinearCostModel{
+		ExpSearchIterationsWeight: expSearchIterationsWeight,
+		ShiftsWeight:              shiftsWeight,
+		TraversalWeight:           traversalWeight,
+		ModelSizeWeight:           modelSizeWeight,
+	}
+}
+
+// NewDefaultCostModel Cost model using the weights of the reference implementation
+func NewDefaultCostModel() *LinearCostModel {
+	return NewLinearCostModel(
+		shared.KExpSearchIterationsWeight,
+		shared.KShiftsWeight,
+		shared.KNodeLookupsWeight,
+		shared.KModelSizeWeight,
+	)
+}
@@ -0,0 +1,46 @@
+package cost_models
+
+import "alex_go/shared"
+
+// InsertFracEstimator Exponentially decaying estimate of the fraction of operations that are inserts.
+// Until enough operations have been observed it behaves like a plain average, afterwards older
+// operations fade out so that the estimate follows changes in the workload.
+type InsertFracEstimator struct {
+	insertFrac      float64
+	numObservations int
+}
+
+func (self *InsertFracEstimator) Record(isInsert bool) {
+	observation := 0.0
+	if isInsert {
+		observation = 1.0
+	}
+	self.numObservations++
+	weight := max(shared.KInsertFracDecayWeight, 1.0/float64(self.numObservations))
+	self.insertFrac += weight * (observation - self.insertFrac)
+}
+
+func (self *InsertFracEstimator) RecordInsert() {
+	self.Record(true)
+}
+
+func (self *InsertFracEstimator) RecordLookup() {
+	self.Record(false)
+}
+
+// InsertFrac Current estimate, or prior if nothing has been observed yet
+func (self *InsertFracEstimator) InsertFrac(prior float64) float64 {
+	if self.numObservations == 0 {
+		return prior
+	}
+	return self.insertFrac
+}
+
+func (self *InsertFracEstimator) NumObservations() int {
+	return self.numObservations
+}
+
+// IsReliable Whether enough operations have been observed for the estimate to be trusted over a prior
+func (self *InsertFracEstimator) IsReliable() bool {
+	return self.numObservations >= shared.KMinInsertFracObservations
+}
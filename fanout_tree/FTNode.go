@@ -1,6 +1,7 @@
 package fanout_tree
 
 import (
+	"alex_go/cost_models"
 	"alex_go/linear_model"
 	"alex_go/node"
 	"alex_go/shared"
@@ -57,7 +58,7 @@ func collectUsedNodes(fanoutTree [][]*FTNode, maxLevel int, usedFanoutTreeNodes
 
 // mergeNodesUpwards attempts to merge nodes upwards in the fanout tree if it reduces the cost.
 // It returns the new best cost.
-func mergeNodesUpwards(startLevel int, bestCost float64, numKeys int, totalKeys int, fanoutTree [][]*FTNode) float64 {
+func mergeNodesUpwards(startLevel int, bestCost float64, numKeys int, totalKeys int, fanoutTree [][]*FTNode, costModel cost_models.CostModel) float64 {
 	typeSize := float64(unsafe.Sizeof(node.NewDataNode(0)))
 
 	for level := startLevel; level >= 1; level-- {
@@ -71,7 +72,7 @@ func mergeNodesUpwards(startLevel int, bestCost float64, numKeys int, totalKeys
 					fanoutTree[level][2*i+1].Use = false
 					fanoutTree[level-1][i].Use = true
 					atLeastOneMerge = true
-					bestCost -= shared.KModelSizeWeight * typeSize * float64(totalKeys) / float64(numKeys)
+					bestCost -= costModel.ModelSizeCost(typeSize, totalKeys, numKeys)
 					continue
 				}
 				numLeftKeys := fanoutTree[level][2*i].NumKeys
@@ -79,7 +80,7 @@ func mergeNodesUpwards(startLevel int, bestCost float64, numKeys int, totalKeys
 				mergingCostSaving := (fanoutTree[level][2*i].Cost * float64(numLeftKeys) / float64(numNodeKeys)) +
 					(fanoutTree[level][2*i+1].Cost * float64(numRightKeys) / float64(numNodeKeys)) -
 					fanoutTree[level-1][i].Cost +
-					(shared.KModelSizeWeight * typeSize * float64(totalKeys) / float64(numNodeKeys))
+					costModel.ModelSizeCost(typeSize, totalKeys, numNodeKeys)
 
 				if mergingCostSaving >= 0 {
 					fanoutTree[level][2*i].Use = false
@@ -99,13 +100,17 @@ func mergeNodesUpwards(startLevel int, bestCost float64, numKeys int, totalKeys
 }
 
 // FindBestFanoutExistingNode determines the optimal fanout for existing nodes.
+// expectedInsertFrac is the fraction of inserts the new nodes are expected to serve.
+// usedFanoutTreeNodes is left untouched if an error is returned.
 func FindBestFanoutExistingNode(
 	parent *node.ModelNode,
 	bucketID int,
 	totalKeys int,
 	usedFanoutTreeNodes *[]*FTNode,
 	maxFanout int,
-) int {
+	expectedInsertFrac float64,
+	costModel cost_models.CostModel,
+) (int, error) {
 	typeSize := float64(unsafe.Sizeof(*node.NewDataNode(0)))
 	currentNode := parent.Children[bucketID].(*node.DataNode)
 	numKeys := currentNode.NumKeys
@@ -170,8 +175,10 @@ func FindBestFanoutExistingNode(
 			}, leftBoundary, rightBoundary)
 			modelBuilder.Build()
 
-			empiricalInsertFrac := currentNode.FracInserts()
-			nodeCost, expectedAvgExpSearchIterations, expectedAvgShifts := node.ComputeExpectedCostFromExisting(currentNode, leftBoundary, rightBoundary, shared.KInitialDensity, empiricalInsertFrac, linearModel)
+			nodeCost, expectedAvgExpSearchIterations, expectedAvgShifts, err := node.ComputeExpectedCostFromExisting(currentNode, leftBoundary, rightBoundary, shared.KInitialDensity, expectedInsertFrac, linearModel, costModel)
+			if err != nil {
+				return 0, err
+			}
 			cost += nodeCost * float64(numActualKeys) / float64(numKeys)
 
 			newLevel = append(newLevel, &FTNode{
@@ -188,7 +195,7 @@ func FindBestFanoutExistingNode(
 				linearModel.B,
 			})
 		}
-		traversalCost := shared.KNodeLookupsWeight + (shared.KModelSizeWeight * float64(fanout) * (typeSize + float64(unsafe.Sizeof(uintptr(0)))) * float64(totalKeys) / float64(numKeys))
+		traversalCost := costModel.NodeLookupsWeight() + costModel.ModelSizeCost(float64(fanout)*(typeSize+float64(unsafe.Sizeof(uintptr(0)))), totalKeys, numKeys)
 		cost += traversalCost
 		fanoutCosts = append(fanoutCosts, cost)
 
@@ -210,8 +217,8 @@ func FindBestFanoutExistingNode(
 		fanoutTree[bestLevel][n].Use = true
 	}
 
-	mergeNodesUpwards(bestLevel, bestCost, numKeys, totalKeys, fanoutTree)
+	mergeNodesUpwards(bestLevel, bestCost, numKeys, totalKeys, fanoutTree, costModel)
 	collectUsedNodes(fanoutTree, bestLevel, usedFanoutTreeNodes)
 
-	return bestLevel
+	return bestLevel, nil
 }
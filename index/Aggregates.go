@@ -0,0 +1,153 @@
+package index
+
+import (
+	"alex_go/node"
+	"alex_go/shared"
+)
+
+// Returns the model nodes above the leaf reached by the last call to traverseToLeaf with the bucket taken in each,
+// or nil if they are unknown because the traversal ended in a neighbour of the predicted leaf
+func (self *Index) traversedAncestors() []struct {
+	*node.ModelNode
+	int
+} {
+	if self.traversalCorrected {
+		return nil
+	}
+	return self.traversedPath
+}
+
+// Returns the model nodes above leaf with the bucket of the path in each, as traversedAncestors does, by traversing
+// again for key, a key held by leaf. Returns nil if the traversal ends in another leaf, or if its path does not
+// end in the bucket of leaf, so that the subtree counts are marked stale rather than updated in the wrong child
+func (self *Index) ancestorsOf(leaf *node.DataNode, key shared.KeyType) []struct {
+	*node.ModelNode
+	int
+} {
+	found, traversalPath, err := self.traverseToLeaf(key, true, noOperation)
+	if err != nil || found != leaf {
+		return nil
+	}
+	if last := traversalPath[len(traversalPath)-1]; last.ModelNode.Children[last.int] != node.Node(leaf) {
+		return nil
+	}
+	// Without the super root
+	return traversalPath[1:]
+}
+
+// Adds numKeys to the subtree counts of the given model nodes and to the counts of the children on the path, or
+// marks every subtree count stale if they are unknown
+func (self *Index) addToSubtreeCounts(ancestors []struct {
+	*node.ModelNode
+	int
+}, numKeys int) {
+	if ancestors == nil && !self.rootNode.IsLeaf() {
+		self.subtreeCountsStale = true
+		return
+	}
+	for _, step := range ancestors {
+		step.NumKeys += numKeys
+		step.AddChildKeys(step.int, numKeys)
+	}
+}
+
+// Recomputes the subtree counts of the model nodes if they went stale.
+// Inserts, deletes, splits and merges keep them up to date along the path they change. Root expansions, and the
+// rare changes to a leaf that cannot be reached again by a traversal, mark them stale so that they are recomputed
+// once, on the next aggregate query.
+func (self *Index) refreshSubtreeCounts() {
+	if !self.subtreeCountsStale {
+		return
+	}
+	countSubtree(self.rootNode)
+	self.subtreeCountsStale = false
+	self.numSubtreeRecounts++
+}
+
+func countSubtree(current node.Node) int {
+	if current.IsLeaf() {
+		return current.(*node.DataNode).NumKeys
+	}
+	modelNode := current.(*node.ModelNode)
+	for i := 0; i < modelNode.NumChildren; i += 1 << modelNode.Children[i].GetDuplicationFactor() {
+		countSubtree(modelNode.Children[i])
+	}
+	modelNode.RebuildChildCounts()
+	return modelNode.NumKeys
+}
+
+// Number of keys of the index smaller than key, or smaller than or equal to key if inclusive.
+// The model nodes on the path to the leaf of key contribute the keys of their children to the left of the path,
+// from their child counts, so only one leaf is searched.
+func (self *Index) countBefore(key shared.KeyType, inclusive bool) int {
+	self.refreshSubtreeCounts()
+	count := 0
+	current := self.rootNode
+	for !current.IsLeaf() {
+		modelNode := current.(*node.ModelNode)
+		bucketID := min(max(modelNode.LinearModel.Predict(float64(key)), 0), modelNode.NumChildren-1)
+		child := modelNode.Children[bucketID]
+		count += modelNode.NumKeysBefore(bucketID - bucketID%(1<<child.GetDuplicationFactor()))
+		current = child
+	}
+
+	leaf := current.(*node.DataNode)
+	count += leaf.CountBefore(key, inclusive)
+	// Keys on the boundary of the leaf may be stored in its neighbours
+	for prev := leaf.PrevLeaf; prev != nil && (prev.NumKeys == 0 || !isBefore(prev.GetLastKey(), key, inclusive)); prev = prev.PrevLeaf {
+		count -= prev.NumKeys - prev.CountBefore(key, inclusive)
+	}
+	for next := leaf.NextLeaf; next != nil && (next.NumKeys == 0 || isBefore(next.GetFirstKey(), key, inclusive)); next = next.NextLeaf {
+		count += next.CountBefore(key, inclusive)
+	}
+	return count
+}
+
+func isBefore(candidate shared.KeyType, key shared.KeyType, inclusive bool) bool {
+	return candidate < key || (inclusive && candidate == key)
+}
+
+// Rank Number of keys of the index smaller than key
+func (self *Index) Rank(key shared.KeyType) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.countBefore(key, false)
+}
+
+// CountRange Number of keys of the index in [lo, hi]
+func (self *Index) CountRange(lo shared.KeyType, hi shared.KeyType) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if lo > hi {
+		return 0
+	}
+	return self.countBefore(hi, true) - self.countBefore(lo, false)
+}
+
+// Select Returns the k-th smallest key of the index, counting from 0, with its payload.
+// Returns RankOutOfRangeError if k is negative or not smaller than the number of keys.
+func (self *Index) Select(k int) (shared.KeyType, shared.PayloadType, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.refreshSubtreeCounts()
+	var noPayload shared.PayloadType
+	if k < 0 || k >= node.SubtreeNumKeys(self.rootNode) {
+		return 0, noPayload, shared.RankOutOfRangeError
+	}
+
+	current := self.rootNode
+	for !current.IsLeaf() {
+		modelNode := current.(*node.ModelNode)
+		var bucketID int
+		if bucketID, k = modelNode.SelectChild(k); bucketID >= modelNode.NumChildren {
+			return 0, noPayload, shared.RankOutOfRangeError
+		}
+		current = modelNode.Children[bucketID]
+	}
+
+	key, payload, ok := current.(*node.DataNode).SelectKey(k)
+	if !ok {
+		return 0, noPayload, shared.RankOutOfRangeError
+	}
+	return key, payload, nil
+}
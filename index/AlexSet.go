@@ -0,0 +1,127 @@
+package index
+
+import (
+	"alex_go/node"
+	"alex_go/shared"
+)
+
+// AlexSet Ordered set of keys backed by an index whose data nodes are keys-only.
+// The data nodes allocate no payload slots, so a set takes about half the memory of an index holding the same keys.
+type AlexSet struct {
+	index *Index
+}
+
+func NewAlexSet() *AlexSet {
+	index := NewIndex()
+	root := index.rootNode.(*node.DataNode)
+	root.KeysOnly = true
+	root.Payloads = nil
+	return &AlexSet{index: index}
+}
+
+// Index The underlying index, whose payloads are all zero
+func (self *AlexSet) Index() *Index {
+	return self.index
+}
+
+// Add Adds key to the set, returns whether it was not already in it
+func (self *AlexSet) Add(key shared.KeyType) (bool, error) {
+	added := false
+	err := self.index.Compute(key, func(payload shared.PayloadType, exists bool) (shared.PayloadType, bool) {
+		added = !exists
+		return payload, !exists
+	})
+	return added, err
+}
+
+// Contains Whether key is in the set
+func (self *AlexSet) Contains(key shared.KeyType) bool {
+	_, err := self.index.Find(key)
+	return err == nil
+}
+
+// Remove Removes key from the set, returns whether it was in it
+func (self *AlexSet) Remove(key shared.KeyType) bool {
+	return self.index.Delete(key) > 0
+}
+
+// Len Number of keys in the set
+func (self *AlexSet) Len() int {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	return self.index.numKeys
+}
+
+// Iterate Calls yield for every key of the set in ascending order, stops as soon as yield returns false.
+// yield must not modify the set.
+func (self *AlexSet) Iterate(yield func(shared.KeyType) bool) {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	for leaf := self.index.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		completed := leaf.Ascend(shared.MinKey, func(key shared.KeyType, _ shared.PayloadType) bool {
+			return yield(key)
+		})
+		if !completed {
+			return
+		}
+	}
+}
+
+// Keys Returns the keys of the set in ascending order
+func (self *AlexSet) Keys() []shared.KeyType {
+	keys := make([]shared.KeyType, 0, self.Len())
+	self.Iterate(func(key shared.KeyType) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Union Returns a new set holding the keys that are in self or in other
+func (self *AlexSet) Union(other *AlexSet) (*AlexSet, error) {
+	return mergeSets(self.Keys(), other.Keys(), true, true, true)
+}
+
+// Intersection Returns a new set holding the keys that are both in self and in other
+func (self *AlexSet) Intersection(other *AlexSet) (*AlexSet, error) {
+	return mergeSets(self.Keys(), other.Keys(), false, true, false)
+}
+
+// Difference Returns a new set holding the keys that are in self but not in other
+func (self *AlexSet) Difference(other *AlexSet) (*AlexSet, error) {
+	return mergeSets(self.Keys(), other.Keys(), true, false, false)
+}
+
+// Merges two sorted key lists and bulk inserts the result into a new set.
+// keepLeft, keepBoth and keepRight tell whether keys found only in left, in both or only in right are kept.
+func mergeSets(left []shared.KeyType, right []shared.KeyType, keepLeft bool, keepBoth bool, keepRight bool) (*AlexSet, error) {
+	merged := make([]shared.KeyType, 0, len(left)+len(right))
+	i, j := 0, 0
+	for i < len(left) || j < len(right) {
+		switch {
+		case j == len(right) || (i < len(left) && left[i] < right[j]):
+			if keepLeft {
+				merged = append(merged, left[i])
+			}
+			i++
+		case i == len(left) || right[j] < left[i]:
+			if keepRight {
+				merged = append(merged, right[j])
+			}
+			j++
+		default:
+			if keepBoth {
+				merged = append(merged, left[i])
+			}
+			i++
+			j++
+		}
+	}
+
+	result := NewAlexSet()
+	// The batch walks the sorted keys leaf by leaf
+	if err := result.index.InsertBatch(merged, make([]shared.PayloadType, len(merged))); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
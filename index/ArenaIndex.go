@@ -0,0 +1,118 @@
+package index
+
+import (
+	"alex_go/arena"
+	"alex_go/shared"
+)
+
+// ArenaIndex Index whose values of type V are stored out of line in an arena.
+// The payload slots of the data nodes only hold arena handles, so shifts and resizes never move the values
+// themselves, which matters for large values. Values of deleted keys are reclaimed by the arena's compaction.
+type ArenaIndex[V any] struct {
+	index  *Index
+	values *arena.Arena[V]
+}
+
+func NewArenaIndex[V any]() *ArenaIndex[V] {
+	return &ArenaIndex[V]{
+		index:  NewIndex(),
+		values: arena.NewArena[V](),
+	}
+}
+
+// Index The underlying index, whose payloads are arena handles
+func (self *ArenaIndex[V]) Index() *Index {
+	return self.index
+}
+
+// Insert Stores value out of line and inserts key with its handle.
+// Like Index.Insert, inserting a key twice stores it twice.
+func (self *ArenaIndex[V]) Insert(key shared.KeyType, value V) error {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	handle := self.values.Put(value)
+	if err := self.index.insert(key, shared.PayloadType(handle)); err != nil {
+		self.values.Free(handle)
+		return err
+	}
+	return nil
+}
+
+// Find Returns the value of key
+func (self *ArenaIndex[V]) Find(key shared.KeyType) (V, error) {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	self.index.numLookups++
+	self.index.workload.RecordLookup()
+	leaf, _, _ := self.index.traverseToLeaf(key, false, lookupOperation)
+	handle, err := self.index.findInLeaf(leaf, key, lookupOperation)
+	if err != nil {
+		var missing V
+		return missing, err
+	}
+	return self.values.Get(arena.Handle(*handle)), nil
+}
+
+// Upsert Replaces the value of key in place, or inserts key if it is not in the index
+func (self *ArenaIndex[V]) Upsert(key shared.KeyType, value V) error {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	var handle arena.Handle
+	inserted := false
+	err := self.index.compute(key, func(existing shared.PayloadType, exists bool) (shared.PayloadType, bool) {
+		if exists {
+			// The handle stays the same, only the value changes
+			self.values.Set(arena.Handle(existing), value)
+			return existing, false
+		}
+		handle = self.values.Put(value)
+		inserted = true
+		return shared.PayloadType(handle), true
+	})
+	if err != nil && inserted {
+		self.values.Free(handle)
+	}
+	return err
+}
+
+// DeleteRange Deletes every key in [lo, hi), frees their values and returns how many keys were deleted
+func (self *ArenaIndex[V]) DeleteRange(lo shared.KeyType, hi shared.KeyType) int {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	return self.deleteRange(lo, hi, false)
+}
+
+// Delete Deletes every copy of key, frees their values and returns how many were deleted
+func (self *ArenaIndex[V]) Delete(key shared.KeyType) int {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	return self.deleteRange(key, key, true)
+}
+
+func (self *ArenaIndex[V]) deleteRange(lo shared.KeyType, hi shared.KeyType, hiInclusive bool) int {
+	if lo > hi || (lo == hi && !hiInclusive) {
+		return 0
+	}
+	self.index.scanDescending(hi, hiInclusive, func(key shared.KeyType, handle shared.PayloadType) bool {
+		if key < lo {
+			return false
+		}
+		self.values.Free(arena.Handle(handle))
+		return true
+	})
+	return self.index.deleteRange(lo, hi, hiInclusive)
+}
+
+// NumValues Number of values held by the arena
+func (self *ArenaIndex[V]) NumValues() int {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	return self.values.Len()
+}
+
+// Compact Reclaims the space of freed values right away instead of waiting for the arena to compact itself
+func (self *ArenaIndex[V]) Compact() {
+	self.index.lock.Lock()
+	defer self.index.lock.Unlock()
+	self.values.Compact()
+}
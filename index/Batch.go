@@ -0,0 +1,214 @@
+package index
+
+import (
+	"alex_go/node"
+	"alex_go/shared"
+	"math"
+	"slices"
+)
+
+// Relative safety margin kept from the boundaries of the key range of a leaf, so that floating-point errors and
+// the neighbour corrections of traverseToLeaf never route a key inside the range to another leaf
+const leafRangeMargin = 1e-6
+
+// Number of leaves sorted batches follow along the leaf chain to find the leaf of a key above the current one,
+// before traversing the index again
+const leafChainSteps = 2
+
+// leafRange Data node a run of keys is routed to, together with the open key interval (Low, High) inside which
+// every key is routed to it
+type leafRange struct {
+	leaf *node.DataNode
+	// Model nodes and buckets from the super root to the leaf, nil if unknown
+	path []struct {
+		*node.ModelNode
+		int
+	}
+	ancestors []struct {
+		*node.ModelNode
+		int
+	}
+	low  float64
+	high float64
+}
+
+func (self *leafRange) contains(key shared.KeyType) bool {
+	return self.leaf != nil && float64(key) > self.low && float64(key) < self.high
+}
+
+// Whether key is routed to a leaf after this one
+func (self *leafRange) below(key shared.KeyType) bool {
+	return self.leaf != nil && self.low < self.high && float64(key) >= self.high
+}
+
+// Traverses to the leaf responsible for key and derives from the buckets on the traversal path the range of keys
+// that are routed to the same leaf.
+// The range is empty if it cannot be derived safely, in which case every key is traversed for.
+func (self *Index) traverseToLeafRange(key shared.KeyType, operation operationKind) leafRange {
+	leaf, traversalPath, err := self.traverseToLeaf(key, true, operation)
+	if err != nil {
+		// The leaf is still found by a traversal that does not build the path, but no range can be derived
+		leaf, _, _ = self.traverseToLeaf(key, false, noOperation)
+		ancestors := self.traversedAncestors()
+		if ancestors != nil {
+			ancestors = slices.Clone(ancestors)
+		}
+		return leafRange{leaf: leaf, ancestors: ancestors, low: math.Inf(1), high: math.Inf(-1)}
+	}
+	return self.pathRange(leaf, traversalPath)
+}
+
+// Range of the leaf after current in the leaf chain, found by moving the path of current to its right neighbour.
+// Returns a range without leaf if there is none or the path of current is unknown
+func (self *Index) nextLeafRange(current leafRange) leafRange {
+	next := current.leaf.NextLeaf
+	if next == nil || current.path == nil {
+		return leafRange{}
+	}
+	path := slices.Clone(current.path)
+	if err := self.correctTraversalPath(current.leaf, &path, false); err != nil {
+		return leafRange{}
+	}
+	return self.pathRange(next, path)
+}
+
+// Range of the leaf key is routed to, for a key outside of current. Keys routed to the next leaves, as in sorted
+// batches, are found along the leaf chain, other keys and keys the chain does not bracket are traversed for
+func (self *Index) routeToLeafRange(current leafRange, key shared.KeyType, operation operationKind) leafRange {
+	for step := 0; step < leafChainSteps && current.below(key); step++ {
+		current = self.nextLeafRange(current)
+		if current.contains(key) {
+			return current
+		}
+	}
+	return self.traverseToLeafRange(key, operation)
+}
+
+// Derives the range of the keys routed to leaf from path, the model nodes and buckets from the super root to it
+func (self *Index) pathRange(leaf *node.DataNode, path []struct {
+	*node.ModelNode
+	int
+}) leafRange {
+	if last := path[len(path)-1]; last.ModelNode.Children[last.int] != node.Node(leaf) {
+		// The path ends in another leaf, the subtree counts of leaf are unknown as well
+		return leafRange{leaf: leaf, low: math.Inf(1), high: math.Inf(-1)}
+	}
+	result := leafRange{leaf: leaf, path: path, ancestors: path[1:], low: math.Inf(-1), high: math.Inf(1)}
+	empty := leafRange{leaf: leaf, path: path, ancestors: path[1:], low: math.Inf(1), high: math.Inf(-1)}
+	for _, step := range path {
+		modelNode, bucketID := step.ModelNode, step.int
+		child := modelNode.Children[bucketID]
+		repeats := 1 << child.GetDuplicationFactor()
+		startBucketID := bucketID - bucketID%repeats
+		endBucketID := startBucketID + repeats
+		if endBucketID > modelNode.NumChildren || modelNode.Children[startBucketID] != child || modelNode.Children[endBucketID-1] != child {
+			return empty
+		}
+		if startBucketID == 0 && endBucketID == modelNode.NumChildren {
+			continue
+		}
+
+		model := modelNode.GetLinearModel()
+		if model.A <= 0 {
+			return empty
+		}
+		margin := 1 + leafRangeMargin*(float64(endBucketID)+math.Abs(model.B))/model.A
+		if startBucketID > 0 {
+			result.low = max(result.low, (float64(startBucketID)-model.B)/model.A+margin)
+		}
+		if endBucketID < modelNode.NumChildren {
+			result.high = min(result.high, (float64(endBucketID)-model.B)/model.A-margin)
+		}
+	}
+	return result
+}
+
+// InsertBatch Inserts keys[i] with payloads[i] for every i, in order.
+// Consecutive keys routed to the same data node are inserted without traversing the index again, and sorted or
+// mostly sorted batches move on to the next data nodes along the leaf chain, so they are inserted leaf by leaf. A run of keys that overflows a data node resizes it once for
+// the whole run, or splits it once if its cost calls for a split.
+// If an insert fails, the keys before it remain inserted.
+func (self *Index) InsertBatch(keys []shared.KeyType, payloads []shared.PayloadType) error {
+	if len(keys) != len(payloads) {
+		return shared.BatchLengthMismatchError
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	current := leafRange{}
+	for i := 0; i < len(keys); i++ {
+		key := keys[i]
+		if key > self.keyDomainMax || key < self.keyDomainMin {
+			// Expanding the key domain may restructure the index
+			if err := self.insert(key, payloads[i]); err != nil {
+				return err
+			}
+			current = leafRange{}
+			continue
+		}
+
+		self.workload.RecordInsert()
+		if !current.contains(key) {
+			current = self.routeToLeafRange(current, key, insertOperation)
+			runLength := 1
+			for i+runLength < len(keys) && current.contains(keys[i+runLength]) {
+				runLength++
+			}
+			if runLength > 1 {
+				self.reserveForRun(current.leaf, runLength)
+			}
+		}
+
+		numSplits := self.numSidewaysSplits + self.numDownwardSplits
+		if err := self.insertIntoLeaf(current.leaf, current.ancestors, key, payloads[i]); err != nil {
+			return err
+		}
+		if self.numSidewaysSplits+self.numDownwardSplits != numSplits {
+			// The leaf was replaced, the rest of the run is routed again
+			current = leafRange{}
+		}
+	}
+	return nil
+}
+
+// Grows leaf once so that a run of numKeys inserts does not resize it repeatedly.
+// Leaves whose cost calls for a split are left alone: the first insert that fills them splits them.
+func (self *Index) reserveForRun(leaf *node.DataNode, numKeys int) {
+	if float64(leaf.NumKeys+numKeys) < leaf.ExpansionThreshold {
+		return
+	}
+	if leaf.SignificantCostDeviation() || leaf.CatastrophicCost() {
+		return
+	}
+	if self.memoryBudget > 0 {
+		// The run may not fit into the budget, its inserts grow the leaf one at a time instead
+		return
+	}
+	leafSize := leaf.GetNodeSize()
+	leaf.ReserveCapacity(numKeys)
+	self.leafResized(leaf, leafSize)
+}
+
+// FindBatch Looks up every key of keys.
+// Returns the payload of each key and whether it was found. Consecutive keys routed to the same data node are
+// looked up without traversing the index again, and sorted keys follow the leaf chain to the next data nodes.
+func (self *Index) FindBatch(keys []shared.KeyType) ([]shared.PayloadType, []bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	payloads := make([]shared.PayloadType, len(keys))
+	found := make([]bool, len(keys))
+	current := leafRange{}
+	for i, key := range keys {
+		self.numLookups++
+		self.workload.RecordLookup()
+		if !current.contains(key) {
+			current = self.routeToLeafRange(current, key, lookupOperation)
+		}
+		if payload, err := self.findInLeaf(current.leaf, key, lookupOperation); err == nil {
+			payloads[i] = *payload
+			found[i] = true
+		}
+	}
+	return payloads, found
+}
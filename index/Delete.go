@@ -0,0 +1,127 @@
+package index
+
+import (
+	"alex_go/node"
+	"alex_go/shared"
+	"slices"
+)
+
+// DeleteRange Deletes every key in [lo, hi) and returns how many keys were deleted.
+// Data nodes left empty are merged into a neighbouring data node when they share a parent and span as many
+// buckets of it.
+func (self *Index) DeleteRange(lo shared.KeyType, hi shared.KeyType) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.deleteRange(lo, hi, false)
+}
+
+// Delete Deletes every copy of key and returns how many were deleted. Unlike DeleteRange, it reaches shared.MaxKey
+func (self *Index) Delete(key shared.KeyType) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.deleteRange(key, key, true)
+}
+
+// Deletes every key in [lo, hi), or in [lo, hi] if hiInclusive
+func (self *Index) deleteRange(lo shared.KeyType, hi shared.KeyType, hiInclusive bool) int {
+	if lo > hi || (lo == hi && !hiInclusive) {
+		return 0
+	}
+
+	numDeleted := 0
+	// Leaves are dropped once the whole range is erased, so that merges do not interfere with the walk
+	emptiedLeaves := make([]*node.DataNode, 0)
+	emptiedFirstKeys := make([]shared.KeyType, 0)
+	firstLeaf, _, _ := self.traverseToLeaf(lo, false, noOperation)
+	firstAncestors := slices.Clone(self.traversedAncestors())
+	// Keys on the boundary of the leaf may be stored in the preceding leaves
+	startLeaf := firstLeaf
+	for prev := firstLeaf.PrevLeaf; prev != nil; prev = prev.PrevLeaf {
+		if prev.NumKeys == 0 {
+			continue
+		}
+		if prev.GetLastKey() < lo {
+			break
+		}
+		startLeaf = prev
+	}
+	for leaf := startLeaf; leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.NumKeys == 0 {
+			continue
+		}
+		firstKey := leaf.GetFirstKey()
+		if firstKey > hi || (firstKey == hi && !hiInclusive) {
+			break
+		}
+		ancestors := firstAncestors
+		if leaf != firstLeaf || ancestors == nil {
+			ancestors = self.ancestorsOf(leaf, firstKey)
+		}
+		leafSize := leaf.GetNodeSize()
+		numErased := leaf.EraseRange(lo, hi, hiInclusive)
+		self.leafResized(leaf, leafSize)
+		if numErased > 0 {
+			self.addToSubtreeCounts(ancestors, -numErased)
+		}
+		numDeleted += numErased
+		if leaf.NumKeys == 0 {
+			emptiedLeaves = append(emptiedLeaves, leaf)
+			emptiedFirstKeys = append(emptiedFirstKeys, firstKey)
+		}
+	}
+	for i, leaf := range emptiedLeaves {
+		self.dropEmptyLeaf(leaf, emptiedFirstKeys[i])
+	}
+
+	self.numKeys -= numDeleted
+	return numDeleted
+}
+
+// Points the buckets of an empty leaf to its buddy, the data node spanning the adjacent, equally sized and aligned
+// range of buckets of the same parent, and unlinks the leaf. Repeats with the merged node while it is empty.
+// firstKey is a key the leaf held, used to locate it.
+// Leaves without such a buddy are kept, leaves already merged into a buddy are ignored.
+func (self *Index) dropEmptyLeaf(leaf *node.DataNode, firstKey shared.KeyType) {
+	if self.rootNode.IsLeaf() {
+		return
+	}
+	found, traversalPath, err := self.traverseToLeaf(firstKey, true, noOperation)
+	if err != nil {
+		return
+	}
+	parent := traversalPath[len(traversalPath)-1]
+	if found != leaf || parent.Children[parent.int] != node.Node(leaf) {
+		return
+	}
+
+	for leaf.NumKeys == 0 {
+		repeats := 1 << leaf.GetDuplicationFactor()
+		startBucketID := parent.int - parent.int%repeats
+		buddyStartBucketID := startBucketID ^ repeats
+		if buddyStartBucketID+repeats > parent.NumChildren {
+			return
+		}
+		buddy, ok := parent.Children[buddyStartBucketID].(*node.DataNode)
+		if !ok || buddy.GetDuplicationFactor() != leaf.GetDuplicationFactor() || parent.Children[buddyStartBucketID+repeats-1] != node.Node(buddy) {
+			return
+		}
+
+		for i := startBucketID; i < startBucketID+repeats; i++ {
+			parent.Children[i] = buddy
+		}
+		buddy.SetDuplicationFactor(buddy.GetDuplicationFactor() + 1)
+		mergedStartBucketID := min(startBucketID, buddyStartBucketID)
+		parent.RecountChildKeys(mergedStartBucketID, mergedStartBucketID+2*repeats)
+		if leaf.PrevLeaf != nil {
+			leaf.PrevLeaf.NextLeaf = leaf.NextLeaf
+		}
+		if leaf.NextLeaf != nil {
+			leaf.NextLeaf.PrevLeaf = leaf.PrevLeaf
+		}
+		leaf.PrevLeaf = nil
+		leaf.NextLeaf = nil
+		self.numDataNodes--
+		self.footprint -= leaf.GetNodeSize()
+		leaf = buddy
+	}
+}
@@ -0,0 +1,47 @@
+package index
+
+import (
+	"alex_go/node"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportTree Writes the nodes of the index depth first, one per line and indented by level. Model nodes list their
+// model and fanout, data nodes their model, keys, capacity, search strategy and model error bounds, so that leaves
+// with degraded models can be spotted
+func (self *Index) ExportTree(w io.Writer) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.refreshSubtreeCounts()
+	writer := bufio.NewWriter(w)
+	rootLevel := self.rootNode.GetLevel()
+	var export func(current node.Node, repeats int)
+	export = func(current node.Node, repeats int) {
+		indent := strings.Repeat("  ", current.GetLevel()-rootLevel)
+		model := current.GetLinearModel()
+		if current.IsLeaf() {
+			leaf := current.(*node.DataNode)
+			fmt.Fprintf(writer, "%sdata level=%d pointers=%d a=%g b=%g keys=%d capacity=%d", indent, leaf.GetLevel(), repeats, model.A, model.B, leaf.NumKeys, leaf.DataCapacity)
+			if leaf.NumKeys > 0 {
+				fmt.Fprintf(writer, " first=%d last=%d", leaf.GetFirstKey(), leaf.GetLastKey())
+			}
+			fmt.Fprintf(writer, " error=[%d,%d] search=%v\n", leaf.MinError, leaf.MaxError, leaf.GetSearchStrategy())
+			return
+		}
+		modelNode := current.(*node.ModelNode)
+		fmt.Fprintf(writer, "%smodel level=%d pointers=%d a=%g b=%g children=%d keys=%d\n", indent, modelNode.GetLevel(), repeats, model.A, model.B, modelNode.NumChildren, modelNode.NumKeys)
+		for i := 0; i < modelNode.NumChildren; {
+			child := modelNode.Children[i]
+			childRepeats := 1
+			for i+childRepeats < modelNode.NumChildren && modelNode.Children[i+childRepeats] == child {
+				childRepeats++
+			}
+			export(child, childRepeats)
+			i += childRepeats
+		}
+	}
+	export(self.rootNode, 1)
+	return writer.Flush()
+}
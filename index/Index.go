@@ -1,12 +1,15 @@
 package index
 
 import (
+	"alex_go/cost_models"
 	"alex_go/fanout_tree"
 	"alex_go/linear_model"
 	"alex_go/node"
 	"alex_go/shared"
 	"errors"
+	"fmt"
 	"math"
+	"sync"
 )
 
 type Index struct {
@@ -24,11 +27,25 @@ type Index struct {
 	// For simplicity, operations are either point lookups ("reads") or inserts
 	// ("writes)
 	// i.e., 0 means we expect a read-only workload, 1 means write-only
+	// Only used as a prior until enough operations have been observed by workload
 	expectedInsertFrac float64
+	// Decaying estimate of the fraction of inserts among recent operations on the whole index
+	workload cost_models.InsertFracEstimator
 	// Maximum node size, in bytes. By default, 16MB.
 	// Higher values result in better average throughput, but worse tail/max
 	// insert latency
 	maxNodeSize int
+	// Weighs node statistics into costs for every split and resize decision
+	costModel cost_models.CostModel
+	// Number of keys migrated per operation while a data node resizes incrementally.
+	// 0 means data nodes resize in one go
+	incrementalResizeChunk int
+	// How data nodes search around predicted positions, AdaptiveSearch lets every data node select it
+	searchStrategy node.SearchStrategy
+	// How data nodes make room for keys inserted into filled slots
+	dataNodeLayout node.DataNodeLayout
+	// How data nodes store their keys and payloads, data nodes built from existing ones inherit it
+	slotLayout node.SlotLayout
 	// Approximate model computation: bulk load faster by using sampling to train models
 	approximateModelComputation bool
 	// Approximate cost computation: bulk load faster by using sampling to compute cost
@@ -61,6 +78,10 @@ type Index struct {
 	numInserts                    int64
 	splittingTime                 float64
 	costComputationTime           float64
+	numBackgroundReorganisations  int
+	numDeferredReorganisations    int
+	numSubtreeRecounts            int
+	numFootprintRecounts          int
 
 	// -- Internal parameters --
 	keyDomainMin                   shared.KeyType
@@ -82,6 +103,33 @@ type Index struct {
 	// Additional cost due to this node if propagation continues past this node.
 	// Equal to number of new pointers due to node splitting, plus size of metadata of new model node.
 	splitCost float64
+
+	// -- Subtree counts --
+	// Model nodes traversed by the last call to traverseToLeaf with the bucket taken in each, from the root down
+	traversedPath []struct {
+		*node.ModelNode
+		int
+	}
+	// Whether the last call to traverseToLeaf ended in a neighbour of the predicted leaf
+	traversalCorrected bool
+	// Whether the NumKeys of the model nodes must be recomputed before being used
+	subtreeCountsStale bool
+
+	// -- Memory budget --
+	// Maximum number of bytes held by the nodes, 0 means unbounded
+	memoryBudget int64
+	// Bytes held by the nodes, kept up to date by the operations that resize, add or replace nodes
+	footprint int64
+	// Whether footprint must be recomputed before being used
+	footprintStale bool
+	// Whether the footprint was close to the budget at the start of the current insert
+	memoryPressure bool
+
+	// -- Background maintenance --
+	// Serialises the public operations with the maintenance goroutine
+	lock sync.Mutex
+	// nil unless StartMaintenance was called
+	maintenance *maintenanceWorker
 }
 
 func (self *Index) createSuperRoot() {
@@ -94,7 +142,36 @@ func (self *Index) createSuperRoot() {
 	self.updateSuperRootNodePointer()
 }
 
+// FirstDataNode Leftmost data node of the index. The data nodes reached through NextLeaf are only stable while no
+// maintenance goroutine runs
 func (self *Index) FirstDataNode() *node.DataNode {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.firstDataNode()
+}
+
+// LastDataNode Rightmost data node of the index, see FirstDataNode
+func (self *Index) LastDataNode() *node.DataNode {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.lastDataNode()
+}
+
+// GetMinKey Smallest key of the index, MaxKey if the index is empty
+func (self *Index) GetMinKey() shared.KeyType {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.minKey()
+}
+
+// GetMaxKey Largest key of the index, MinKey if the index is empty
+func (self *Index) GetMaxKey() shared.KeyType {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.maxKey()
+}
+
+func (self *Index) firstDataNode() *node.DataNode {
 	current := self.rootNode
 
 	// Cast the current node to a ModelNode
@@ -106,7 +183,7 @@ func (self *Index) FirstDataNode() *node.DataNode {
 	return current.(*node.DataNode)
 }
 
-func (self *Index) LastDataNode() *node.DataNode {
+func (self *Index) lastDataNode() *node.DataNode {
 	current := self.rootNode
 
 	// Cast the current node to a ModelNode
@@ -118,12 +195,20 @@ func (self *Index) LastDataNode() *node.DataNode {
 	return current.(*node.DataNode)
 }
 
-func (self *Index) GetMinKey() shared.KeyType {
-	return self.FirstDataNode().GetFirstKey()
+func (self *Index) minKey() shared.KeyType {
+	leaf := self.firstDataNode()
+	for leaf.NextLeaf != nil && leaf.NumKeys == 0 {
+		leaf = leaf.NextLeaf
+	}
+	return leaf.GetFirstKey()
 }
 
-func (self *Index) GetMaxKey() shared.KeyType {
-	return self.LastDataNode().GetLastKey()
+func (self *Index) maxKey() shared.KeyType {
+	leaf := self.lastDataNode()
+	for leaf.PrevLeaf != nil && leaf.NumKeys == 0 {
+		leaf = leaf.PrevLeaf
+	}
+	return leaf.GetLastKey()
 }
 
 // Make a correction to the traversal path to instead point to the leaf node
@@ -131,75 +216,78 @@ func (self *Index) GetMaxKey() shared.KeyType {
 func (self *Index) correctTraversalPath(leaf *node.DataNode, traversalPath *[]struct {
 	*node.ModelNode
 	int
-}, left bool) {
+}, left bool) error {
+	repeats := 1 << leaf.GetDuplicationFactor()
+	tn := &(*traversalPath)[len(*traversalPath)-1]
 	if left {
-		repeats := 1 << leaf.GetDuplicationFactor()
-		tn := (*traversalPath)[len(*traversalPath)-1]
 		startBucketID := tn.int - (tn.int % repeats)
-		if startBucketID == 0 {
-			for startBucketID == 0 {
-				*traversalPath = (*traversalPath)[:len(*traversalPath)-1] // Pop the last element
-				repeats = 1 << tn.ModelNode.GetDuplicationFactor()
-				tn = (*traversalPath)[len(*traversalPath)-1]
-				startBucketID = tn.int - (tn.int % repeats)
-			}
-			correctBucketID := startBucketID - 1
-			tn.int = correctBucketID
-
-			currentNode := &tn.ModelNode.Children[correctBucketID]
-			for !(*currentNode).IsLeaf() {
-				currentModelNode, _ := (*currentNode).(*node.ModelNode)
-				*traversalPath = append(*traversalPath, struct {
-					*node.ModelNode
-					int
-				}{currentModelNode, currentModelNode.NumChildren - 1})
-				currentNode = &currentModelNode.Children[currentModelNode.NumChildren-1]
-			}
-
-			if (*currentNode).(*node.DataNode) != leaf.PrevLeaf {
-				panic("Incorrect traversal path")
-			}
-		} else {
-			tn.int = startBucketID - 1
+		for startBucketID == 0 {
+			*traversalPath = (*traversalPath)[:len(*traversalPath)-1] // Pop the last element
+			repeats = 1 << tn.ModelNode.GetDuplicationFactor()
+			tn = &(*traversalPath)[len(*traversalPath)-1]
+			startBucketID = tn.int - (tn.int % repeats)
 		}
+		tn.int = startBucketID - 1
 	} else {
-		repeats := 1 << leaf.GetDuplicationFactor()
-		tn := (*traversalPath)[len(*traversalPath)-1]
 		endBucketID := tn.int - (tn.int % repeats) + repeats
-		if endBucketID == tn.ModelNode.NumChildren {
-			for endBucketID == tn.ModelNode.NumChildren {
-				*traversalPath = (*traversalPath)[:len(*traversalPath)-1] // Pop the last element
-				repeats = 1 << tn.ModelNode.GetDuplicationFactor()
-				tn = (*traversalPath)[len(*traversalPath)-1]
-				endBucketID = tn.int - (tn.int % repeats) + repeats
-			}
-			correctBucketID := endBucketID
-			tn.int = correctBucketID
-
-			currentNode := &tn.ModelNode.Children[correctBucketID]
-			for !(*currentNode).IsLeaf() {
-				currentModelNode, _ := (*currentNode).(*node.ModelNode)
-				*traversalPath = append(*traversalPath, struct {
-					*node.ModelNode
-					int
-				}{currentModelNode, 0})
-				currentNode = &currentModelNode.Children[0]
-			}
+		for endBucketID == tn.ModelNode.NumChildren {
+			*traversalPath = (*traversalPath)[:len(*traversalPath)-1] // Pop the last element
+			repeats = 1 << tn.ModelNode.GetDuplicationFactor()
+			tn = &(*traversalPath)[len(*traversalPath)-1]
+			endBucketID = tn.int - (tn.int % repeats) + repeats
+		}
+		tn.int = endBucketID
+	}
 
-			if (*currentNode).(*node.DataNode) != leaf.NextLeaf {
-				panic("Incorrect traversal path")
-			}
-		} else {
-			tn.int = endBucketID
+	// The neighbouring bucket may hold a model node, whose last leaf is on the left and first leaf on the right
+	currentNode := tn.ModelNode.Children[tn.int]
+	for !currentNode.IsLeaf() {
+		currentModelNode := currentNode.(*node.ModelNode)
+		bucketID := 0
+		if left {
+			bucketID = currentModelNode.NumChildren - 1
 		}
+		*traversalPath = append(*traversalPath, struct {
+			*node.ModelNode
+			int
+		}{currentModelNode, bucketID})
+		currentNode = currentModelNode.Children[bucketID]
+	}
 
+	if left && currentNode.(*node.DataNode) != leaf.PrevLeaf {
+		return fmt.Errorf("%w: the leaf left of the corrected path is not the previous leaf", shared.IncorrectTraversalPathError)
 	}
+	if !left && currentNode.(*node.DataNode) != leaf.NextLeaf {
+		return fmt.Errorf("%w: the leaf right of the corrected path is not the next leaf", shared.IncorrectTraversalPathError)
+	}
+	return nil
 }
 
+// Kind of operation a traversal is made for, recorded in the insert fraction estimates of the model
+// nodes on the path
+type operationKind int
+
+const (
+	noOperation operationKind = iota
+	lookupOperation
+	insertOperation
+)
+
+// GetLeaf Data node key is routed to, with the model nodes and buckets on the way if buildTraversalPath
 func (self *Index) GetLeaf(key shared.KeyType, buildTraversalPath bool) (*node.DataNode, []struct {
 	*node.ModelNode
 	int
-}) {
+}, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.traverseToLeaf(key, buildTraversalPath, noOperation)
+}
+
+// Only the correction of the traversal path can fail, traversals that do not build it never return an error
+func (self *Index) traverseToLeaf(key shared.KeyType, buildTraversalPath bool, operation operationKind) (*node.DataNode, []struct {
+	*node.ModelNode
+	int
+}, error) {
 	traversalPath := make([]struct {
 		*node.ModelNode
 		int
@@ -211,60 +299,107 @@ func (self *Index) GetLeaf(key shared.KeyType, buildTraversalPath bool) (*node.D
 		}{self.superRootNode, 0})
 	}
 
+	self.traversedPath = self.traversedPath[:0]
+	self.traversalCorrected = false
 	currentNode := self.rootNode
 	for currentNode.IsLeaf() {
-		return self.rootNode.(*node.DataNode), traversalPath
+		return self.rootNode.(*node.DataNode), traversalPath, nil
 	}
 
+	// Whether a model node predicted a bucket next to a bucket boundary or outside of its buckets, the key may then
+	// belong to a neighbour of the predicted leaf
+	ambiguous := false
+	epsilon := math.Nextafter(1.0, 2.0) - 1.0 // https://stackoverflow.com/questions/22185636/easiest-way-to-get-the-machine-epsilon-in-go
 	for {
 		currentModelNode := currentNode.(*node.ModelNode)
+		if operation != noOperation {
+			currentModelNode.Workload.Record(operation == insertOperation)
+		}
 		bucketIDPrediction := currentNode.GetLinearModel().PredictDouble(float64(key))
 		bucketID := min(max(int(bucketIDPrediction), 0), currentModelNode.NumChildren-1)
+		self.traversedPath = append(self.traversedPath, struct {
+			*node.ModelNode
+			int
+		}{currentModelNode, bucketID})
 		if buildTraversalPath {
 			traversalPath = append(traversalPath, struct {
 				*node.ModelNode
 				int
 			}{currentModelNode, bucketID})
 		}
+		bucketIDPredictionRounded := float64(int(bucketIDPrediction + 0.5))
+		tolerance := 10 * epsilon * math.Abs(bucketIDPrediction)
+		ambiguous = ambiguous || math.Abs(bucketIDPrediction-bucketIDPredictionRounded) <= tolerance ||
+			bucketIDPrediction < 0 || bucketIDPrediction >= float64(currentModelNode.NumChildren)
 
 		currentNode = currentModelNode.Children[bucketID]
 
 		if currentNode.IsLeaf() {
 			currentDataNode := currentNode.(*node.DataNode)
 			self.numNodeLookups += int64(currentDataNode.GetLevel())
-			bucketIDPredictionRounded := float64(int(bucketIDPrediction + 0.5))
-			epsilon := math.Nextafter(1.0, 2.0) - 1.0 // https://stackoverflow.com/questions/22185636/easiest-way-to-get-the-machine-epsilon-in-go
-			tolerance := 10 * epsilon * bucketIDPrediction
-			if math.Abs(bucketIDPrediction-bucketIDPredictionRounded) <= tolerance {
-				if bucketIDPredictionRounded <= bucketIDPrediction {
-					if prevLeaf := currentDataNode.PrevLeaf; prevLeaf != nil {
-						if prevLeaf.GetLastKey() >= key {
-							if buildTraversalPath {
-								self.correctTraversalPath(currentDataNode, &traversalPath, true)
-							}
-							return prevLeaf, traversalPath
-						}
-					}
+			if !ambiguous {
+				return currentDataNode, traversalPath, nil
+			}
+			leaf, err := self.correctLeaf(key, currentDataNode, &traversalPath, buildTraversalPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			return leaf, traversalPath, nil
+		}
+	}
+}
+
+// Moves from the predicted leaf to the leaf that holds key in the order of the keys. Rounding errors of float64
+// predictions, which grow with the bucket IDs, may route keys next to a bucket boundary to a neighbour of their
+// leaf, or further away past empty leaves.
+func (self *Index) correctLeaf(key shared.KeyType, leaf *node.DataNode, traversalPath *[]struct {
+	*node.ModelNode
+	int
+}, buildTraversalPath bool) (*node.DataNode, error) {
+	for _, left := range []bool{true, false} {
+		moved := false
+		for {
+			// Closest non-empty leaf on that side
+			neighbour := leaf
+			for {
+				if left {
+					neighbour = neighbour.PrevLeaf
 				} else {
-					if nextLeaf := currentDataNode.NextLeaf; nextLeaf != nil {
-						if nextLeaf.GetFirstKey() <= key {
-							if buildTraversalPath {
-								self.correctTraversalPath(currentDataNode, &traversalPath, false)
-							}
-							return nextLeaf, traversalPath
-						}
+					neighbour = neighbour.NextLeaf
+				}
+				if neighbour == nil || neighbour.NumKeys > 0 {
+					break
+				}
+			}
+			if neighbour == nil || (left && neighbour.GetLastKey() < key) || (!left && neighbour.GetFirstKey() > key) {
+				break
+			}
+			for leaf != neighbour {
+				if buildTraversalPath {
+					if err := self.correctTraversalPath(leaf, traversalPath, left); err != nil {
+						return nil, err
 					}
 				}
+				if left {
+					leaf = leaf.PrevLeaf
+				} else {
+					leaf = leaf.NextLeaf
+				}
 			}
-			return currentDataNode, traversalPath
+			self.traversalCorrected = true
+			moved = true
+		}
+		if moved {
+			break
 		}
 	}
+	return leaf, nil
 }
 
 func (self *Index) shouldExpandRight() bool {
 	isNotLeaf := !self.rootNode.IsLeaf()
 	c1 := self.numKeysAboveKeyDomain >= shared.KMinOutOfDomainKeys
-	toleranceFactorCondition := float64(self.numKeys)/float64(self.numKeysAtLastRightDomainResize) - 1
+	toleranceFactorCondition := float64(self.numKeys)/float64(max(self.numKeysAtLastRightDomainResize, 1)) - 1
 	c2 := float64(self.numKeysAboveKeyDomain) >= float64(shared.KOutOfDomainToleranceFactor)*toleranceFactorCondition
 	c3 := self.numKeysAboveKeyDomain >= shared.KMaxOutOfDomainKeys
 	c1c2 := c1 && c2
@@ -274,7 +409,7 @@ func (self *Index) shouldExpandRight() bool {
 func (self *Index) shouldExpandLeft() bool {
 	isNotLeaf := !self.rootNode.IsLeaf()
 	c1 := self.numKeysBelowKeyDomain >= shared.KMinOutOfDomainKeys
-	toleranceFactorCondition := float64(self.numKeys)/float64(self.numKeysAtLastLeftDomainResize) - 1
+	toleranceFactorCondition := float64(self.numKeys)/float64(max(self.numKeysAtLastLeftDomainResize, 1)) - 1
 	c2 := float64(self.numKeysBelowKeyDomain) >= float64(shared.KOutOfDomainToleranceFactor)*toleranceFactorCondition
 	c3 := self.numKeysBelowKeyDomain >= shared.KMaxOutOfDomainKeys
 	c1c2 := c1 && c2
@@ -286,7 +421,8 @@ func (self *Index) updateSuperRootNodePointer() {
 	self.superRootNode.SetLevel(self.rootNode.GetLevel() - 1)
 }
 
-// Caller needs to set the level, duplication factor, and neighbor pointers of the returned data node
+// Caller needs to set the level, duplication factor, and neighbor pointers of the returned data node, and to count
+// it in numDataNodes once it is part of the index
 func (self *Index) bulkLoadLeafNodeFromExisting(
 	existingNode *node.DataNode,
 	left int,
@@ -296,14 +432,14 @@ func (self *Index) bulkLoadLeafNodeFromExisting(
 	reuseModel bool,
 	keepLeft bool,
 	keepRight bool,
-) *node.DataNode {
+) (*node.DataNode, error) {
 	node := node.NewDataNode(1)
-	self.numDataNodes++
+	var err error
 	if treeNode != nil {
 		// Use the model and num_keys saved in the tree node so we don't have to
 		// recompute it
 		preComputedModel := linear_model.NewLinearModel(treeNode.A, treeNode.B)
-		node.BulkLoadFromExisting(
+		err = node.BulkLoadFromExisting(
 			existingNode,
 			left,
 			right,
@@ -319,7 +455,7 @@ func (self *Index) bulkLoadLeafNodeFromExisting(
 		preComputedModel := linear_model.CopyLinearModel(existingNode.GetLinearModel())
 		preComputedModel.B -= float64(left)
 		preComputedModel.Expand(float64(numActualKeys) / float64(right-left))
-		node.BulkLoadFromExisting(
+		err = node.BulkLoadFromExisting(
 			existingNode,
 			left,
 			right,
@@ -330,7 +466,7 @@ func (self *Index) bulkLoadLeafNodeFromExisting(
 		)
 	} else {
 		// Train a new model
-		node.BulkLoadFromExisting(
+		err = node.BulkLoadFromExisting(
 			existingNode,
 			left,
 			right,
@@ -340,243 +476,344 @@ func (self *Index) bulkLoadLeafNodeFromExisting(
 			-1,
 		)
 	}
+	if err != nil {
+		return nil, err
+	}
 	node.MaxSlots = self.maxDataNodeSlots
+	node.CostModel = self.costModel
+	node.IncrementalResizeChunk = self.incrementalResizeChunk
+	node.SearchStrategy = self.searchStrategy
+	node.Layout = self.dataNodeLayout
+	node.Workload = existingNode.Workload
 
 	if computeCost {
-		node.Cost = node.ComputeExpectedCost(existingNode.FracInserts())
+		node.Cost = node.ComputeExpectedCost(existingNode.Workload.InsertFrac(self.insertFracEstimate()))
 	}
 
-	return node
+	return node, nil
 }
 
-// Expand the key value space that is covered by the index.
+// Expand the key value space that is covered by the index, until it covers key or reaches the bounds of KeyType.
 // Expands the root node (which is a model node).
-// If the root node is at the max node size, then we split the root and create
-// a new root node.
-func (self *Index) expandRoot(key shared.KeyType, expandLeft bool) {
+// If the root node is at the max node size, then we create a new root node above it. A new root has at most
+// KMaxRootExpansionFactor children, so keys far from the key domain expand it over several levels.
+// Every step leaves the index consistent, a failure leaves the expansions of the previous steps in place.
+func (self *Index) expandRoot(key shared.KeyType, expandLeft bool) error {
+	for {
+		covered, err := self.expandRootOnce(key, expandLeft)
+		if err != nil || covered {
+			return err
+		}
+	}
+}
+
+// Multiplies the key domain by a power of 2, on its left or right side.
+// The new child pointers of the root are divided between one new data node per power of 2, each twice as wide as
+// the previous one, so that the number of new data nodes only grows with the logarithm of the expansion.
+// Returns whether the key domain covers key after the expansion.
+func (self *Index) expandRootOnce(key shared.KeyType, expandLeft bool) (bool, error) {
 	root := self.rootNode.(*node.ModelNode)
 
 	// Find the new bounds of the key domain.
-	// Need to be careful to avoid overflows in the key type.
-	var expansionFactor int
+	// Sizes are computed in uint64, which holds the difference of any two keys, to avoid overflows in the key type.
+	domainSize := uint64(self.keyDomainMax) - uint64(self.keyDomainMin)
+	var keyDifference, expandableDomainSize uint64
 	var outermostNode *node.DataNode
-	newDomainMin, newDomainMax := self.keyDomainMin, self.keyDomainMax
-	domainSize := newDomainMax - newDomainMin
 	if expandLeft {
-		keyDifference := self.keyDomainMin - min(key, self.GetMinKey())
-		expansionFactor = shared.Pow2RoundUp((keyDifference+domainSize-1)/domainSize + 1)
+		keyDifference = uint64(self.keyDomainMin) - uint64(min(key, self.minKey(), self.keyDomainMin))
+		// MinKey is MaxKey + 1 once converted
+		expandableDomainSize = uint64(self.keyDomainMax) - uint64(shared.MaxKey) - 1
+		outermostNode = self.firstDataNode()
+	} else {
+		keyDifference = uint64(max(key, self.maxKey(), self.keyDomainMax)) - uint64(self.keyDomainMax)
+		expandableDomainSize = uint64(shared.MaxKey) - uint64(self.keyDomainMin)
+		outermostNode = self.lastDataNode()
+	}
+	if keyDifference == 0 {
+		return true, nil
+	}
+	// Number of key domains of the current size needed to cover key, and to cover every key of the key type
+	required := (keyDifference-1)/domainSize + 2
+	expandable := (expandableDomainSize-1)/domainSize + 1
+	expansionFactor := shared.Pow2RoundUp(int(min(required, expandable, 1<<62)))
+	expandInPlace := expansionFactor <= self.maxFanout/root.NumChildren
+	if !expandInPlace {
+		expansionFactor = min(expansionFactor, shared.KMaxRootExpansionFactor)
+	}
 
-		halfExpandableDomain := self.keyDomainMax/2 - shared.MinKey/2
-		halfExpandableDomainSize := shared.KeyType(expansionFactor) / 2 * domainSize
-		if halfExpandableDomainSize < halfExpandableDomain {
-			newDomainMin = shared.MinKey
-		} else {
-			newDomainMin = self.keyDomainMax
-			newDomainMin -= 2 * halfExpandableDomainSize
+	// The new data nodes only divide the new child pointers evenly if the expansion factor is a power of 2
+	if expansionFactor <= 1 || expansionFactor&(expansionFactor-1) != 0 {
+		return false, fmt.Errorf("%w: expanding the root by a factor of %d", shared.InvalidExpansionFactorError, expansionFactor)
+	}
+	saturated := uint64(expansionFactor) > expandableDomainSize/domainSize
+	newDomainMin, newDomainMax := self.keyDomainMin, self.keyDomainMax
+	if expandLeft {
+		newDomainMin = shared.MinKey
+		if !saturated {
+			newDomainMin = shared.KeyType(uint64(self.keyDomainMax) - uint64(expansionFactor)*domainSize)
 		}
-		self.numKeysAtLastLeftDomainResize = self.numKeys
-		self.numKeysAboveKeyDomain = 0
-		outermostNode = self.FirstDataNode()
 	} else {
-		keyDifference := max(key, self.GetMaxKey()) - self.keyDomainMax
-		expansionFactor = shared.Pow2RoundUp((keyDifference+domainSize-1)/domainSize + 1)
+		newDomainMax = shared.MaxKey
+		if !saturated {
+			newDomainMax = shared.KeyType(uint64(self.keyDomainMin) + uint64(expansionFactor)*domainSize)
+		}
+	}
+	outermostNode.FinishResize()
+
+	// Work out the model of the root after the expansion, and n, the number of pointers covering one key domain
+	// of the current size
+	newModel := root.LinearModel
+	var newNumChildren, n int
+	if expandInPlace {
+		newNumChildren = root.NumChildren * expansionFactor
+		n = root.NumChildren
+		if expandLeft {
+			newModel.B += float64(newNumChildren - root.NumChildren)
+		}
+	} else {
+		newNumChildren = expansionFactor
+		n = 1
+		newModel.A = root.LinearModel.A / float64(root.NumChildren)
+		newModel.B = root.LinearModel.B / float64(root.NumChildren)
+		if expandLeft {
+			newModel.B += float64(expansionFactor - 1)
+		}
+	}
 
-		halfExpandableDomain := shared.MaxKey/2 - self.keyDomainMin/2
-		halfExpandableDomainSize := shared.KeyType(expansionFactor) / 2 * domainSize
-		if halfExpandableDomainSize < halfExpandableDomain {
-			newDomainMax = shared.MaxKey
-		} else {
-			newDomainMax = self.keyDomainMin
-			newDomainMax += 2 * halfExpandableDomainSize
+	// The i-th new data node covers the key domains [2^i, 2^(i+1)) away from the current one, returns the
+	// first key of the key domain 2^i away and the first child pointer routing to it, or false if the key domain
+	// is past the bounds of the key type.
+	// On the left, the first key is the one after the key domain, as the data node ends there.
+	boundary := func(i int) (shared.KeyType, int, bool) {
+		distance := uint64(1) << i
+		if distance > expandableDomainSize/domainSize {
+			return 0, 0, false
 		}
-		self.numKeysAtLastRightDomainResize = self.numKeys
-		self.numKeysBelowKeyDomain = 0
-		outermostNode = self.LastDataNode()
+		if expandLeft {
+			return shared.KeyType(uint64(self.keyDomainMax) - distance*domainSize), (expansionFactor - int(distance)) * n, true
+		}
+		return shared.KeyType(uint64(self.keyDomainMin) + distance*domainSize), int(distance) * n, true
 	}
 
-	if expansionFactor <= 1 {
-		panic("Expansion factor must be greater than 1")
+	// Build the data nodes for the newly created child pointers of the root before modifying the index, so that a
+	// failure leaves it unchanged.
+	// Requires reassigning some keys from the outermost pre-existing data node to the new data nodes, along with the
+	// stray keys of the data nodes next to it, which are read from a copy of the outermost node. Boundaries are
+	// aligned with the buckets the new root model routes keys to.
+	_, bucketID, _ := boundary(0)
+	strayRanges, strayKeys, strayPayloads := findStrayKeys(outermostNode, &newModel, bucketID, expandLeft)
+	source, err := withStrayKeys(outermostNode, strayKeys, strayPayloads)
+	if err != nil {
+		return false, err
+	}
+	numNewNodes := shared.Log2RoundDown(expansionFactor)
+	// Ordered from the outermost pre-existing data node outwards
+	newNodes := make([]*node.DataNode, 0, numNewNodes)
+	// Position of the outermost node that separates the keys it keeps from the keys it hands to the new nodes
+	boundaryValue, _, _ := boundary(0)
+	handoverBoundary, _ := alignBoundary(source, &newModel, source.LowerBound(boundaryValue), bucketID)
+	innerBoundary := handoverBoundary
+	for i := 0; i < numNewNodes; i++ {
+		outerBoundary := source.DataCapacity
+		if expandLeft {
+			outerBoundary = 0
+		}
+		if boundaryValue, bucketID, ok := boundary(i + 1); ok && i+1 < numNewNodes {
+			outerBoundary, _ = alignBoundary(source, &newModel, source.LowerBound(boundaryValue), bucketID)
+		}
+		left, right := innerBoundary, outerBoundary
+		if expandLeft {
+			left, right = outerBoundary, innerBoundary
+		}
+		newNode, err := self.bulkLoadLeafNodeFromExisting(source, left, right, true, nil, false, false, false)
+		if err != nil {
+			return false, err
+		}
+		newNodes = append(newNodes, newNode)
+		innerBoundary = outerBoundary
+	}
+
+	self.subtreeCountsStale = true
+	self.footprintStale = true
+	if expandLeft {
+		self.numKeysAtLastLeftDomainResize = self.numKeys
+		self.numKeysBelowKeyDomain = 0
+	} else {
+		self.numKeysAtLastRightDomainResize = self.numKeys
+		self.numKeysAboveKeyDomain = 0
 	}
 
 	// Modify the root node appropriately
-	// index of first pointer to a new node, and index of last pointer to a new node (exclusive)
-	var newNodesStart, newNodesEnd int
-	if root.NumChildren*expansionFactor <= self.maxFanout {
+	if expandInPlace {
 		self.numModelNodeExpansions++
 		self.numModelNodeExpansionPointers += int64(root.NumChildren)
 
-		newNumChildren := root.NumChildren * expansionFactor
 		newChildren := make([]node.Node, newNumChildren)
-		var copyStart int
-
+		copyStart := 0
 		if expandLeft {
 			copyStart = newNumChildren - root.NumChildren
-			newNodesStart = 0
-			newNodesEnd = copyStart
-			root.GetLinearModel().B += float64(newNumChildren - root.NumChildren)
-		} else {
-			copyStart = 0
-			newNodesStart = root.NumChildren
-			newNodesEnd = newNumChildren
-		}
-
-		for i := 0; i < root.NumChildren; i++ {
-			newChildren[copyStart+i] = root.Children[i]
 		}
+		copy(newChildren[copyStart:copyStart+root.NumChildren], root.Children[:root.NumChildren])
 
 		root.Children = newChildren
 		root.NumChildren = newNumChildren
+		root.LinearModel = newModel
 	} else {
 		newRoot := node.NewModelNode(root.GetLevel() - 1)
-		newRoot.GetLinearModel().A = root.GetLinearModel().A / float64(root.NumChildren)
-		newRoot.GetLinearModel().B = root.GetLinearModel().B / float64(root.NumChildren)
-
-		if expandLeft {
-			newRoot.GetLinearModel().B += float64(expansionFactor - 1)
-		}
-
+		newRoot.LinearModel = newModel
 		newRoot.NumChildren = expansionFactor
-
-		newRootChildren := make([]node.Node, expansionFactor)
+		newRoot.Children = make([]node.Node, expansionFactor)
 		if expandLeft {
-			newRootChildren[expansionFactor-1] = root
-			newNodesStart = 0
+			newRoot.Children[expansionFactor-1] = root
 		} else {
-			newRootChildren[0] = root
-			newNodesStart = 1
+			newRoot.Children[0] = root
 		}
-		newRoot.Children = newRootChildren
-
-		newNodesEnd = newNodesStart + expansionFactor - 1
+		self.numModelNodes++
 		self.rootNode = newRoot
 		self.updateSuperRootNodePointer()
 		root = newRoot
 	}
 
-	// Determine if new nodes represent a range outside the key type's domain.
-	// This happens when we're preventing overflows.
-	inBoundsNewNodesStart, inBoundsNewNodesEnd := newNodesStart, newNodesEnd
-	if expandLeft {
-		inBoundsNewNodesStart = max(newNodesStart, self.rootNode.GetLinearModel().Predict(float64(newDomainMin)))
-	} else {
-		inBoundsNewNodesEnd = min(newNodesEnd, self.rootNode.GetLinearModel().Predict(float64(newDomainMax))+1)
+	// Point the new child pointers to the new data nodes and link them
+	self.numDataNodes += len(newNodes)
+	neighbour := outermostNode
+	for i, newNode := range newNodes {
+		numPointers := (1 << i) * n
+		newNode.Level = root.Level + 1
+		newNode.DuplicationFactor = shared.Log2RoundDown(numPointers)
+		firstPointer := numPointers
+		if expandLeft {
+			firstPointer = (expansionFactor - 2<<i) * n
+		}
+		for j := firstPointer; j < firstPointer+numPointers; j++ {
+			root.Children[j] = newNode
+		}
+		if expandLeft {
+			neighbour.PrevLeaf = newNode
+			newNode.NextLeaf = neighbour
+		} else {
+			neighbour.NextLeaf = newNode
+			newNode.PrevLeaf = neighbour
+		}
+		neighbour = newNode
 	}
-
-	// Fill newly created child pointers of the root node with new data nodes.
-	// To minimize empty new data nodes, we create a new data node per n child
-	// pointers, where n is the number of pointers to existing nodes.
-	// Requires reassigning some keys from the outermost pre-existing data node
-	// to the new data nodes.
-	n := root.NumChildren - (newNodesEnd - newNodesStart)
-	if root.NumChildren%n != 0 {
-		panic("Root node's number of children must be a multiple of n")
+	// The counts are recomputed by the next aggregate query, only their array is sized now so that the footprint
+	// accounts for it
+	root.RebuildChildCounts()
+
+	// Remove the stray keys from the data nodes next to the outermost pre-existing node, and the reassigned keys from
+	// the outermost node. The stray keys are all reassigned, as predictions do not decrease with the keys
+	for _, strayRange := range strayRanges {
+		strayRange.leaf.EraseRange(strayRange.from, strayRange.to, true)
 	}
-	newNodeDuplicationFactor := shared.Log2RoundDown(n)
-
+	firstAfterHandover := source.GetNextFilledPosition(handoverBoundary, false)
 	if expandLeft {
-		leftBoundaryValue := self.keyDomainMin
-		leftBoundary := outermostNode.LowerBound(leftBoundaryValue)
-		next := outermostNode
-		for i := newNodesEnd; i > newNodesStart; i -= n {
-			rightBoundary := leftBoundary
-			if i-n <= inBoundsNewNodesStart {
-				leftBoundary = 0
-			} else {
-				leftBoundaryValue -= domainSize
-				leftBoundary = outermostNode.LowerBound(leftBoundaryValue)
-			}
-			newNode := self.bulkLoadLeafNodeFromExisting(
-				outermostNode,
-				leftBoundary,
-				rightBoundary,
-				true,
-				nil,
-				false,
-				false,
-				false,
-			)
-			newNode.Level = root.Level + 1
-			newNode.DuplicationFactor = newNodeDuplicationFactor
-
-			if next != nil {
-				next.PrevLeaf = newNode
-			}
-
-			newNode.NextLeaf = next
-			next = newNode
-
-			for j := i - 1; j >= i-n; j-- {
-				root.Children[j] = newNode
-			}
+		if firstAfterHandover < source.DataCapacity {
+			outermostNode.EraseRange(shared.MinKey, source.KeyAt(firstAfterHandover), false)
+		} else {
+			outermostNode.EraseRange(shared.MinKey, shared.MaxKey, true)
 		}
-	} else {
-		rightBoundaryValue := self.keyDomainMax
-		rightBoundary := outermostNode.LowerBound(rightBoundaryValue)
-		var prev *node.DataNode = nil
-		for i := newNodesStart; i < newNodesEnd; i += n {
-			leftBoundary := rightBoundary
-			if i+n >= inBoundsNewNodesEnd {
-				rightBoundary = outermostNode.DataCapacity
-			} else {
-				rightBoundaryValue += domainSize
-				rightBoundary = outermostNode.LowerBound(rightBoundaryValue)
-			}
-			newNode := self.bulkLoadLeafNodeFromExisting(
-				outermostNode,
-				leftBoundary,
-				rightBoundary,
-				true,
-				nil,
-				false,
-				false,
-				false,
-			)
-			newNode.Level = root.Level + 1
-			newNode.DuplicationFactor = newNodeDuplicationFactor
-
-			if prev != nil {
-				prev.NextLeaf = newNode
-			}
+	} else if firstAfterHandover < source.DataCapacity {
+		outermostNode.EraseRange(source.KeyAt(firstAfterHandover), shared.MaxKey, true)
+	}
+	self.keyDomainMin = newDomainMin
+	self.keyDomainMax = newDomainMax
+	return uint64(expansionFactor) >= required || saturated, nil
+}
 
-			newNode.PrevLeaf = prev
-			prev = newNode
+// Keys in [from, to] of a data node next to the outermost data node of a root expansion, which move to the new data
+// nodes
+type strayRange struct {
+	leaf     *node.DataNode
+	from, to shared.KeyType
+}
 
-			for j := i; j < i+n; j++ {
-				root.Children[j] = newNode
+// Finds the keys of the other data nodes that model routes to the new child pointers of the root, from bucketID on
+// the right or before it on the left, with their payloads and the ranges of the data nodes holding them. float64
+// predictions cannot tell apart the keys next to a bound of a wide key domain, so some keys of the key domain may
+// be predicted past it.
+// Does not modify the index.
+func findStrayKeys(outermostNode *node.DataNode, model *linear_model.LinearModel, bucketID int, expandLeft bool) ([]strayRange, []shared.KeyType, []shared.PayloadType) {
+	stray := func(key shared.KeyType) bool {
+		return (model.Predict(float64(key)) < bucketID) == expandLeft
+	}
+	ranges := make([]strayRange, 0)
+	keys := make([]shared.KeyType, 0)
+	payloads := make([]shared.PayloadType, 0)
+	for leaf := outermostNode; ; {
+		if expandLeft {
+			leaf = leaf.NextLeaf
+		} else {
+			leaf = leaf.PrevLeaf
+		}
+		if leaf == nil {
+			break
+		}
+		if leaf.NumKeys == 0 {
+			continue
+		}
+		if expandLeft && !stray(leaf.GetFirstKey()) || !expandLeft && !stray(leaf.GetLastKey()) {
+			break
+		}
+		strayKeys := strayRange{leaf: leaf, from: shared.MaxKey, to: shared.MinKey}
+		leaf.IterateFilledPositions(func(key shared.KeyType, payload shared.PayloadType, _ int, _ int) {
+			if stray(key) {
+				keys = append(keys, key)
+				payloads = append(payloads, payload)
+				strayKeys.from, strayKeys.to = min(strayKeys.from, key), max(strayKeys.to, key)
 			}
+		}, 0, leaf.DataCapacity)
+		ranges = append(ranges, strayKeys)
+		// The inner keys of this data node stay, the data nodes past it only hold keys that stay as well
+		if expandLeft && !stray(leaf.GetLastKey()) || !expandLeft && !stray(leaf.GetFirstKey()) {
+			break
 		}
 	}
+	return ranges, keys, payloads
+}
 
-	// Connect leaf nodes and remove reassigned keys from outermost pre-existing
-	// node.
-	if expandLeft {
-		outermostNode.EraseRange(newDomainMin, self.keyDomainMin, false)
-		lastNewLeaf := root.Children[newNodesEnd-1].(*node.DataNode)
-		outermostNode.PrevLeaf = lastNewLeaf
-		lastNewLeaf.NextLeaf = outermostNode
-	} else {
-		outermostNode.EraseRange(self.keyDomainMax, newDomainMax, true)
-		firstNewLeaf := root.Children[newNodesStart].(*node.DataNode)
-		outermostNode.NextLeaf = firstNewLeaf
-		firstNewLeaf.PrevLeaf = outermostNode
+// Returns outermostNode if there are no stray keys, or else a copy of it holding the stray keys as well, which the
+// new data nodes of a root expansion are built from.
+// Fails without modifying the index if the copy cannot hold them.
+func withStrayKeys(outermostNode *node.DataNode, keys []shared.KeyType, payloads []shared.PayloadType) (*node.DataNode, error) {
+	if len(keys) == 0 {
+		return outermostNode, nil
 	}
-	self.keyDomainMin = newDomainMin
-	self.keyDomainMax = newDomainMax
+	source := outermostNode.Clone()
+	if !source.ReserveCapacity(len(keys)) {
+		return nil, fmt.Errorf("%w: the outermost data node cannot take the %d keys routed past the key domain", shared.MaxCapacityInsertionError, len(keys))
+	}
+	for i, key := range keys {
+		if _, err := source.InsertInPlace(key, payloads[i]); err != nil {
+			return nil, err
+		}
+	}
+	return source, nil
 }
 
-func (self *Index) updateSuperRootKeyDomain() {
+func (self *Index) updateSuperRootKeyDomain() error {
 	if !(self.numInserts == 0 || self.rootNode.IsLeaf()) {
-		panic("Root node must be a leaf node if there are no inserts")
+		return fmt.Errorf("%w: the key domain can only be reset while the root node is a data node", shared.InvalidRootNodeError)
 	}
 
-	self.keyDomainMin = self.GetMinKey()
-	self.keyDomainMax = self.GetMaxKey()
+	self.keyDomainMin = self.minKey()
+	self.keyDomainMax = self.maxKey()
+	// The key domain is never empty, even if every key is the same
+	if self.keyDomainMax == self.keyDomainMin {
+		if self.keyDomainMax < shared.MaxKey {
+			self.keyDomainMax++
+		} else {
+			self.keyDomainMin--
+		}
+	}
 	self.numKeysAtLastRightDomainResize = self.numKeys
 	self.numKeysAtLastLeftDomainResize = self.numKeys
 	self.numKeysAboveKeyDomain = 0
 	self.numKeysBelowKeyDomain = 0
-	self.superRootNode.GetLinearModel().A = 1.0 / float64(self.keyDomainMax-self.keyDomainMin)
+	// Converting the bounds first avoids overflowing the key type when the key domain spans more than half of it
+	self.superRootNode.GetLinearModel().A = 1.0 / (float64(self.keyDomainMax) - float64(self.keyDomainMin))
 	self.superRootNode.GetLinearModel().B = -float64(self.keyDomainMin) * self.superRootNode.GetLinearModel().A
+	return nil
 }
 
 func (self *Index) linkDataNodes(
@@ -599,15 +836,45 @@ func (self *Index) linkDataNodes(
 	}
 }
 
+// Moves boundary, a position in oldNode, so that the keys before it are exactly the keys that model routes to a
+// bucket before bucketID. Boundaries computed by inverting the model can be off in both directions, as float64
+// cannot tell large keys apart.
+// Returns the new boundary and the number of keys moved to the left of the boundary, negative if it moved keys
+// to the right of it
+func alignBoundary(oldNode *node.DataNode, model *linear_model.LinearModel, boundary int, bucketID int) (int, int) {
+	numMovedKeys := 0
+	for {
+		// Gaps hold the next key, and trailing gaps KEndSentinel which may also be a key
+		next := oldNode.GetNextFilledPosition(boundary, false)
+		if next >= oldNode.DataCapacity || model.Predict(float64(oldNode.KeyAt(next))) >= bucketID {
+			break
+		}
+		numMovedKeys++
+		boundary = next + 1
+	}
+	for boundary > 0 {
+		previous := boundary - 1
+		for previous >= 0 && !oldNode.Bitmap.Contains(uint32(previous)) {
+			previous--
+		}
+		if previous < 0 || model.Predict(float64(oldNode.KeyAt(previous))) < bucketID {
+			break
+		}
+		numMovedKeys--
+		boundary = previous
+	}
+	return boundary, numMovedKeys
+}
+
 func (self *Index) createTwoNewDataNodes(
 	oldNode *node.DataNode,
 	parentNode *node.ModelNode,
 	duplicationFactor int,
 	reuseModel bool,
 	startBucketID int,
-) {
+) error {
 	if duplicationFactor < 1 {
-		panic("Duplication factor must be at least 1")
+		return fmt.Errorf("%w: splitting a data node in two requires a duplication factor of at least 1, got %d", shared.InvalidDuplicationFactorError, duplicationFactor)
 	}
 
 	numBuckets := int(1 << duplicationFactor)
@@ -621,17 +888,9 @@ func (self *Index) createTwoNewDataNodes(
 	appendingLeftBucketID := min(max(parentNode.LinearModel.Predict(float64(oldNode.MinKey)), 0), parentNode.NumChildren-1)
 
 	rightBoundary := oldNode.LowerBound(shared.KeyType((float64(midBucketID) - parentNode.LinearModel.B) / parentNode.LinearModel.A))
+	rightBoundary, _ = alignBoundary(oldNode, &parentNode.LinearModel, rightBoundary, midBucketID)
 
-	for rightBoundary < oldNode.DataCapacity &&
-		oldNode.Keys[rightBoundary] != shared.KEndSentinel &&
-		parentNode.LinearModel.Predict(float64(oldNode.Keys[rightBoundary])) < midBucketID {
-		rightBoundary = min(
-			oldNode.GetNextFilledPosition(rightBoundary, false)+1,
-			oldNode.DataCapacity,
-		)
-	}
-
-	leftLeaf := self.bulkLoadLeafNodeFromExisting(
+	leftLeaf, err := self.bulkLoadLeafNodeFromExisting(
 		oldNode,
 		0,
 		rightBoundary,
@@ -642,7 +901,10 @@ func (self *Index) createTwoNewDataNodes(
 		appendMostlyLeft && startBucketID <= appendingLeftBucketID && appendingLeftBucketID < midBucketID,
 	)
 
-	rightLeaf := self.bulkLoadLeafNodeFromExisting(
+	if err != nil {
+		return err
+	}
+	rightLeaf, err := self.bulkLoadLeafNodeFromExisting(
 		oldNode,
 		rightBoundary,
 		oldNode.DataCapacity,
@@ -652,6 +914,10 @@ func (self *Index) createTwoNewDataNodes(
 		appendMostlyRight && midBucketID <= appendingRightBucketID && appendingRightBucketID < endBucketID,
 		appendMostlyLeft && midBucketID <= appendingLeftBucketID && appendingLeftBucketID < endBucketID,
 	)
+	if err != nil {
+		return err
+	}
+	self.numDataNodes += 2
 
 	leftLeaf.Level = parentNode.Level + 1
 	rightLeaf.Level = parentNode.Level + 1
@@ -666,8 +932,11 @@ func (self *Index) createTwoNewDataNodes(
 	for i := midBucketID; i < endBucketID; i++ {
 		parentNode.Children[i] = rightLeaf
 	}
+	parentNode.RecountChildKeys(startBucketID, endBucketID)
+	self.footprint += leftLeaf.GetNodeSize() + rightLeaf.GetNodeSize()
 
 	self.linkDataNodes(oldNode, leftLeaf, rightLeaf)
+	return nil
 }
 
 func (self *Index) createNewDataNodes(
@@ -677,18 +946,18 @@ func (self *Index) createNewDataNodes(
 	usedFanoutTree *[]*fanout_tree.FTNode,
 	startBucketID int,
 	extraDuplicationFactor int,
-) {
+) error {
 	appendMostlyRight := oldNode.IsAppendMostlyRight()
 	appendingRightBucketID := min(max(parentNode.LinearModel.Predict(float64(oldNode.MaxKey)), 0), parentNode.NumChildren-1)
 
 	appendMostlyLeft := oldNode.IsAppendMostlyLeft()
 	appendingLeftBucketID := min(max(parentNode.LinearModel.Predict(float64(oldNode.MinKey)), 0), parentNode.NumChildren-1)
 
-	// Create the new data nodes
+	// Create the new data nodes, they are only put into the index once all of them are built
 	currentBucketID := startBucketID // first bucket with same child
-	prevLeaf := oldNode.PrevLeaf     // used for linking the new data nodes
 	leftBoundary := 0
 	rightBoundary := 0
+	childNodes := make([]*node.DataNode, 0, len(*usedFanoutTree))
 
 	// Keys may be re-assigned to an adjacent fanout tree node due to off-by-one errors
 	numReassignedKeys := 0
@@ -701,19 +970,14 @@ func (self *Index) createNewDataNodes(
 		rightBoundary = (*usedFanoutTree)[treeNode].RightBoundary
 
 		// Account for off-by-one errors due to floating-point precision issues.
+		// The last node also takes the keys predicted past the buckets of the split
 		(*usedFanoutTree)[treeNode].NumKeys -= numReassignedKeys
 		numReassignedKeys = 0
-		for rightBoundary < oldNode.DataCapacity &&
-			oldNode.Keys[rightBoundary] != shared.KEndSentinel &&
-			parentNode.LinearModel.Predict(float64(oldNode.Keys[rightBoundary])) < currentBucketID+childNodeRepeats {
-			numReassignedKeys++
-			rightBoundary = min(
-				oldNode.GetNextFilledPosition(rightBoundary, false)+1,
-				oldNode.DataCapacity,
-			)
+		if treeNode < len(*usedFanoutTree)-1 {
+			rightBoundary, numReassignedKeys = alignBoundary(oldNode, &parentNode.LinearModel, rightBoundary, currentBucketID+childNodeRepeats)
 		}
 		(*usedFanoutTree)[treeNode].NumKeys += numReassignedKeys
-		childNode := self.bulkLoadLeafNodeFromExisting(
+		childNode, err := self.bulkLoadLeafNodeFromExisting(
 			oldNode,
 			leftBoundary,
 			rightBoundary,
@@ -723,28 +987,42 @@ func (self *Index) createNewDataNodes(
 			keepLeft,
 			keepRight,
 		)
+		if err != nil {
+			return err
+		}
 		childNode.Level = parentNode.Level + 1
 		childNode.Cost = (*usedFanoutTree)[treeNode].Cost
 		childNode.DuplicationFactor = duplicationFactor
 		childNode.ExpectedAvgExpSearchIterations = (*usedFanoutTree)[treeNode].ExpectedAvgSearchIterations
 		childNode.ExpectedAvgShifts = (*usedFanoutTree)[treeNode].ExpectedAvgShifts
-		childNode.PrevLeaf = prevLeaf
+		childNodes = append(childNodes, childNode)
+		currentBucketID += childNodeRepeats
+	}
 
+	self.numDataNodes += len(childNodes)
+	currentBucketID = startBucketID
+	prevLeaf := oldNode.PrevLeaf // used for linking the new data nodes
+	for _, childNode := range childNodes {
+		childNode.PrevLeaf = prevLeaf
 		if prevLeaf != nil {
 			prevLeaf.NextLeaf = childNode
 		}
 
+		childNodeRepeats := 1 << childNode.DuplicationFactor
 		for i := currentBucketID; i < currentBucketID+childNodeRepeats; i++ {
 			parentNode.Children[i] = childNode
 		}
 
 		currentBucketID += childNodeRepeats
 		prevLeaf = childNode
+		self.footprint += childNode.GetNodeSize()
 	}
+	parentNode.RecountChildKeys(startBucketID, currentBucketID)
 	prevLeaf.NextLeaf = oldNode.NextLeaf
 	if oldNode.NextLeaf != nil {
 		oldNode.NextLeaf.PrevLeaf = prevLeaf
 	}
+	return nil
 }
 
 func (self *Index) splitDownwards(
@@ -756,15 +1034,17 @@ func (self *Index) splitDownwards(
 	fanoutTreeDepth int,
 	usedFanoutTree *[]*fanout_tree.FTNode,
 	reuseModel bool,
-) *node.ModelNode {
+) (*node.ModelNode, error) {
 	leaf := parentNode.Children[bucketID].(*node.DataNode)
-	self.numDownwardSplits++
-	self.numDownwardSplitKeys += int64(leaf.NumKeys)
+	if len(*usedFanoutTree) == 0 && fanoutTreeDepth != 1 {
+		return nil, fmt.Errorf("%w: splitting without a fanout tree requires a depth of 1, got %d", shared.InvalidFanoutTreeError, fanoutTreeDepth)
+	}
 
 	// Create the new model node that will replace the current data node
 	fanout := 1 << fanoutTreeDepth
 	newNode := node.NewModelNode(leaf.GetLevel())
 	newNode.DuplicationFactor = leaf.DuplicationFactor
+	newNode.Workload = leaf.Workload
 	newNode.NumChildren = fanout
 	newNode.Children = make([]node.Node, fanout)
 
@@ -784,11 +1064,9 @@ func (self *Index) splitDownwards(
 	}
 
 	// Create new data nodes
+	var err error
 	if len(*usedFanoutTree) == 0 {
-		if fanoutTreeDepth != 1 {
-			panic("Fanout tree depth must be 1")
-		}
-		self.createTwoNewDataNodes(
+		err = self.createTwoNewDataNodes(
 			leaf,
 			newNode,
 			fanoutTreeDepth,
@@ -796,7 +1074,7 @@ func (self *Index) splitDownwards(
 			0,
 		)
 	} else {
-		self.createNewDataNodes(
+		err = self.createNewDataNodes(
 			leaf,
 			newNode,
 			fanoutTreeDepth,
@@ -805,9 +1083,15 @@ func (self *Index) splitDownwards(
 			0,
 		)
 	}
+	if err != nil {
+		return nil, err
+	}
 
+	self.numDownwardSplits++
+	self.numDownwardSplitKeys += int64(leaf.NumKeys)
 	self.numDataNodes--
 	self.numModelNodes++
+	self.footprint += newNode.GetNodeSize() - leaf.GetNodeSize()
 	for i := startBucketID; i < endBucketID; i++ {
 		parentNode.Children[i] = newNode
 	}
@@ -815,7 +1099,7 @@ func (self *Index) splitDownwards(
 		self.rootNode = newNode
 		self.updateSuperRootNodePointer()
 	}
-	return newNode
+	return newNode, nil
 }
 
 // Splits data node sideways in the manner determined by the fanout tree.
@@ -829,31 +1113,36 @@ func (self *Index) splitSideways(
 	fanoutTreeDepth int,
 	usedFanoutTree *[]*fanout_tree.FTNode,
 	reuseModel bool,
-) {
+) error {
 	leaf := parent.Children[bucketID].(*node.DataNode)
-	self.numSidewaysSplits++
-	self.numSidewaysSplitKeys += int64(leaf.NumKeys)
+	if len(*usedFanoutTree) == 0 && fanoutTreeDepth != 1 {
+		return fmt.Errorf("%w: splitting without a fanout tree requires a depth of 1, got %d", shared.InvalidFanoutTreeError, fanoutTreeDepth)
+	}
 
 	fanout := 1 << fanoutTreeDepth
 	repeats := 1 << leaf.DuplicationFactor
 
 	if fanout > repeats {
 		// Expand the pointer array in the parent model node if there are not
-		// enough redundant pointers
+		// enough redundant pointers. The expanded parent routes keys as before, so it stays consistent even if
+		// the split fails
+		parentSize := parent.GetNodeSize()
+		expansionFactor, err := parent.Expand(fanoutTreeDepth - leaf.DuplicationFactor)
+		if err != nil {
+			return err
+		}
+		self.footprint += parent.GetNodeSize() - parentSize
 		self.numModelNodeExpansions++
-		self.numModelNodeExpansionPointers += int64(parent.NumChildren)
-		expansionFactor := parent.Expand(fanoutTreeDepth - leaf.DuplicationFactor)
+		self.numModelNodeExpansionPointers += int64(parent.NumChildren / expansionFactor)
 		repeats *= expansionFactor
 		bucketID *= expansionFactor
 	}
 
 	startBucketID := bucketID - (bucketID % repeats) // first bucket with same child
 
+	var err error
 	if len(*usedFanoutTree) == 0 {
-		if fanoutTreeDepth != 1 {
-			panic("Fanout tree depth must be 1")
-		}
-		self.createTwoNewDataNodes(
+		err = self.createTwoNewDataNodes(
 			leaf,
 			parent.ModelNode,
 			max(fanoutTreeDepth, leaf.DuplicationFactor),
@@ -864,68 +1153,152 @@ func (self *Index) splitSideways(
 		// Extra duplication factor is required when there are more redundant
 		// pointers than necessary
 		extraDuplication := max(0, leaf.DuplicationFactor-fanoutTreeDepth)
-		self.createNewDataNodes(leaf, parent.ModelNode, fanoutTreeDepth, usedFanoutTree, startBucketID, extraDuplication)
+		err = self.createNewDataNodes(leaf, parent.ModelNode, fanoutTreeDepth, usedFanoutTree, startBucketID, extraDuplication)
+	}
+	if err != nil {
+		return err
 	}
+	self.numSidewaysSplits++
+	self.numSidewaysSplitKeys += int64(leaf.NumKeys)
 	self.numDataNodes--
+	self.footprint -= leaf.GetNodeSize()
+	return nil
+}
+
+// Decides how to split the data node at bucketID of parent after its insert failed with err.
+// Returns the depth of the chosen fanout tree, 0 meaning expand and retrain without splitting.
+func (self *Index) selectFanout(
+	parent *node.ModelNode,
+	bucketID int,
+	err error,
+	insertFrac float64,
+	usedFanoutTree *[]*fanout_tree.FTNode,
+) (int, error) {
+	fanoutTreeDepth := 1
+	var fanoutTreeErr error
+	if shared.SplittingPolicyMethod == 0 || (errors.Is(err, shared.MaxCapacityInsertionError) || errors.Is(err, shared.CatastrophicCostInsertionError)) {
+		// always split in 2. No extra work required here
+	} else if shared.SplittingPolicyMethod == shared.DecideBetweenNoSplittingOrSplittingInTwo {
+		// decide between no split (i.e., expand and retrain) or splitting in 2
+		fanoutTreeDepth, fanoutTreeErr = fanout_tree.FindBestFanoutExistingNode(parent, bucketID, self.numKeys, usedFanoutTree, 2, insertFrac, self.costModel)
+	} else if shared.SplittingPolicyMethod == shared.UseFullFanoutTree {
+		// use full fanout tree to decide fanout
+		maxFanout := self.maxFanout
+		if self.memoryPressure {
+			// Under memory pressure, split in two at most
+			maxFanout = 2
+		}
+		fanoutTreeDepth, fanoutTreeErr = fanout_tree.FindBestFanoutExistingNode(parent, bucketID, self.numKeys, usedFanoutTree, maxFanout, insertFrac, self.costModel)
+	}
+	return fanoutTreeDepth, fanoutTreeErr
 }
 
-// Insert will NOT do an update of an existing key.
-// To perform an update or read-modify-write, do a lookup and modify the
-// payload's value.
-// Returns iterator to inserted element, and whether the insert happened or
-// not.
-// Insert does not happen if duplicates are not allowed and duplicate is
-// found.
+// Insert will NOT do an update of an existing key, inserting a key twice stores it twice.
+// To perform an update or read-modify-write, use Update, Upsert or Compute.
 func (self *Index) Insert(key shared.KeyType, payload shared.PayloadType) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.insert(key, payload)
+}
+
+func (self *Index) insert(key shared.KeyType, payload shared.PayloadType) error {
+	if err := self.expandKeyDomain(key); err != nil {
+		return err
+	}
+	self.workload.RecordInsert()
+	leaf, _, _ := self.traverseToLeaf(key, false, insertOperation)
+	return self.insertIntoLeaf(leaf, self.traversedAncestors(), key, payload)
+}
+
+// Expands the key domain of the root if key falls outside of it and enough keys did.
+// The key domain is only set once the root is a model node, a data node root holds every key
+func (self *Index) expandKeyDomain(key shared.KeyType) error {
+	if self.rootNode.IsLeaf() {
+		return nil
+	}
 	if key > self.keyDomainMax {
 		self.numKeysAboveKeyDomain++
-		if self.shouldExpandRight() {
-			self.expandRoot(key, false)
+		if self.shouldExpandRight() && self.domainExpansionFits() && !self.deferDomainExpansion() {
+			return self.expandRoot(key, false)
 		}
 	} else if key < self.keyDomainMin {
 		self.numKeysBelowKeyDomain++
-		if self.shouldExpandLeft() {
-			self.expandRoot(key, true)
+		if self.shouldExpandLeft() && self.domainExpansionFits() && !self.deferDomainExpansion() {
+			return self.expandRoot(key, true)
 		}
 	}
+	return nil
+}
 
-	leaf, _ := self.GetLeaf(key, false)
+// Inserts key into leaf, the data node responsible for it, splitting or retraining the leaf if its cost demands it.
+// ancestors are the model nodes above leaf as returned by traversedAncestors.
+func (self *Index) insertIntoLeaf(leaf *node.DataNode, ancestors []struct {
+	*node.ModelNode
+	int
+}, key shared.KeyType, payload shared.PayloadType) error {
+	if err := self.checkMemoryBudget(leaf); err != nil {
+		return err
+	}
+	leafSize := leaf.GetNodeSize()
 	_, err := leaf.Insert(key, payload)
+	if err != nil && self.deferReorganisation(leaf, err) {
+		// The maintenance goroutine will reorganise the leaf, only expand it for now
+		_, err = leaf.InsertInPlace(key, payload)
+	}
+	self.leafResized(leaf, leafSize)
+	if err == nil {
+		if ancestors == nil {
+			ancestors = self.ancestorsOf(leaf, key)
+		}
+		self.addToSubtreeCounts(ancestors, 1)
+	}
 
 	if errors.Is(err, shared.NoInsertionError) {
 		return err
 	}
 
 	if err != nil {
-		_, traversalPath := self.GetLeaf(key, true)
+		_, traversalPath, pathErr := self.traverseToLeaf(key, true, noOperation)
+		if pathErr != nil {
+			return pathErr
+		}
 		parent := traversalPath[len(traversalPath)-1]
+		insertFrac := self.subtreeInsertFrac(leaf, traversalPath)
 
+		// Set if splitting fails, every split leaves the index consistent but the key is not inserted
+		var splitErr error
 		for err != nil {
 			self.numExpandAndScales += self.numResizes
 
+			// Splits and retrains read the slots of the leaf directly, a retrain of the previous iteration may have
+			// started another resize
+			leafSize = leaf.GetNodeSize()
+			leaf.FinishResize()
+			self.leafResized(leaf, leafSize)
+
 			if parent.ModelNode == self.superRootNode {
-				self.updateSuperRootKeyDomain()
+				if splitErr = self.updateSuperRootKeyDomain(); splitErr != nil {
+					break
+				}
 			}
 
-			bucketID := parent.ModelNode.GetLinearModel().Predict(float64(key))
-			bucketID = min(max(bucketID, 0), parent.ModelNode.NumChildren-1)
+			// The bucket of the traversal path, which may have been corrected to a neighbour of the predicted leaf
+			bucketID := parent.int
 
 			usedFanoutTree := make([]*fanout_tree.FTNode, 0)
-			fanoutTreeDepth := 1
-			if shared.SplittingPolicyMethod == 0 || (errors.Is(err, shared.MaxCapacityInsertionError) || errors.Is(err, shared.CatastrophicCostInsertionError)) {
-				// always split in 2. No extra work required here
-			} else if shared.SplittingPolicyMethod == shared.DecideBetweenNoSplittingOrSplittingInTwo {
-				// decide between no split (i.e., expand and retrain) or splitting in 2
-				fanoutTreeDepth = fanout_tree.FindBestFanoutExistingNode(parent.ModelNode, bucketID, self.numKeys, &usedFanoutTree, 2)
-			} else if shared.SplittingPolicyMethod == shared.UseFullFanoutTree {
-				// use full fanout tree to decide fanout
-				fanoutTreeDepth = fanout_tree.FindBestFanoutExistingNode(parent.ModelNode, bucketID, self.numKeys, &usedFanoutTree, self.maxFanout)
+			var fanoutTreeDepth int
+			if fanoutTreeDepth, splitErr = self.selectFanout(parent.ModelNode, bucketID, err, insertFrac, &usedFanoutTree); splitErr != nil {
+				break
 			}
 			bestFanout := 1 << fanoutTreeDepth
 
 			if fanoutTreeDepth == 0 {
-				leaf.Resize(
-					shared.KMinDensity,
+				if splitErr = self.checkSplitBudget(leaf, parent.ModelNode, 1, false); splitErr != nil {
+					break
+				}
+				leafSize = leaf.GetNodeSize()
+				leaf.StartResize(
+					leaf.MinDensity,
 					true,
 					leaf.IsAppendMostlyRight(),
 					leaf.IsAppendMostlyLeft(),
@@ -935,46 +1308,62 @@ func (self *Index) Insert(key shared.KeyType, payload shared.PayloadType) error
 				leaf.ExpectedAvgExpSearchIterations = treeNode.ExpectedAvgSearchIterations
 				leaf.ExpectedAvgShifts = treeNode.ExpectedAvgShifts
 				leaf.ResetStats()
+				self.leafResized(leaf, leafSize)
 				self.numExpandAndRetrains++
 			} else {
 				// split data node: always try to split sideways/upwards, only split downwards if necessary
 				reuseModel := errors.Is(err, shared.MaxCapacityInsertionError)
 				if shared.AllowSplittingUpwards {
-					if shared.SplittingPolicyMethod != shared.DecideBetweenNoSplittingOrSplittingInTwo {
-						panic("Splitting upwards is only allowed when using the DecideBetweenNoSplittingOrSplittingInTwo splitting policy")
-					}
-					panic("Not implemented")
+					// Would only be allowed with the DecideBetweenNoSplittingOrSplittingInTwo splitting policy
+					splitErr = fmt.Errorf("%w: splitting upwards", shared.NotImplementedError)
+					break
 				} else {
 					shouldSplitDownwards := parent.NumChildren*bestFanout/(1<<leaf.GetDuplicationFactor()) > self.maxFanout || parent.GetLevel() == self.superRootNode.GetLevel()
+					// Under memory pressure, a small model node is cheaper than expanding the parent
+					shouldSplitDownwards = shouldSplitDownwards || !self.parentExpansionFits(parent.ModelNode, bestFanout>>leaf.GetDuplicationFactor())
+					if splitErr = self.checkSplitBudget(leaf, parent.ModelNode, bestFanout, shouldSplitDownwards); splitErr != nil {
+						break
+					}
 
 					if shouldSplitDownwards {
-						parent.ModelNode = self.splitDownwards(
-							parent,
-							bucketID,
-							fanoutTreeDepth,
-							&usedFanoutTree,
-							reuseModel,
-						)
-					} else {
-						self.splitSideways(
+						if _, splitErr = self.splitDownwards(
 							parent,
 							bucketID,
 							fanoutTreeDepth,
 							&usedFanoutTree,
 							reuseModel,
-						)
+						); splitErr != nil {
+							break
+						}
+					} else if splitErr = self.splitSideways(
+						parent,
+						bucketID,
+						fanoutTreeDepth,
+						&usedFanoutTree,
+						reuseModel,
+					); splitErr != nil {
+						break
 					}
 				}
-				leaf = (*parent.ModelNode.GetChildNode(key)).(*node.DataNode)
+				// Traverse again, so that the key goes to the leaf lookups will reach
+				if leaf, traversalPath, splitErr = self.traverseToLeaf(key, true, noOperation); splitErr != nil {
+					break
+				}
+				parent = traversalPath[len(traversalPath)-1]
 			}
 
 			// Try again to insert the key
+			leafSize = leaf.GetNodeSize()
 			_, err = leaf.Insert(key, payload)
+			self.leafResized(leaf, leafSize)
 			if errors.Is(err, shared.NoInsertionError) {
 				return err
 			}
 		}
-		return nil
+		if splitErr != nil {
+			return splitErr
+		}
+		self.addToSubtreeCounts(self.ancestorsOf(leaf, key), 1)
 	}
 
 	self.numInserts++
@@ -982,15 +1371,241 @@ func (self *Index) Insert(key shared.KeyType, payload shared.PayloadType) error
 	return nil
 }
 
-// Looks for an exact match of the key
-func (self *Index) Find(key shared.KeyType) (*shared.PayloadType, error) {
-	self.numLookups++
-	leaf, _ := self.GetLeaf(key, false)
-	idx, err := leaf.FindKeyPosition(key)
+// ExpectedInsertFrac Decaying estimate of the fraction of inserts among recent operations on the index
+func (self *Index) ExpectedInsertFrac() float64 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.insertFracEstimate()
+}
+
+func (self *Index) insertFracEstimate() float64 {
+	return self.workload.InsertFrac(self.expectedInsertFrac)
+}
+
+// SetExpectedInsertFrac Sets the fraction of inserts assumed until enough operations have been observed
+func (self *Index) SetExpectedInsertFrac(expectedInsertFrac float64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.expectedInsertFrac = expectedInsertFrac
+}
+
+// subtreeInsertFrac Insert fraction expected for the leaf: its own estimate if reliable, otherwise the
+// estimate of the closest ancestor on the traversal path that is, and the global estimate as a last resort
+func (self *Index) subtreeInsertFrac(leaf *node.DataNode, traversalPath []struct {
+	*node.ModelNode
+	int
+}) float64 {
+	if leaf.Workload.IsReliable() {
+		return leaf.Workload.InsertFrac(0)
+	}
+	for i := len(traversalPath) - 1; i >= 0; i-- {
+		if traversalPath[i].ModelNode.Workload.IsReliable() {
+			return traversalPath[i].ModelNode.Workload.InsertFrac(0)
+		}
+	}
+	return self.insertFracEstimate()
+}
+
+func (self *Index) GetCostModel() cost_models.CostModel {
+	return self.costModel
+}
+
+// SetCostModel Replaces the cost model used by the index and all of its data nodes.
+// Costs already stored on data nodes are recomputed with the new model.
+func (self *Index) SetCostModel(costModel cost_models.CostModel) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.costModel = costModel
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leaf.CostModel = costModel
+		leaf.Cost = leaf.ComputeExpectedCost(leaf.FracInserts())
+	}
+}
+
+func (self *Index) GetIncrementalResizeChunk() int {
+	return self.incrementalResizeChunk
+}
+
+// SetIncrementalResizeChunk Makes data nodes resize incrementally: instead of moving all of its keys at once,
+// a growing data node migrates at least chunk keys per insert or lookup it serves, which bounds the latency of a
+// single operation. A chunk of 0 restores resizes in one go.
+func (self *Index) SetIncrementalResizeChunk(chunk int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.incrementalResizeChunk = max(chunk, 0)
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leaf.IncrementalResizeChunk = self.incrementalResizeChunk
+		if self.incrementalResizeChunk == 0 {
+			leaf.FinishResize()
+		}
+	}
+	self.footprintStale = true
+}
+
+func (self *Index) GetSearchStrategy() node.SearchStrategy {
+	return self.searchStrategy
+}
+
+// SetSearchStrategy Makes every data node search with strategy. The default, AdaptiveSearch, lets each data node
+// select its strategy from the error of its model: linear for small errors, binary for errors so large that an
+// exponential search costs more, exponential otherwise.
+func (self *Index) SetSearchStrategy(strategy node.SearchStrategy) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.searchStrategy = strategy
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leaf.SearchStrategy = strategy
+	}
+}
+
+func (self *Index) GetDataNodeLayout() node.DataNodeLayout {
+	return self.dataNodeLayout
+}
+
+// SetDataNodeLayout Makes every data node make room for keys inserted into filled slots with layout. The default,
+// GappedArrayLayout, shifts keys up to the closest gap. PackedMemoryArrayLayout bounds the amortised shifts of
+// adversarial insert orders instead.
+func (self *Index) SetDataNodeLayout(layout node.DataNodeLayout) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.dataNodeLayout = layout
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leaf.Layout = layout
+	}
+}
+
+func (self *Index) GetSlotLayout() node.SlotLayout {
+	return self.slotLayout
+}
+
+// SetSlotLayout Moves the keys and payloads of every data node into slots laid out as layout requires. The default,
+// SeparateSlots, keeps keys and payloads in two arrays. InterleavedSlots stores every payload next to its key.
+func (self *Index) SetSlotLayout(layout node.SlotLayout) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.slotLayout = layout
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leaf.SetSlotLayout(layout)
+	}
+	self.footprintStale = true
+}
+
+// Update Replaces the payload of key.
+// Returns KeyNotFoundError if the key is not in the index. If the key was inserted several times, only the payload
+// of the last copy is replaced.
+func (self *Index) Update(key shared.KeyType, payload shared.PayloadType) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.workload.RecordLookup()
+	leaf, _, _ := self.traverseToLeaf(key, false, lookupOperation)
+	return self.updateInLeaf(leaf, key, lookupOperation, func(shared.PayloadType) (shared.PayloadType, bool) {
+		return payload, true
+	})
+}
+
+// Upsert Replaces the payload of key, or inserts key if it is not in the index
+func (self *Index) Upsert(key shared.KeyType, payload shared.PayloadType) error {
+	return self.Compute(key, func(shared.PayloadType, bool) (shared.PayloadType, bool) {
+		return payload, true
+	})
+}
+
+// Compute Read-modify-write of the payload of key.
+// compute receives the current payload of key and whether key is in the index, and returns the payload to store
+// and whether to store it. If key is not in the index and compute asks to store a payload, key is inserted.
+// The lookup and the write happen atomically with respect to the other operations on the index: compute runs with
+// the lock of the index held, so it must not call back into the index, or it deadlocks.
+func (self *Index) Compute(key shared.KeyType, compute func(payload shared.PayloadType, exists bool) (shared.PayloadType, bool)) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.compute(key, compute)
+}
+
+// The call is recorded once, as an insert if it inserts key and as a lookup otherwise. Neither the traversal nor the
+// search in the leaf record anything until the outcome is known.
+func (self *Index) compute(key shared.KeyType, compute func(payload shared.PayloadType, exists bool) (shared.PayloadType, bool)) error {
+	leaf, _, _ := self.traverseToLeaf(key, false, noOperation)
+	err := self.updateInLeaf(leaf, key, noOperation, func(payload shared.PayloadType) (shared.PayloadType, bool) {
+		return compute(payload, true)
+	})
+	if !errors.Is(err, shared.KeyNotFoundError) {
+		self.recordTraversal(lookupOperation)
+		leaf.RecordLookup()
+		return err
+	}
+
+	var missing shared.PayloadType
+	payload, store := compute(missing, false)
+	if !store {
+		self.recordTraversal(lookupOperation)
+		leaf.RecordLookup()
+		return nil
+	}
+	if key > self.keyDomainMax || key < self.keyDomainMin {
+		// Expanding the key domain may replace the leaf, insert traverses again and records the call
+		return self.insert(key, payload)
+	}
+	self.recordTraversal(insertOperation)
+	return self.insertIntoLeaf(leaf, self.traversedAncestors(), key, payload)
+}
+
+// Records operation in the workload of the index and of the model nodes traversed by the last call to
+// traverseToLeaf, for traversals made with noOperation before the kind of operation was known
+func (self *Index) recordTraversal(operation operationKind) {
+	if operation == insertOperation {
+		self.workload.RecordInsert()
+	} else {
+		self.workload.RecordLookup()
+	}
+	for _, step := range self.traversedPath {
+		step.ModelNode.Workload.Record(operation == insertOperation)
+	}
+}
+
+// Looks for an exact match of the key and returns a copy of its payload, use Update or Compute to modify it.
+// The payload is copied before the lock is released, as background reorganisations and incremental resizes move
+// the slots without any visible modification of the index.
+func (self *Index) Find(key shared.KeyType) (shared.PayloadType, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	payload, err := self.find(key)
 	if err != nil {
-		return nil, err
+		var missing shared.PayloadType
+		return missing, err
+	}
+	return *payload, nil
+}
+
+func (self *Index) find(key shared.KeyType) (*shared.PayloadType, error) {
+	self.numLookups++
+	self.workload.RecordLookup()
+	leaf, _, _ := self.traverseToLeaf(key, false, lookupOperation)
+	return self.findInLeaf(leaf, key, lookupOperation)
+}
+
+// Looks key up in leaf like FindPayload, recording the lookup in leaf unless operation is noOperation. A lookup
+// migrates keys of a running incremental resize and releases the old slots once it finishes, so the footprint is
+// updated
+func (self *Index) findInLeaf(leaf *node.DataNode, key shared.KeyType, operation operationKind) (*shared.PayloadType, error) {
+	if operation != noOperation {
+		leaf.RecordLookup()
+	}
+	size := leaf.GetNodeSize()
+	payload, err := leaf.LocatePayload(key)
+	self.leafResized(leaf, size)
+	return payload, err
+}
+
+// Updates the payload of key in leaf like UpdatePayload, recording the lookup and updating the footprint as
+// findInLeaf does
+func (self *Index) updateInLeaf(leaf *node.DataNode, key shared.KeyType, operation operationKind, update func(shared.PayloadType) (shared.PayloadType, bool)) error {
+	if operation != noOperation {
+		leaf.RecordLookup()
 	}
-	return &leaf.Payloads[idx], nil
+	size := leaf.GetNodeSize()
+	err := leaf.ReplacePayload(key, update)
+	self.leafResized(leaf, size)
+	return err
 }
 
 func NewIndex() *Index {
@@ -1003,6 +1618,7 @@ func NewIndex() *Index {
 
 		expectedInsertFrac:          1.0,
 		maxNodeSize:                 1 << 24,
+		costModel:                   cost_models.NewDefaultCostModel(),
 		approximateModelComputation: true,
 		approximateCostComputation:  false,
 
@@ -1029,6 +1645,7 @@ func NewIndex() *Index {
 		splittingTime:                 0.0,
 		costComputationTime:           0.0,
 
+		// Empty until the root becomes a model node and updateSuperRootKeyDomain sets it
 		keyDomainMax:                   shared.MinKey,
 		keyDomainMin:                   shared.MaxKey,
 		numKeysAboveKeyDomain:          0,
@@ -1040,11 +1657,14 @@ func NewIndex() *Index {
 		splitCost: 0,
 	}
 	emptyDataNode := node.NewDataNode(1)
-	emptyDataNode.BulkLoad(make([]shared.PayloadType, 0), 0, nil, false)
+	emptyDataNode.CostModel = index.costModel
+	// Bulk loading no keys cannot fail
+	_ = emptyDataNode.BulkLoad(make([]shared.PayloadType, 0), 0, nil, false)
 
 	index.rootNode = emptyDataNode
 	index.numDataNodes++
 	index.createSuperRoot()
+	index.footprintStale = true
 
 	return index
 }
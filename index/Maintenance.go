@@ -0,0 +1,354 @@
+package index
+
+import (
+	"alex_go/fanout_tree"
+	"alex_go/node"
+	"alex_go/shared"
+	"errors"
+	"sync"
+)
+
+// maintenanceWorker Reorganises data nodes in a background goroutine.
+// A nil task asks the worker to expand the root's key domain.
+type maintenanceWorker struct {
+	tasks chan *node.DataNode
+	// Leaves currently waiting in tasks, guarded by Index.lock
+	queued map[*node.DataNode]struct{}
+	// Whether a domain expansion is waiting in tasks, guarded by Index.lock
+	domainExpansionQueued bool
+	done                  sync.WaitGroup
+}
+
+// StartMaintenance Starts a background goroutine that splits and retrains data nodes whose cost deviates from
+// the expected cost, and expands the key domain of the root.
+// While it runs, inserts that would otherwise split a data node or expand the root only expand the data node in
+// place, which bounds their latency. Nodes are rebuilt from a copy without holding the index lock and are swapped
+// into their parent model node afterwards.
+// Operations on the index remain serialised: the maintenance goroutine only makes them wait while it copies a
+// node and while it swaps the rebuilt nodes in.
+func (self *Index) StartMaintenance() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.maintenance != nil {
+		return
+	}
+
+	worker := &maintenanceWorker{
+		tasks:  make(chan *node.DataNode, shared.KMaintenanceQueueSize),
+		queued: make(map[*node.DataNode]struct{}),
+	}
+	worker.done.Add(1)
+	go func() {
+		defer worker.done.Done()
+		for leaf := range worker.tasks {
+			if leaf == nil {
+				self.runDomainExpansion(worker)
+			} else {
+				self.reorganiseLeaf(worker, leaf)
+			}
+		}
+	}()
+	self.maintenance = worker
+}
+
+// StopMaintenance Processes the pending maintenance tasks and stops the maintenance goroutine.
+// Inserts are synchronous again afterwards.
+func (self *Index) StopMaintenance() {
+	self.lock.Lock()
+	worker := self.maintenance
+	self.maintenance = nil
+	self.lock.Unlock()
+	if worker == nil {
+		return
+	}
+
+	close(worker.tasks)
+	worker.done.Wait()
+}
+
+// Queues a domain expansion if the maintenance goroutine runs.
+// Returns whether the expansion was deferred.
+func (self *Index) deferDomainExpansion() bool {
+	worker := self.maintenance
+	if worker == nil {
+		return false
+	}
+	if worker.domainExpansionQueued {
+		return true
+	}
+	select {
+	case worker.tasks <- nil:
+		worker.domainExpansionQueued = true
+		return true
+	default:
+		return false
+	}
+}
+
+// Queues the reorganisation of a leaf whose insert failed with err if the maintenance goroutine runs.
+// Returns whether the reorganisation was deferred, in which case the leaf may be expanded in place.
+func (self *Index) deferReorganisation(leaf *node.DataNode, err error) bool {
+	worker := self.maintenance
+	if worker == nil {
+		return false
+	}
+	if !errors.Is(err, shared.SignificantCostDeviationInsertionError) && !errors.Is(err, shared.CatastrophicCostInsertionError) {
+		return false
+	}
+	// Splitting the root also sets up the key domain, which is left to the foreground
+	if self.rootNode.IsLeaf() {
+		return false
+	}
+	if _, ok := worker.queued[leaf]; ok {
+		self.numDeferredReorganisations++
+		return true
+	}
+	select {
+	case worker.tasks <- leaf:
+		worker.queued[leaf] = struct{}{}
+		self.numDeferredReorganisations++
+		return true
+	default:
+		return false
+	}
+}
+
+func (self *Index) runDomainExpansion(worker *maintenanceWorker) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	worker.domainExpansionQueued = false
+
+	// A failed expansion leaves the index unchanged, the keys outside of the key domain stay in the outermost
+	// data nodes
+	if self.shouldExpandRight() && self.maxKey() > self.keyDomainMax {
+		if err := self.expandRoot(self.maxKey(), false); err != nil {
+			return
+		}
+	}
+	if self.shouldExpandLeft() && self.minKey() < self.keyDomainMin {
+		_ = self.expandRoot(self.minKey(), true)
+	}
+}
+
+// Returns a detached index that only carries the parameters needed to build nodes.
+// Its statistics start at zero so that they can be merged into the index once the built nodes are swapped in.
+// The memory budget, the pressure and the footprint are those of the index, so that the rebuild is planned like
+// an insert would plan it.
+func (self *Index) maintenanceScratch() *Index {
+	return &Index{
+		memoryBudget:           self.memoryBudget,
+		memoryPressure:         self.memoryPressure,
+		footprint:              self.refreshFootprint(),
+		expectedInsertFrac:     self.expectedInsertFrac,
+		workload:               self.workload,
+		costModel:              self.costModel,
+		incrementalResizeChunk: self.incrementalResizeChunk,
+		searchStrategy:         self.searchStrategy,
+		dataNodeLayout:         self.dataNodeLayout,
+		maxFanout:              self.maxFanout,
+		maxDataNodeSlots:       self.maxDataNodeSlots,
+		numKeys:                self.numKeys,
+	}
+}
+
+func (self *Index) mergeStatistics(scratch *Index) {
+	self.numModelNodes += scratch.numModelNodes
+	self.numDataNodes += scratch.numDataNodes
+	self.numExpandAndRetrains += scratch.numExpandAndRetrains
+	self.numDownwardSplits += scratch.numDownwardSplits
+	self.numSidewaysSplits += scratch.numSidewaysSplits
+	self.numModelNodeExpansions += scratch.numModelNodeExpansions
+	self.numDownwardSplitKeys += scratch.numDownwardSplitKeys
+	self.numSidewaysSplitKeys += scratch.numSidewaysSplitKeys
+	self.numModelNodeExpansionPointers += scratch.numModelNodeExpansionPointers
+}
+
+// Returns the leftmost and rightmost data nodes reachable from the given children
+func boundaryLeaves(children []node.Node) (*node.DataNode, *node.DataNode) {
+	first := children[0]
+	for !first.IsLeaf() {
+		first = first.(*node.ModelNode).Children[0]
+	}
+	last := children[len(children)-1]
+	for !last.IsLeaf() {
+		lastModelNode := last.(*node.ModelNode)
+		last = lastModelNode.Children[lastModelNode.NumChildren-1]
+	}
+	return first.(*node.DataNode), last.(*node.DataNode)
+}
+
+// Returns the data node under staging responsible for key
+func stagedLeaf(staging *node.ModelNode, key shared.KeyType) *node.DataNode {
+	current := *staging.GetChildNode(key)
+	for !current.IsLeaf() {
+		current = *current.(*node.ModelNode).GetChildNode(key)
+	}
+	return current.(*node.DataNode)
+}
+
+// Locates the parent of leaf and the first bucket pointing to it.
+// Returns a nil parent if leaf is no longer part of the index or is the root.
+func (self *Index) locateLeaf(leaf *node.DataNode) (*node.ModelNode, int, []struct {
+	*node.ModelNode
+	int
+}) {
+	if leaf.NumKeys == 0 || self.rootNode.IsLeaf() {
+		return nil, 0, nil
+	}
+	found, traversalPath, err := self.traverseToLeaf(leaf.GetFirstKey(), true, noOperation)
+	if err != nil || found != leaf {
+		return nil, 0, nil
+	}
+	parent := traversalPath[len(traversalPath)-1]
+	repeats := 1 << leaf.GetDuplicationFactor()
+	return parent.ModelNode, parent.int - parent.int%repeats, traversalPath
+}
+
+// Splits or retrains leaf off to the side, replays the inserts and updates the leaf received in the meantime and
+// swaps the result into its parent.
+// The rebuild is dropped if the leaf went through other changes or was replaced in the meantime: it will be
+// queued again by the next insert that finds its cost deviating.
+func (self *Index) reorganiseLeaf(worker *maintenanceWorker, leaf *node.DataNode) {
+	// Copy everything the rebuild needs
+	self.lock.Lock()
+	delete(worker.queued, leaf)
+	parent, startBucketID, traversalPath := self.locateLeaf(leaf)
+	if parent == nil {
+		self.lock.Unlock()
+		return
+	}
+	snapshot := leaf.Clone()
+	leaf.ChangeLog = &node.ChangeLog{}
+	parentModel := parent.LinearModel
+	parentNumChildren := parent.NumChildren
+	parentLevel := parent.GetLevel()
+	insertFrac := self.subtreeInsertFrac(leaf, traversalPath)
+	scratch := self.maintenanceScratch()
+	self.lock.Unlock()
+	// The fanout tree reads the slots of the copy directly
+	snapshot.FinishResize()
+
+	// Stage the buckets of the parent that point to the leaf in a detached model node
+	repeats := 1 << snapshot.GetDuplicationFactor()
+	staging := node.NewModelNode(parentLevel)
+	staging.LinearModel = parentModel
+	staging.LinearModel.B -= float64(startBucketID)
+	staging.NumChildren = repeats
+	staging.Children = make([]node.Node, repeats)
+	for i := range staging.Children {
+		staging.Children[i] = snapshot
+	}
+
+	var err error = shared.SignificantCostDeviationInsertionError
+	if snapshot.CatastrophicCost() {
+		err = shared.CatastrophicCostInsertionError
+	}
+	usedFanoutTree := make([]*fanout_tree.FTNode, 0)
+	fanoutTreeDepth, rebuildErr := scratch.selectFanout(staging, 0, err, insertFrac, &usedFanoutTree)
+
+	log2ExpansionFactor := 0
+	if rebuildErr == nil {
+		// Against the footprint of the index when the rebuild started, the swap checks the actual growth.
+		// The expansion of the parent is not known yet, the staging node only holds the buckets of the leaf
+		splitDownwards := fanoutTreeDepth > 0 && parentNumChildren<<max(0, fanoutTreeDepth-snapshot.GetDuplicationFactor()) > scratch.maxFanout
+		rebuildErr = scratch.checkSplitBudget(snapshot, staging, 1<<fanoutTreeDepth, splitDownwards)
+	}
+	if rebuildErr != nil {
+		// Dropped below, the leaf is left as it is
+	} else if fanoutTreeDepth == 0 {
+		snapshot.Resize(snapshot.MinDensity, true, snapshot.IsAppendMostlyRight(), snapshot.IsAppendMostlyLeft())
+		treeNode := usedFanoutTree[0]
+		snapshot.Cost = treeNode.Cost
+		snapshot.ExpectedAvgExpSearchIterations = treeNode.ExpectedAvgSearchIterations
+		snapshot.ExpectedAvgShifts = treeNode.ExpectedAvgShifts
+		snapshot.ResetStats()
+		scratch.numExpandAndRetrains++
+	} else if parentNumChildren<<max(0, fanoutTreeDepth-snapshot.GetDuplicationFactor()) <= scratch.maxFanout {
+		// Split sideways, the parent is expanded during the swap if it lacks redundant pointers
+		log2ExpansionFactor = max(0, fanoutTreeDepth-snapshot.GetDuplicationFactor())
+		if log2ExpansionFactor > 0 {
+			_, rebuildErr = staging.Expand(log2ExpansionFactor)
+		}
+		if rebuildErr == nil {
+			rebuildErr = scratch.splitSideways(struct {
+				*node.ModelNode
+				int
+			}{staging, 0}, 0, fanoutTreeDepth, &usedFanoutTree, false)
+		}
+	} else {
+		_, rebuildErr = scratch.splitDownwards(struct {
+			*node.ModelNode
+			int
+		}{staging, 0}, 0, fanoutTreeDepth, &usedFanoutTree, false)
+	}
+
+	// Swap the rebuilt nodes in
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	changeLog := leaf.ChangeLog
+	leaf.ChangeLog = nil
+	if rebuildErr != nil {
+		return
+	}
+	currentParent, currentStartBucketID, _ := self.locateLeaf(leaf)
+	if currentParent != parent || currentStartBucketID != startBucketID || parent.NumChildren != parentNumChildren ||
+		1<<leaf.GetDuplicationFactor() != repeats || changeLog.Invalid {
+		return
+	}
+	if parent.NumChildren<<log2ExpansionFactor > self.maxFanout {
+		return
+	}
+	for i, key := range changeLog.Keys {
+		payload := changeLog.Payloads[i]
+		var err error
+		if changeLog.IsUpdate[i] {
+			err = stagedLeaf(staging, key).UpdatePayload(key, func(shared.PayloadType) (shared.PayloadType, bool) {
+				return payload, true
+			})
+		} else {
+			_, err = stagedLeaf(staging, key).InsertInPlace(key, payload)
+		}
+		if err != nil {
+			return
+		}
+	}
+	// The footprint changed while the nodes were rebuilt, and the replay may have expanded the rebuilt data nodes
+	growth := int64(parent.NumChildren*(1<<log2ExpansionFactor-1))*modelNodeBucketSize - leaf.GetNodeSize()
+	for i := 0; i < staging.NumChildren; i += 1 << staging.Children[i].GetDuplicationFactor() {
+		growth += subtreeSize(staging.Children[i])
+	}
+	if !self.fitsMemoryBudget(growth) {
+		return
+	}
+	parentSize := parent.GetNodeSize()
+	if log2ExpansionFactor > 0 {
+		expansionFactor, err := parent.Expand(log2ExpansionFactor)
+		if err != nil {
+			return
+		}
+		self.numModelNodeExpansions++
+		self.numModelNodeExpansionPointers += int64(parent.NumChildren / expansionFactor)
+		startBucketID *= expansionFactor
+	}
+	copy(parent.Children[startBucketID:startBucketID+staging.NumChildren], staging.Children)
+	// The staged model nodes were counted before the replay, the keys under the buckets stay the same
+	self.footprint += parent.GetNodeSize() - parentSize - leaf.GetNodeSize()
+	for i := 0; i < staging.NumChildren; i += 1 << staging.Children[i].GetDuplicationFactor() {
+		countSubtree(staging.Children[i])
+		self.footprint += subtreeSize(staging.Children[i])
+	}
+	parent.RecountChildKeys(startBucketID, startBucketID+staging.NumChildren)
+
+	first, last := boundaryLeaves(staging.Children)
+	first.PrevLeaf = leaf.PrevLeaf
+	if leaf.PrevLeaf != nil {
+		leaf.PrevLeaf.NextLeaf = first
+	}
+	last.NextLeaf = leaf.NextLeaf
+	if leaf.NextLeaf != nil {
+		leaf.NextLeaf.PrevLeaf = last
+	}
+
+	self.mergeStatistics(scratch)
+	self.numBackgroundReorganisations++
+}
@@ -0,0 +1,179 @@
+package index
+
+import (
+	"alex_go/node"
+	"alex_go/shared"
+	"unsafe"
+)
+
+func (self *Index) GetMemoryBudget() int64 {
+	return self.memoryBudget
+}
+
+// SetMemoryBudget Bounds the memory held by the nodes of the index to budget bytes, 0 removes the bound.
+// Once the nodes hold KMemoryPressureRatio of the budget, data nodes expand to denser layouts and splits avoid
+// expanding model nodes. An insert that would still grow the nodes past the budget fails with a MemoryBudgetError
+// and leaves the index unchanged, or, if it fails while splitting, with the completed splits in place and the key not
+// inserted. Inserts budget the expansions of data nodes, including the old slots an incremental resize holds until
+// it finishes, their retrains and splits, and the model nodes that splits expand or add.
+// Background reorganisations are dropped if they would take the nodes past the budget. Deletes and domain
+// expansions are not budgeted, they may take the nodes past the budget. Values stored out of line, such as those
+// of an ArenaIndex, are not accounted for.
+func (self *Index) SetMemoryBudget(budget int64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.memoryBudget = max(budget, 0)
+	if self.memoryBudget == 0 {
+		for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+			leaf.MinDensity, leaf.MaxDensity = shared.KMinDensity, shared.KMaxDensity
+		}
+	}
+}
+
+// MemoryFootprint Number of bytes held by the nodes of the index, including their key, payload, bitmap and
+// child arrays
+func (self *Index) MemoryFootprint() int64 {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.refreshFootprint()
+}
+
+// Recomputes the footprint if it went stale.
+// Inserts, lookups, deletes, splits, merges and background reorganisations keep it up to date with the sizes of the
+// nodes they resize, add or drop. Domain expansions and the settings that resize every data node mark it stale so
+// that it is recomputed once, on the next insert that checks the memory budget.
+func (self *Index) refreshFootprint() int64 {
+	if self.footprintStale {
+		self.footprint = subtreeSize(self.superRootNode)
+		self.footprintStale = false
+		self.numFootprintRecounts++
+	}
+	return self.footprint
+}
+
+// Adds to the footprint the bytes leaf allocated or released since its size was size
+func (self *Index) leafResized(leaf *node.DataNode, size int64) {
+	self.footprint += leaf.GetNodeSize() - size
+}
+
+// Bytes held by current and the nodes below it, counting each child once however many buckets point to it
+func subtreeSize(current node.Node) int64 {
+	size := current.GetNodeSize()
+	if current.IsLeaf() {
+		return size
+	}
+	modelNode := current.(*node.ModelNode)
+	for i := 0; i < modelNode.NumChildren; i++ {
+		if i == 0 || modelNode.Children[i] != modelNode.Children[i-1] {
+			size += subtreeSize(modelNode.Children[i])
+		}
+	}
+	return size
+}
+
+// Bytes taken by a slot of leaf, with its bit in the bitmap
+func slotSize(leaf *node.DataNode) float64 {
+	size := float64(shared.KeySize) + 1.0/8
+	if !leaf.KeysOnly {
+		size += float64(shared.PayloadSize)
+	}
+	return size
+}
+
+// Number of slots a resize of leaf allocates for numKeys keys
+func resizedCapacity(leaf *node.DataNode, numKeys int) float64 {
+	return max(float64(numKeys)/leaf.MinDensity, float64(numKeys+1))
+}
+
+// Bytes an expansion of leaf adds, or 0 if the next insert into leaf does not expand it.
+// An incremental resize holds the old slots until its keys are migrated, so the new slots are added in full.
+func expansionSize(leaf *node.DataNode) int64 {
+	if float64(leaf.NumKeys) < leaf.ExpansionThreshold {
+		return 0
+	}
+	newSlots := resizedCapacity(leaf, leaf.NumKeys)
+	if leaf.IncrementalResizeChunk == 0 {
+		newSlots -= float64(leaf.DataCapacity)
+	}
+	return int64(max(newSlots, 0) * slotSize(leaf))
+}
+
+// Bytes a split of leaf into fanout data nodes adds: the new data nodes, and the buckets a sideways split adds to
+// parent or the model node a downward split adds, less leaf itself, which is released once the split completes.
+// A fanout of 1 stands for a retrain, which resizes leaf in one go.
+func splitSize(leaf *node.DataNode, parent *node.ModelNode, fanout int, downwards bool) int64 {
+	if fanout == 1 {
+		return int64((resizedCapacity(leaf, leaf.NumKeys) - float64(leaf.DataCapacity)) * slotSize(leaf))
+	}
+	// Each new data node holds at most one more slot than its share of the keys at the minimum density
+	newSlots := float64(leaf.NumKeys)/leaf.MinDensity + float64(fanout)
+	size := int64(newSlots*slotSize(leaf)) + int64(fanout)*int64(unsafe.Sizeof(*leaf)) - leaf.GetNodeSize()
+	if downwards {
+		size += int64(unsafe.Sizeof(*parent)) + int64(fanout)*modelNodeBucketSize
+	} else if repeats := 1 << leaf.GetDuplicationFactor(); fanout > repeats {
+		size += int64(parent.NumChildren*(fanout/repeats-1)) * modelNodeBucketSize
+	}
+	return size
+}
+
+// Bytes a model node holds per bucket: the pointer to the child and its key count
+const modelNodeBucketSize = int64(unsafe.Sizeof(node.Node(nil)) + unsafe.Sizeof(0))
+
+// Whether the memory budget leaves room for growth more bytes
+func (self *Index) fitsMemoryBudget(growth int64) bool {
+	return self.memoryBudget == 0 || self.refreshFootprint()+growth <= self.memoryBudget
+}
+
+// Whether the root can expand its key domain within the memory budget, which at most doubles its children.
+// Keys outside of the key domain are stored in the outermost data nodes until it can.
+func (self *Index) domainExpansionFits() bool {
+	return self.fitsMemoryBudget(self.rootNode.GetNodeSize())
+}
+
+// Whether parent can multiply its number of children by expansionFactor to make room for a sideways split.
+// Under memory pressure, splitting downwards into a small model node is preferred to any expansion of parent.
+func (self *Index) parentExpansionFits(parent *node.ModelNode, expansionFactor int) bool {
+	if expansionFactor <= 1 {
+		return true
+	}
+	if self.memoryPressure {
+		return false
+	}
+	return self.fitsMemoryBudget(int64(parent.NumChildren*(expansionFactor-1)) * modelNodeBucketSize)
+}
+
+// Checks that inserting into leaf keeps the index within its memory budget and updates the memory pressure.
+// Under memory pressure, leaf is given denser targets, which take effect on its next resize.
+func (self *Index) checkMemoryBudget(leaf *node.DataNode) error {
+	self.memoryPressure = false
+	if self.memoryBudget == 0 {
+		return nil
+	}
+	footprint := self.refreshFootprint()
+	self.memoryPressure = float64(footprint) >= float64(self.memoryBudget)*shared.KMemoryPressureRatio
+	if self.memoryPressure {
+		leaf.MinDensity, leaf.MaxDensity = shared.KMemoryPressureMinDensity, shared.KMemoryPressureMaxDensity
+	} else {
+		leaf.MinDensity, leaf.MaxDensity = shared.KMinDensity, shared.KMaxDensity
+	}
+
+	required := expansionSize(leaf)
+	if footprint+required > self.memoryBudget {
+		return &shared.MemoryBudgetError{Budget: self.memoryBudget, Footprint: footprint, Required: required}
+	}
+	return nil
+}
+
+// Checks that splitting leaf into fanout data nodes, or retraining it if fanout is 1, keeps the index within its
+// memory budget
+func (self *Index) checkSplitBudget(leaf *node.DataNode, parent *node.ModelNode, fanout int, downwards bool) error {
+	if self.memoryBudget == 0 {
+		return nil
+	}
+	footprint := self.refreshFootprint()
+	required := splitSize(leaf, parent, fanout, downwards)
+	if footprint+required > self.memoryBudget {
+		return &shared.MemoryBudgetError{Budget: self.memoryBudget, Footprint: footprint, Required: required, Splitting: true}
+	}
+	return nil
+}
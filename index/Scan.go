@@ -0,0 +1,86 @@
+package index
+
+import "alex_go/shared"
+
+// Scan Calls yield for every key greater than or equal to from, from the smallest to the largest, with its
+// payload. Stops as soon as yield returns false.
+// yield must not modify the index.
+func (self *Index) Scan(from shared.KeyType, yield func(shared.KeyType, shared.PayloadType) bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.numLookups++
+	self.workload.RecordLookup()
+	leaf, _, _ := self.traverseToLeaf(from, false, lookupOperation)
+	// Keys on the boundary of the leaf may be stored in the preceding leaves
+	for prev := leaf.PrevLeaf; prev != nil; prev = prev.PrevLeaf {
+		if prev.NumKeys == 0 {
+			continue
+		}
+		if prev.GetLastKey() < from {
+			break
+		}
+		leaf = prev
+	}
+
+	if !leaf.Ascend(from, yield) {
+		return
+	}
+	for current := leaf.NextLeaf; current != nil; current = current.NextLeaf {
+		if !current.Ascend(shared.MinKey, yield) {
+			return
+		}
+	}
+}
+
+// ScanDescending Calls yield for every key smaller than or equal to from, from the largest to the smallest, with
+// its payload. Stops as soon as yield returns false.
+// yield must not modify the index.
+func (self *Index) ScanDescending(from shared.KeyType, yield func(shared.KeyType, shared.PayloadType) bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.scanDescending(from, true, yield)
+}
+
+// LastNBefore Returns the n largest keys smaller than t with their payloads, from the largest to the smallest
+func (self *Index) LastNBefore(t shared.KeyType, n int) ([]shared.KeyType, []shared.PayloadType) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	keys := make([]shared.KeyType, 0, max(n, 0))
+	payloads := make([]shared.PayloadType, 0, max(n, 0))
+	if n <= 0 {
+		return keys, payloads
+	}
+	self.scanDescending(t, false, func(key shared.KeyType, payload shared.PayloadType) bool {
+		keys = append(keys, key)
+		payloads = append(payloads, payload)
+		return len(keys) < n
+	})
+	return keys, payloads
+}
+
+// Walks the keys smaller than key, or smaller than or equal to key if inclusive, in descending order: backwards
+// through the leaf of key, then through the preceding leaves
+func (self *Index) scanDescending(key shared.KeyType, inclusive bool, yield func(shared.KeyType, shared.PayloadType) bool) {
+	self.numLookups++
+	self.workload.RecordLookup()
+	leaf, _, _ := self.traverseToLeaf(key, false, lookupOperation)
+	// Keys on the boundary of the leaf may be stored in the following leaves
+	for next := leaf.NextLeaf; next != nil; next = next.NextLeaf {
+		if next.NumKeys == 0 {
+			continue
+		}
+		if !isBefore(next.GetFirstKey(), key, inclusive) {
+			break
+		}
+		leaf = next
+	}
+
+	if !leaf.Descend(key, inclusive, yield) {
+		return
+	}
+	for current := leaf.PrevLeaf; current != nil; current = current.PrevLeaf {
+		if !current.Descend(shared.MaxKey, true, yield) {
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package index
+
+import (
+	"alex_go/node"
+	"alex_go/shared"
+)
+
+// Stats Counters describing the shape of an index and the work done to maintain it, as reported by the reference
+// implementation
+type Stats struct {
+	NumKeys                       int
+	NumModelNodes                 int
+	NumDataNodes                  int
+	NumExpandAndScales            int
+	NumExpandAndRetrains          int
+	NumDownwardSplits             int
+	NumSidewaysSplits             int
+	NumModelNodeExpansions        int
+	NumModelNodeSplits            int
+	NumDownwardSplitKeys          int64
+	NumSidewaysSplitKeys          int64
+	NumModelNodeExpansionPointers int64
+	NumModelNodeSplitPointers     int64
+	// NumNodeLookups Levels traversed down to data nodes, by lookups and inserts alike
+	NumNodeLookups int64
+	NumLookups     int64
+	NumInserts     int64
+	// NumBackgroundReorganisations Data nodes rebuilt by the maintenance goroutine
+	NumBackgroundReorganisations int
+	// NumDeferredReorganisations Data nodes queued for the maintenance goroutine instead of being split inline
+	NumDeferredReorganisations int
+	// NumSubtreeRecounts Recomputations of the subtree counts of every model node, see Rank
+	NumSubtreeRecounts int
+	// NumFootprintRecounts Recomputations of the bytes held by every node, see MemoryFootprint
+	NumFootprintRecounts int
+}
+
+// GetStats Returns a snapshot of the statistics of the index
+func (self *Index) GetStats() Stats {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return Stats{
+		NumKeys:                       self.numKeys,
+		NumModelNodes:                 self.numModelNodes,
+		NumDataNodes:                  self.numDataNodes,
+		NumExpandAndScales:            self.numExpandAndScales,
+		NumExpandAndRetrains:          self.numExpandAndRetrains,
+		NumDownwardSplits:             self.numDownwardSplits,
+		NumSidewaysSplits:             self.numSidewaysSplits,
+		NumModelNodeExpansions:        self.numModelNodeExpansions,
+		NumModelNodeSplits:            self.numModelNodeSplits,
+		NumDownwardSplitKeys:          self.numDownwardSplitKeys,
+		NumSidewaysSplitKeys:          self.numSidewaysSplitKeys,
+		NumModelNodeExpansionPointers: self.numModelNodeExpansionPointers,
+		NumModelNodeSplitPointers:     self.numModelNodeSplitPointers,
+		NumNodeLookups:                self.numNodeLookups,
+		NumLookups:                    self.numLookups,
+		NumInserts:                    self.numInserts,
+		NumBackgroundReorganisations:  self.numBackgroundReorganisations,
+		NumDeferredReorganisations:    self.numDeferredReorganisations,
+		NumSubtreeRecounts:            self.numSubtreeRecounts,
+		NumFootprintRecounts:          self.numFootprintRecounts,
+	}
+}
+
+// Depth Average number of nodes on the path from the root to a key, root and data node included, and the largest
+// such number
+func (self *Index) Depth() (float64, int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	rootLevel := self.rootNode.GetLevel()
+	totalDepth, maxDepth := 0, 0
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		depth := leaf.GetLevel() - rootLevel + 1
+		totalDepth += depth * leaf.NumKeys
+		maxDepth = max(maxDepth, depth)
+	}
+	if self.numKeys == 0 {
+		return float64(maxDepth), maxDepth
+	}
+	return float64(totalDepth) / float64(self.numKeys), maxDepth
+}
+
+// SearchStrategies Number of data nodes searching with each strategy, see SetSearchStrategy
+func (self *Index) SearchStrategies() map[node.SearchStrategy]int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	strategies := make(map[node.SearchStrategy]int)
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		strategies[leaf.GetSearchStrategy()]++
+	}
+	return strategies
+}
+
+// ModelErrorStats Error bounds of the models of the data nodes, see node.DataNode.MinError
+type ModelErrorStats struct {
+	// MinError Smallest signed error, actual position minus predicted position, of any data node
+	MinError int
+	// MaxError Largest signed error of any data node
+	MaxError int
+	// AvgErrorWindow Average number of positions searched within the error bounds, weighted by the keys of the
+	// data nodes
+	AvgErrorWindow float64
+	// NumDegradedDataNodes Data nodes whose error bounds span more than KDegradedErrorWindow positions
+	NumDegradedDataNodes int
+}
+
+// ModelErrors Returns the error bounds of the models of the data nodes, to tell how many leaves have degraded models
+func (self *Index) ModelErrors() ModelErrorStats {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var stats ModelErrorStats
+	totalWindow := 0
+	for leaf := self.firstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		stats.MinError = min(stats.MinError, leaf.MinError)
+		stats.MaxError = max(stats.MaxError, leaf.MaxError)
+		window := leaf.MaxError - leaf.MinError + 1
+		totalWindow += window * leaf.NumKeys
+		if window > shared.KDegradedErrorWindow {
+			stats.NumDegradedDataNodes++
+		}
+	}
+	if self.numKeys > 0 {
+		stats.AvgErrorWindow = float64(totalWindow) / float64(self.numKeys)
+	}
+	return stats
+}
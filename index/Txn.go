@@ -0,0 +1,154 @@
+package index
+
+import (
+	"alex_go/shared"
+	"errors"
+	"sort"
+)
+
+// A write buffered by a transaction, the last one made to its key
+type txnWrite struct {
+	key     shared.KeyType
+	payload shared.PayloadType
+	deleted bool
+}
+
+// Txn Buffers writes to several keys of an index and applies them atomically on Commit.
+// Reads made through the transaction see its own writes on top of the index. The index is only locked while
+// reading from it and during Commit, so writes committed by others in the meantime are visible to the reads of
+// keys the transaction did not write and are overwritten by its commit.
+// A Txn must not be used concurrently.
+type Txn struct {
+	index *Index
+	// Ordered by key
+	writes []txnWrite
+	closed bool
+}
+
+// Begin Starts a transaction on the index
+func (self *Index) Begin() *Txn {
+	return &Txn{index: self}
+}
+
+// Finds the position of the write to key, or where it would be inserted
+func (self *Txn) search(key shared.KeyType) (int, bool) {
+	position := sort.Search(len(self.writes), func(i int) bool {
+		return self.writes[i].key >= key
+	})
+	return position, position < len(self.writes) && self.writes[position].key == key
+}
+
+func (self *Txn) write(key shared.KeyType, payload shared.PayloadType, deleted bool) error {
+	if self.closed {
+		return shared.TxnClosedError
+	}
+	position, found := self.search(key)
+	if !found {
+		self.writes = append(self.writes, txnWrite{})
+		copy(self.writes[position+1:], self.writes[position:])
+	}
+	self.writes[position] = txnWrite{key: key, payload: payload, deleted: deleted}
+	return nil
+}
+
+// Put Sets the payload of key on commit, inserting key if it is not in the index
+func (self *Txn) Put(key shared.KeyType, payload shared.PayloadType) error {
+	return self.write(key, payload, false)
+}
+
+// Delete Deletes every copy of key on commit
+func (self *Txn) Delete(key shared.KeyType) error {
+	var missing shared.PayloadType
+	return self.write(key, missing, true)
+}
+
+// Get Returns the payload of key as the transaction sees it: its own last write to key if any, the payload in the
+// index otherwise
+func (self *Txn) Get(key shared.KeyType) (shared.PayloadType, error) {
+	var missing shared.PayloadType
+	if self.closed {
+		return missing, shared.TxnClosedError
+	}
+	if position, found := self.search(key); found {
+		if self.writes[position].deleted {
+			return missing, shared.KeyNotFoundError
+		}
+		return self.writes[position].payload, nil
+	}
+	return self.index.Find(key)
+}
+
+// Len Number of keys written by the transaction
+func (self *Txn) Len() int {
+	return len(self.writes)
+}
+
+// Rollback Discards the writes of the transaction
+func (self *Txn) Rollback() {
+	self.writes = nil
+	self.closed = true
+}
+
+// Commit Applies the writes of the transaction to the index, all of them or none.
+// Payloads of present keys are replaced first, then missing keys are inserted, then deletes are applied. Only the
+// inserts can fail, for instance on the memory budget of the index, in which case the keys inserted so far are
+// deleted again and the replaced payloads restored before the error is returned. Splits made by those inserts are
+// kept, they do not change the keys and payloads held by the index.
+// The transaction is closed either way.
+func (self *Txn) Commit() error {
+	if self.closed {
+		return shared.TxnClosedError
+	}
+	writes := self.writes
+	self.Rollback()
+
+	index := self.index
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	// Replace the payloads of present keys, remembering the previous ones
+	updated := make([]txnWrite, 0)
+	inserts := make([]txnWrite, 0)
+	for _, write := range writes {
+		if write.deleted {
+			continue
+		}
+		index.workload.RecordLookup()
+		leaf, _, _ := index.traverseToLeaf(write.key, false, lookupOperation)
+		err := index.updateInLeaf(leaf, write.key, lookupOperation, func(previous shared.PayloadType) (shared.PayloadType, bool) {
+			updated = append(updated, txnWrite{key: write.key, payload: previous})
+			return write.payload, true
+		})
+		if errors.Is(err, shared.KeyNotFoundError) {
+			inserts = append(inserts, write)
+		}
+	}
+
+	for i, write := range inserts {
+		if err := index.insert(write.key, write.payload); err != nil {
+			index.undoCommit(updated, inserts[:i])
+			return err
+		}
+	}
+
+	for _, write := range writes {
+		if write.deleted {
+			index.deleteRange(write.key, write.key, true)
+		}
+	}
+	return nil
+}
+
+// Reverts a partially applied commit: deletes the inserted keys and restores the payloads replaced in place.
+// Neither can fail, so the index ends up holding the keys and payloads it held before the commit.
+func (self *Index) undoCommit(updated []txnWrite, inserted []txnWrite) {
+	for _, write := range inserted {
+		self.deleteRange(write.key, write.key, true)
+	}
+	for _, write := range updated {
+		leaf, _, _ := self.traverseToLeaf(write.key, false, noOperation)
+		self.updateInLeaf(leaf, write.key, noOperation, func(shared.PayloadType) (shared.PayloadType, bool) {
+			return write.payload, true
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package node
+
+import "math/bits"
+
+// SubtreeNumKeys Number of keys in the data nodes under node: its own keys for a data node, the NumKeys maintained
+// by the index for a model node
+func SubtreeNumKeys(node Node) int {
+	if node.IsLeaf() {
+		return node.(*DataNode).NumKeys
+	}
+	return node.(*ModelNode).NumKeys
+}
+
+// Number of buckets pointing to the child at bucketID, and the first of them
+func (self *ModelNode) childBuckets(bucketID int) (int, int) {
+	repeats := 1 << self.Children[bucketID].GetDuplicationFactor()
+	return bucketID - bucketID%repeats, repeats
+}
+
+// RebuildChildCounts Recomputes the child counts from the subtree counts of the children, which must be up to
+// date, and sets NumKeys to their sum. Runs in O(NumChildren)
+func (self *ModelNode) RebuildChildCounts() {
+	if len(self.childCounts) != self.NumChildren {
+		self.childCounts = make([]int, self.NumChildren)
+	} else {
+		clear(self.childCounts)
+	}
+	self.NumKeys = 0
+	for i := 0; i < self.NumChildren; {
+		startBucketID, repeats := self.childBuckets(i)
+		numKeys := SubtreeNumKeys(self.Children[i])
+		self.childCounts[startBucketID] = numKeys
+		self.NumKeys += numKeys
+		i = startBucketID + repeats
+	}
+	for i, numKeys := range self.childCounts {
+		if parent := i | (i + 1); parent < len(self.childCounts) {
+			self.childCounts[parent] += numKeys
+		}
+	}
+}
+
+// AddChildKeys Adds numKeys to the count of the child at bucketID. NumKeys is left to the caller.
+// Runs in O(log NumChildren)
+func (self *ModelNode) AddChildKeys(bucketID int, numKeys int) {
+	if len(self.childCounts) != self.NumChildren {
+		// Counts of a model node the index is about to recount
+		return
+	}
+	startBucketID, _ := self.childBuckets(bucketID)
+	for i := startBucketID; i < len(self.childCounts); i |= i + 1 {
+		self.childCounts[i] += numKeys
+	}
+}
+
+// RecountChildKeys Recomputes the child counts of the buckets [startBucketID, endBucketID) after the children
+// pointed to by those buckets changed. The subtree counts of the new children must be up to date, NumKeys is left
+// to the caller. Runs in O((endBucketID - startBucketID) * log NumChildren)
+func (self *ModelNode) RecountChildKeys(startBucketID int, endBucketID int) {
+	if len(self.childCounts) != self.NumChildren {
+		self.RebuildChildCounts()
+		return
+	}
+	for i := startBucketID; i < endBucketID; i++ {
+		numKeys := 0
+		if first, _ := self.childBuckets(i); first == i {
+			numKeys = SubtreeNumKeys(self.Children[i])
+		}
+		if delta := numKeys - (self.NumKeysBefore(i+1) - self.NumKeysBefore(i)); delta != 0 {
+			for j := i; j < len(self.childCounts); j |= j + 1 {
+				self.childCounts[j] += delta
+			}
+		}
+	}
+}
+
+// NumKeysBefore Number of keys under the buckets before bucketID. Runs in O(log NumChildren)
+func (self *ModelNode) NumKeysBefore(bucketID int) int {
+	numKeys := 0
+	for i := bucketID - 1; i >= 0; i = i&(i+1) - 1 {
+		numKeys += self.childCounts[i]
+	}
+	return numKeys
+}
+
+// SelectChild Returns the first bucket of the child that holds the k-th smallest key under the node, counting
+// from 0, and the rank of that key in the child. Returns NumChildren if k is not smaller than NumKeys.
+// Runs in O(log NumChildren)
+func (self *ModelNode) SelectChild(k int) (int, int) {
+	position := 0
+	for step := 1 << bits.Len(uint(len(self.childCounts))) >> 1; step > 0; step >>= 1 {
+		if next := position + step; next <= len(self.childCounts) && self.childCounts[next-1] <= k {
+			position = next
+			k -= self.childCounts[next-1]
+		}
+	}
+	return position, k
+}
@@ -5,9 +5,30 @@ import (
 	"alex_go/cost_models"
 	"alex_go/linear_model"
 	"alex_go/shared"
+	"fmt"
 	"unsafe"
 )
 
+// ChangeLog Inserts and payload updates made into a data node, in order, so that they can be replayed on a
+// rebuilt copy
+type ChangeLog struct {
+	Keys     []shared.KeyType
+	Payloads []shared.PayloadType
+	// Whether each entry overwrote the payload of an existing key instead of inserting it
+	IsUpdate []bool
+	// Set when the node went through a change that cannot be replayed, such as an erase
+	Invalid bool
+}
+
+func (self *ChangeLog) record(key shared.KeyType, payload shared.PayloadType, isUpdate bool) {
+	if self == nil {
+		return
+	}
+	self.Keys = append(self.Keys, key)
+	self.Payloads = append(self.Payloads, payload)
+	self.IsUpdate = append(self.IsUpdate, isUpdate)
+}
+
 type DataNode struct {
 	// Parameters from the Node interface
 	DuplicationFactor int
@@ -18,10 +39,17 @@ type DataNode struct {
 	NextLeaf *DataNode
 	PrevLeaf *DataNode
 
-	// Holds the keys
+	// Holds the keys, nil with the InterleavedSlots layout
 	Keys []shared.KeyType
-	// Holds the payloads
+	// Holds the payloads, nil if the node is keys-only or with the InterleavedSlots layout
 	Payloads []shared.PayloadType
+	// KeysOnly Whether the node stores keys without payloads, as in a set
+	KeysOnly bool
+	// Holds the keys and payloads instead of Keys and Payloads with the InterleavedSlots layout, nil otherwise.
+	// Access slots with KeyAt and PayloadAt, which work with either layout
+	Slots []Slot
+	// How the node stores its keys and payloads, shared with the owning index
+	SlotLayout SlotLayout
 
 	// Size of key/data_slots array
 	DataCapacity int
@@ -37,6 +65,12 @@ type DataNode struct {
 	ExpansionThreshold float64
 	// Contract after m_num_keys is < this number
 	ContractionThreshold float64
+	// Density after expanding, also determines the contraction threshold. KMinDensity unless the index is under
+	// memory pressure
+	MinDensity float64
+	// Density after contracting, also determines the expansion threshold. KMaxDensity unless the index is under
+	// memory pressure
+	MaxDensity float64
 
 	// -- Counters used in Cost models --
 	// Does not reset after resizing
@@ -49,6 +83,11 @@ type DataNode struct {
 	NumInserts int
 	// Technically not required, but nice to have
 	NumResizes int
+	// Slots written into the new slots of resizes, keys, payloads and the gaps they fill
+	NumResizeWrites int64
+	// Decaying estimate of the fraction of inserts among recent operations on this node,
+	// carried over to the nodes created when this node splits
+	Workload cost_models.InsertFracEstimator
 
 	// -- Variables for determining append-mostly behavior --
 	// Max key in node, updates after inserts but not erases
@@ -60,6 +99,12 @@ type DataNode struct {
 	// Number of inserts that are smaller than the min key
 	NumLeftOutOfBoundsInserts int
 
+	// -- Model error bounds --
+	// Smallest and largest signed error, actual position minus predicted position, of the keys placed since the
+	// model was trained. Erases leave them unchanged, so that they still bound the errors of the remaining keys
+	MinError int
+	MaxError int
+
 	// -- Benchmarks --
 	ExpectedAvgExpSearchIterations float64
 	ExpectedAvgShifts              float64
@@ -67,6 +112,27 @@ type DataNode struct {
 	CurrentIteratorPosition int
 
 	MaxSlots int
+
+	// Records the inserts made while a copy of the node is rebuilt elsewhere, nil otherwise
+	ChangeLog *ChangeLog
+
+	// Minimum number of keys migrated per operation while an incremental resize is running, more are migrated if
+	// the node would otherwise expand again before the migration finishes.
+	// 0 means resizes move every key in one go
+	IncrementalResizeChunk int
+	// Old slots of the node while an incremental resize is running, nil otherwise
+	migration *resizeMigration
+
+	// Weighs the counters above into costs, shared with the owning index
+	CostModel cost_models.CostModel
+
+	// How the node searches around predicted positions, shared with the owning index. AdaptiveSearch lets the node
+	// select it from the error of its model
+	SearchStrategy SearchStrategy
+	// Strategy selected by an adaptive node, see selectSearchStrategy
+	selectedSearchStrategy SearchStrategy
+	// How the node makes room for keys inserted into filled slots, shared with the owning index
+	Layout DataNodeLayout
 }
 
 func (self *DataNode) GetCost() float64 {
@@ -102,7 +168,18 @@ func (self *DataNode) SetLinearModel(linearModel linear_model.LinearModel) {
 }
 
 func (self *DataNode) GetNodeSize() int64 {
-	return int64(unsafe.Sizeof(*self))
+	size := int64(unsafe.Sizeof(*self))
+	size += int64(cap(self.Keys)) * int64(shared.KeySize)
+	size += int64(cap(self.Payloads)) * int64(shared.PayloadSize)
+	size += int64(cap(self.Slots)) * int64(unsafe.Sizeof(Slot{}))
+	if self.Bitmap != nil {
+		size += self.Bitmap.SizeInBytes()
+	}
+	if self.migration != nil {
+		// The old slots are held until the migration finishes
+		size += self.migration.source.GetNodeSize()
+	}
+	return size
 }
 
 func (self *DataNode) IsAppendMostlyRight() bool {
@@ -119,7 +196,7 @@ func (self *DataNode) IsAppendMostlyLeft() bool {
 func (self *DataNode) BinarySearchUpperBound(l int, r int, key shared.KeyType) int {
 	for l < r {
 		m := l + (r-l)/2
-		if self.Keys[m] <= key {
+		if self.KeyAt(m) <= key {
 			l = m + 1
 		} else {
 			r = m
@@ -134,7 +211,7 @@ func (self *DataNode) BinarySearchUpperBound(l int, r int, key shared.KeyType) i
 func (self *DataNode) BinarySearchLowerBound(l int, r int, key shared.KeyType) int {
 	for l < r {
 		m := l + (r-l)/2
-		if self.Keys[m] >= key {
+		if self.KeyAt(m) >= key {
 			r = m
 		} else {
 			l = m + 1
@@ -146,19 +223,26 @@ func (self *DataNode) BinarySearchLowerBound(l int, r int, key shared.KeyType) i
 // Searches for the first position greater than key, starting from position m
 // Returns position in range [0, data_capacity]
 func (self *DataNode) ExponentialSearchUpperBound(m int, key shared.KeyType) int {
+	return self.exponentialSearchUpperBound(m, key, 0, self.DataCapacity)
+}
+
+// Searches for the first position greater than key in positions [start, end), starting from position m in that
+// range
+// Returns position in range [start, end]
+func (self *DataNode) exponentialSearchUpperBound(m int, key shared.KeyType, start int, end int) int {
 	bound := 1
 	var l, r int
-	if self.Keys[m] > key {
-		size := m
-		for bound < size && self.Keys[m-bound] > key {
+	if self.KeyAt(m) > key {
+		size := m - start
+		for bound < size && self.KeyAt(m-bound) > key {
 			bound *= 2
 			self.NumExpSearchIterations++
 		}
 		l = m - min(bound, size)
 		r = m - bound/2
 	} else {
-		size := self.DataCapacity - m
-		for bound < size && self.Keys[m+bound] <= key {
+		size := end - m
+		for bound < size && self.KeyAt(m+bound) <= key {
 			bound *= 2
 			self.NumExpSearchIterations++
 		}
@@ -171,19 +255,26 @@ func (self *DataNode) ExponentialSearchUpperBound(m int, key shared.KeyType) int
 // Searches for the first position no less than key, starting from position m
 // Returns position in range [0, data_capacity]
 func (self *DataNode) ExponentialSearchLowerBound(m int, key shared.KeyType) int {
+	return self.exponentialSearchLowerBound(m, key, 0, self.DataCapacity)
+}
+
+// Searches for the first position no less than key in positions [start, end), starting from position m in that
+// range
+// Returns position in range [start, end]
+func (self *DataNode) exponentialSearchLowerBound(m int, key shared.KeyType, start int, end int) int {
 	bound := 1
 	var l, r int
-	if self.Keys[m] >= key {
-		size := m
-		for bound < size && self.Keys[m-bound] >= key {
+	if self.KeyAt(m) >= key {
+		size := m - start
+		for bound < size && self.KeyAt(m-bound) >= key {
 			bound *= 2
 			self.NumExpSearchIterations++
 		}
 		l = m - min(bound, size)
 		r = m - bound/2
 	} else {
-		size := self.DataCapacity - m
-		for bound < size && self.Keys[m+bound] < key {
+		size := end - m
+		for bound < size && self.KeyAt(m+bound) < key {
 			bound *= 2
 			self.NumExpSearchIterations++
 		}
@@ -197,10 +288,15 @@ func (self *DataNode) ExponentialSearchLowerBound(m int, key shared.KeyType) int
 // This could be the position for a gap (i.e., its bit in the Bitmap is 0)
 // Returns position in range [0, data_capacity]
 // Compare with find_upper()
+// While an incremental resize runs, this and the other lookups returning positions search both slots and return
+// positions of SlotsAt, without finishing the resize
 func (self *DataNode) UpperBound(key shared.KeyType) int {
+	if self.migration != nil {
+		return self.migrationBound(key, true)
+	}
 	self.NumLookups++
 	position := self.PredictPosition(key)
-	return self.ExponentialSearchUpperBound(position, key)
+	return self.searchUpperBound(position, key)
 }
 
 // LowerBound Searches for the first position no less than key
@@ -208,18 +304,24 @@ func (self *DataNode) UpperBound(key shared.KeyType) int {
 // Returns position in range [0, data_capacity]
 // Compare with find_lower()
 func (self *DataNode) LowerBound(key shared.KeyType) int {
+	if self.migration != nil {
+		return self.migrationBound(key, false)
+	}
 	self.NumLookups++
 	position := self.PredictPosition(key)
-	return self.ExponentialSearchLowerBound(position, key)
+	return self.searchLowerBound(position, key)
 }
 
 // FindUpper Searches for the first non-gap position greater than key
 // Returns position in range [0, data_capacity]
 // Compare with upper_bound()
 func (self *DataNode) FindUpper(key shared.KeyType) int {
+	if self.migration != nil {
+		return self.nextMigrationPosition(self.migrationBound(key, true))
+	}
 	self.NumLookups++
 	position := self.PredictPosition(key)
-	pos := self.ExponentialSearchUpperBound(position, key)
+	pos := self.searchUpperBound(position, key)
 	return self.GetNextFilledPosition(pos, false)
 }
 
@@ -227,9 +329,12 @@ func (self *DataNode) FindUpper(key shared.KeyType) int {
 // Returns position in range [0, data_capacity]
 // Compare with lower_bound()
 func (self *DataNode) FindLower(key shared.KeyType) int {
+	if self.migration != nil {
+		return self.nextMigrationPosition(self.migrationBound(key, false))
+	}
 	self.NumLookups++
 	position := self.PredictPosition(key)
-	pos := self.ExponentialSearchLowerBound(position, key)
+	pos := self.searchLowerBound(position, key)
 	return self.GetNextFilledPosition(pos, false)
 }
 
@@ -237,10 +342,108 @@ func (self *DataNode) FindLower(key shared.KeyType) int {
 // If no positions equal to key, returns -1
 func (self *DataNode) FindKeyPosition(key shared.KeyType) (int, error) {
 	self.NumLookups++
+	self.Workload.RecordLookup()
+	self.migrateChunk()
+	if self.migration == nil {
+		return self.findPositionInSlots(key)
+	}
+	if self.slotsFor(key) == self {
+		return self.findMigratedPosition(key)
+	}
+	position, err := self.migration.source.findPositionInSlots(key)
+	return self.DataCapacity + position, err
+}
+
+// RecordLookup Counts a lookup in the workload of the node
+func (self *DataNode) RecordLookup() {
+	self.Workload.RecordLookup()
+}
+
+// FindPayload Returns a pointer to the payload of the last key equal to key
+func (self *DataNode) FindPayload(key shared.KeyType) (*shared.PayloadType, error) {
+	self.RecordLookup()
+	return self.LocatePayload(key)
+}
+
+// LocatePayload Like FindPayload, without recording the lookup in the workload. The search is still counted in
+// NumLookups, which averages the search iterations.
+func (self *DataNode) LocatePayload(key shared.KeyType) (*shared.PayloadType, error) {
+	self.NumLookups++
+	self.migrateChunk()
+	slots := self.slotsFor(key)
+	var position int
+	var err error
+	if slots == self && self.migration != nil {
+		position, err = self.findMigratedPosition(key)
+	} else {
+		position, err = slots.findPositionInSlots(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if slots.KeysOnly {
+		var payload shared.PayloadType
+		return &payload, nil
+	}
+	return slots.payloadPointer(position), nil
+}
+
+// PayloadAt Payload stored at position, the zero payload if the node is keys-only
+func (self *DataNode) PayloadAt(position int) shared.PayloadType {
+	if self.KeysOnly {
+		var payload shared.PayloadType
+		return payload
+	}
+	if self.Slots != nil {
+		return self.Slots[position].Payload
+	}
+	return self.Payloads[position]
+}
+
+// Allocates the payload slots of a node with the given capacity, none if the node is keys-only
+func (self *DataNode) newPayloadSlots(dataCapacity int) []shared.PayloadType {
+	if self.KeysOnly {
+		return nil
+	}
+	return make([]shared.PayloadType, dataCapacity)
+}
+
+// UpdatePayload Replaces the payload of the last key equal to key with the one returned by update, unless
+// update declines the change by returning false
+func (self *DataNode) UpdatePayload(key shared.KeyType, update func(shared.PayloadType) (shared.PayloadType, bool)) error {
+	self.RecordLookup()
+	return self.ReplacePayload(key, update)
+}
+
+// ReplacePayload Like UpdatePayload, without recording the lookup in the workload
+func (self *DataNode) ReplacePayload(key shared.KeyType, update func(shared.PayloadType) (shared.PayloadType, bool)) error {
+	slot, err := self.LocatePayload(key)
+	if err != nil {
+		return err
+	}
+	payload, store := update(*slot)
+	if !store {
+		return nil
+	}
+	*slot = payload
+	self.ChangeLog.record(key, payload, true)
+	return nil
+}
+
+func (self *DataNode) findPositionInSlots(key shared.KeyType) (int, error) {
 	predictedPosition := self.PredictPosition(key)
 
-	position := self.ExponentialSearchUpperBound(predictedPosition, key) - 1
-	if position < 0 || self.Keys[position] != key {
+	upperBound := self.searchUpperBoundWithinErrorBounds(predictedPosition, key)
+	position := upperBound - 1
+	if key == shared.KEndSentinel && position >= 0 && !self.Bitmap.Contains(uint32(position)) {
+		// The trailing gaps hold KEndSentinel as well, look for the last key before them
+		position = -1
+		if numFilled := self.Bitmap.Rank(uint32(upperBound)); numFilled > 0 {
+			last, _ := self.Bitmap.Select(numFilled - 1)
+			position = int(last)
+		}
+	}
+	if position < 0 || self.KeyAt(position) != key {
 		return 0, shared.KeyNotFoundError
 	}
 
@@ -248,14 +451,14 @@ func (self *DataNode) FindKeyPosition(key shared.KeyType) (int, error) {
 }
 
 func (self *DataNode) InsertElementAt(key shared.KeyType, payload shared.PayloadType, pos int) {
-	self.Keys[pos] = key
-	self.Payloads[pos] = payload
+	self.setSlot(pos, key, payload)
 	self.Bitmap.Set(uint32(pos))
+	self.recordError(key, pos)
 
 	// Overwrite preceding gaps until we reach the previous element
 	pos--
 	for pos >= 0 && !self.Bitmap.Contains(uint32(pos)) {
-		self.Keys[pos] = key
+		self.setKey(pos, key)
 		pos--
 	}
 }
@@ -300,6 +503,28 @@ func (self *DataNode) PredictPosition(key shared.KeyType) int {
 	return position
 }
 
+// Widens the error bounds of the model to the error of key placed at position
+func (self *DataNode) recordError(key shared.KeyType, position int) {
+	err := position - self.PredictPosition(key)
+	self.MinError = min(self.MinError, err)
+	self.MaxError = max(self.MaxError, err)
+}
+
+// Widens the error bounds of the model to the errors of the keys shifted into positions [start, end), which are all
+// filled
+func (self *DataNode) recordShiftedErrors(start int, end int) {
+	for position := start; position < end; position++ {
+		self.recordError(self.KeyAt(position), position)
+	}
+}
+
+// ErrorWindow Positions [left, right) that hold key if it is in the node, from its predicted position and the error
+// bounds of the model
+func (self *DataNode) ErrorWindow(key shared.KeyType) (int, int) {
+	predictedPosition := self.PredictPosition(key)
+	return max(predictedPosition+self.MinError, 0), min(predictedPosition+self.MaxError+1, self.DataCapacity)
+}
+
 // Finds position to insert a key.
 // First returned value takes prediction into account.
 // Second returned value is first valid position (i.e., upper_bound of key).
@@ -309,7 +534,7 @@ func (self *DataNode) FindInsertPosition(key shared.KeyType) (int, int) {
 	predictedPosition := self.PredictPosition(key) // first use model to get prediction
 
 	// insert to the right of duplicate keys
-	pos := self.ExponentialSearchUpperBound(predictedPosition, key)
+	pos := self.searchUpperBound(predictedPosition, key)
 	if predictedPosition <= pos || self.Bitmap.Contains(uint32(pos)) {
 		return pos, pos
 	} else {
@@ -318,30 +543,26 @@ func (self *DataNode) FindInsertPosition(key shared.KeyType) (int, int) {
 }
 
 // Insert key into pos, shifting as necessary in the range [left, right)
-// Returns the actual position of insertion
-func (self *DataNode) InsertUsingShifts(key shared.KeyType, payload shared.PayloadType, pos int) int {
+// Returns the actual position of insertion, or NoGapFoundError if the node is full, in which case it is unchanged
+func (self *DataNode) InsertUsingShifts(key shared.KeyType, payload shared.PayloadType, pos int) (int, error) {
 	gapPos, err := self.ClosestGap(pos)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("%w: inserting key %d into a data node of %d slots", err, key, self.DataCapacity)
 	}
 	self.Bitmap.Set(uint32(gapPos))
 
 	if gapPos >= pos {
-		for i := gapPos; i > pos; i-- {
-			self.Keys[i] = self.Keys[i-1]
-			self.Payloads[i] = self.Payloads[i-1]
-		}
+		self.moveSlots(pos+1, pos, gapPos-pos)
+		self.recordShiftedErrors(pos+1, gapPos+1)
 		self.InsertElementAt(key, payload, pos)
 		self.NumShifts += int64(gapPos - pos)
-		return pos
+		return pos, nil
 	} else {
-		for i := gapPos; i < pos-1; i++ {
-			self.Keys[i] = self.Keys[i+1]
-			self.Payloads[i] = self.Payloads[i+1]
-		}
+		self.moveSlots(gapPos, gapPos+1, pos-1-gapPos)
+		self.recordShiftedErrors(gapPos, pos-1)
 		self.InsertElementAt(key, payload, pos-1)
 		self.NumShifts += int64(pos - gapPos - 1)
-		return pos - 1
+		return pos - 1, nil
 	}
 }
 
@@ -402,9 +623,10 @@ func (self *DataNode) EmpiricalCost() float64 {
 	if numOps == 0 {
 		return 0.0
 	}
-	fracInserts := float64(self.NumInserts) / float64(numOps)
-	return shared.KExpSearchIterationsWeight*self.ExpSearchIterationsPerOperation() +
-		shared.KShiftsWeight*self.ShiftsPerInserts()*fracInserts
+	// Favour the recent workload over the lifetime counters so that a node that became read-hot is
+	// judged on its lookups
+	fracInserts := self.Workload.InsertFrac(float64(self.NumInserts) / float64(numOps))
+	return self.CostModel.DataNodeCost(self.ExpSearchIterationsPerOperation(), self.ShiftsPerInserts(), fracInserts)
 }
 
 // SignificantCostDeviation Whether empirical Cost deviates significantly from expected Cost
@@ -412,7 +634,7 @@ func (self *DataNode) EmpiricalCost() float64 {
 // splitting
 func (self *DataNode) SignificantCostDeviation() bool {
 	empiricalCost := self.EmpiricalCost()
-	return self.LinearModel.A != 0.0 && empiricalCost > shared.KNodeLookupsWeight && empiricalCost > 1.5*self.Cost
+	return self.LinearModel.A != 0.0 && empiricalCost > self.CostModel.NodeLookupsWeight() && empiricalCost > 1.5*self.Cost
 }
 
 func (self *DataNode) ComputeExpectedCost(fracInserts float64) float64 {
@@ -431,43 +653,49 @@ func (self *DataNode) ComputeExpectedCost(fracInserts float64) float64 {
 	expectedAvgExpSearchIterations := searchIterationsAccumaulator.GetStats()
 	expectedAvgShifts := shiftsAccumulator.GetStats()
 
-	return shared.KExpSearchIterationsWeight*expectedAvgExpSearchIterations + shared.KShiftsWeight*expectedAvgShifts*fracInserts
+	return self.CostModel.DataNodeCost(expectedAvgExpSearchIterations, expectedAvgShifts, fracInserts)
 }
 
+// EraseRange Erases the keys in [startKey, endKey), or [startKey, endKey] if endKeyInclusive, and returns how many
+// were erased. A running incremental resize is not finished, the node contracts on a later erase
 func (self *DataNode) EraseRange(startKey shared.KeyType, endKey shared.KeyType, endKeyInclusive bool) int {
-	var pos int
-	if endKeyInclusive {
-		pos = self.UpperBound(endKey)
-	} else {
-		pos = self.LowerBound(endKey)
-	}
-
-	if pos == 0 {
-		return 0
-	}
-
 	numErased := 0
-	var nextKey shared.KeyType
-	if pos == self.DataCapacity {
-		nextKey = shared.KEndSentinel
+	if self.migration != nil {
+		numErased = self.eraseDuringMigration(startKey, endKey, endKeyInclusive)
 	} else {
-		nextKey = self.Keys[pos]
-	}
-	pos--
+		var pos int
+		if endKeyInclusive {
+			pos = self.UpperBound(endKey)
+		} else {
+			pos = self.LowerBound(endKey)
+		}
 
-	for pos >= 0 && self.Keys[pos] >= startKey {
-		self.Keys[pos] = nextKey
-		self.Bitmap.Remove(uint32(pos))
-		if self.Bitmap.Contains(uint32(pos)) {
-			numErased++
+		var nextKey shared.KeyType
+		if pos == self.DataCapacity {
+			nextKey = shared.KEndSentinel
+		} else {
+			nextKey = self.KeyAt(pos)
 		}
 		pos--
+
+		for pos >= 0 && self.KeyAt(pos) >= startKey {
+			self.setKey(pos, nextKey)
+			if self.Bitmap.Remove(uint32(pos)) {
+				numErased++
+			}
+			pos--
+		}
 	}
 
 	self.NumKeys -= numErased
+	if self.ChangeLog != nil && numErased > 0 {
+		self.ChangeLog.Invalid = true
+	}
 
-	if float64(self.NumKeys) < self.ContractionThreshold {
-		self.Resize(shared.KMinDensity, false, false, false)
+	if self.migration == nil && float64(self.NumKeys) < self.ContractionThreshold {
+		// Contracting to the density after expanding would leave the node at its contraction threshold, and the
+		// next erase would resize it again
+		self.StartResize(self.MaxDensity, false, false, false)
 		self.NumResizes++
 	}
 
@@ -487,25 +715,43 @@ func (self *DataNode) Insert(key shared.KeyType, payload shared.PayloadType) (in
 		if self.CatastrophicCost() {
 			return 0, shared.CatastrophicCostInsertionError
 		}
-		if float64(self.NumKeys) > float64(self.MaxSlots)*shared.KMinDensity {
+	}
+
+	return self.InsertInPlace(key, payload)
+}
+
+// InsertInPlace Inserts without consulting the cost model: a full node is always expanded in place, unless
+// it already reached its maximum number of slots.
+// While an incremental resize runs, the returned position may refer to the old slots
+func (self *DataNode) InsertInPlace(key shared.KeyType, payload shared.PayloadType) (int, error) {
+	if float64(self.NumKeys) >= self.ExpansionThreshold {
+		// The new slots of a running resize are full as well
+		self.FinishResize()
+		if float64(self.NumKeys) > float64(self.MaxSlots)*self.MinDensity {
 			return 0, shared.MaxCapacityInsertionError
 		}
 		keepLeft := self.IsAppendMostlyRight()
 		keepRight := self.IsAppendMostlyLeft()
-		self.Resize(shared.KMinDensity, false, keepLeft, keepRight)
+		self.StartResize(self.MinDensity, false, keepLeft, keepRight)
 		self.NumResizes++
 	}
 
-	insertionPosition, _ := self.FindInsertPosition(key)
-
-	if insertionPosition < self.DataCapacity && !self.Bitmap.Contains(uint32(insertionPosition)) {
-		self.InsertElementAt(key, payload, insertionPosition)
+	var insertionPosition int
+	var err error
+	self.migrateChunk()
+	if self.migration != nil {
+		insertionPosition, err = self.insertDuringMigration(key, payload)
 	} else {
-		insertionPosition = self.InsertUsingShifts(key, payload, insertionPosition)
+		insertionPosition, err = self.insertIntoSlots(key, payload)
+	}
+	if err != nil {
+		return 0, err
 	}
 
 	self.NumKeys++
 	self.NumInserts++
+	self.ChangeLog.record(key, payload, false)
+	self.Workload.RecordInsert()
 	if key > self.MaxKey {
 		self.MaxKey = key
 		self.NumRightOutOfBoundsInserts++
@@ -517,119 +763,252 @@ func (self *DataNode) Insert(key shared.KeyType, payload shared.PayloadType) (in
 	return insertionPosition, nil
 }
 
-func (self *DataNode) Resize(targetDensity float64, forceRetrain bool, keepLeft bool, keepRight bool) {
-	if self.NumKeys == 0 {
-		return
+// Inserts into the slots of the node, shifting or rebalancing depending on the layout if the insert position is not
+// a gap
+func (self *DataNode) insertIntoSlots(key shared.KeyType, payload shared.PayloadType) (int, error) {
+	insertionPosition, _ := self.FindInsertPosition(key)
+
+	if insertionPosition < self.DataCapacity && !self.Bitmap.Contains(uint32(insertionPosition)) {
+		self.InsertElementAt(key, payload, insertionPosition)
+		return insertionPosition, nil
+	}
+	if self.Layout == PackedMemoryArrayLayout {
+		return self.insertUsingRebalance(key, payload, insertionPosition)
 	}
+	return self.InsertUsingShifts(key, payload, insertionPosition)
+}
 
-	newDataCapacity := max(int(float64(self.NumKeys)/targetDensity), self.NumKeys+1)
-	newKeySlots := make([]shared.KeyType, newDataCapacity)
-	newPayloadSlots := make([]shared.PayloadType, newDataCapacity)
-	newBitmap := shared.NewBitmap(newDataCapacity)
+// ReserveCapacity Resizes the node once so that numKeys more keys can be inserted before it reaches its expansion
+// threshold. Returns false if the node is empty or would exceed its maximum number of slots.
+// The resize runs in one go, as the root expansion that reserves capacity reads the slots right after
+func (self *DataNode) ReserveCapacity(numKeys int) bool {
+	required := self.NumKeys + numKeys
+	if float64(required) < self.ExpansionThreshold {
+		return true
+	}
+	if self.NumKeys == 0 || float64(required) > float64(self.MaxSlots)*self.MinDensity {
+		return false
+	}
+	targetDensity := self.MinDensity * float64(self.NumKeys) / float64(required)
+	self.Resize(targetDensity, false, self.IsAppendMostlyRight(), self.IsAppendMostlyLeft())
+	self.NumResizes++
+	return true
+}
 
-	if self.NumKeys < shared.NumKeysDataNodeRetrainThreshold || forceRetrain {
-		linearModelBuilder := linear_model.NewLinearModelBuilder(&self.LinearModel)
-		self.IterateFilledPositions(func(key shared.KeyType, payload shared.PayloadType, i int, j int) {
-			linearModelBuilder.Add(float64(key), float64(j))
-		}, 0, self.DataCapacity)
-		linearModelBuilder.Build()
+// Resize Moves the keys into newly allocated slots sized for targetDensity, in one go.
+// Only the paths that read all the slots of the node right after stay synchronous: ReserveCapacity and the rebuilds
+// of the maintenance goroutine. Expansions, contractions and retrains go through StartResize
+func (self *DataNode) Resize(targetDensity float64, forceRetrain bool, keepLeft bool, keepRight bool) {
+	self.StartIncrementalResize(targetDensity, forceRetrain, keepLeft, keepRight)
+	self.FinishResize()
+}
 
-		if keepLeft {
-			self.LinearModel.Expand(float64(self.DataCapacity) / float64(self.NumKeys))
-		} else if keepRight {
-			self.LinearModel.Expand(float64(self.DataCapacity) / float64(self.NumKeys))
-			self.LinearModel.B += float64(newDataCapacity - self.DataCapacity)
-		} else {
-			self.LinearModel.Expand(float64(newDataCapacity) / float64(self.NumKeys))
-		}
+// StartResize Resizes the node like Resize, incrementally if IncrementalResizeChunk is set
+func (self *DataNode) StartResize(targetDensity float64, forceRetrain bool, keepLeft bool, keepRight bool) {
+	if self.IncrementalResizeChunk > 0 {
+		self.StartIncrementalResize(targetDensity, forceRetrain, keepLeft, keepRight)
 	} else {
-		if keepRight {
-			self.LinearModel.B += float64(newDataCapacity - self.DataCapacity)
-		} else if !keepLeft {
-			self.LinearModel.Expand(float64(newDataCapacity) / float64(self.DataCapacity))
-		}
+		self.Resize(targetDensity, forceRetrain, keepLeft, keepRight)
 	}
+}
 
-	lastPosition := -1
-	keysRemaining := self.NumKeys
-	i := self.GetNextFilledPosition(0, false)
-	for i < self.DataCapacity {
-		position := self.LinearModel.Predict(float64(self.Keys[i]))
-		position = max(position, lastPosition+1)
-
-		positionsRemaining := newDataCapacity - position
-		if positionsRemaining < keysRemaining {
-			// fill the rest of the store contiguously
-			pos := newDataCapacity - keysRemaining
-
-			for j := lastPosition + 1; j < pos; j++ {
-				newKeySlots[j] = self.Keys[i]
-			}
-
-			for pos < newDataCapacity {
-				newKeySlots[pos] = self.Keys[i]
-				newPayloadSlots[pos] = self.Payloads[i]
-				newBitmap.Set(uint32(pos))
+func (self *DataNode) IterateFilledPositions(yield func(shared.KeyType, shared.PayloadType, int, int), start int, end int) {
+	self.FinishResize()
+	start, end = max(start, 0), min(self.DataCapacity, end)
+	if start >= end {
+		return
+	}
+	j := 0
+	self.Bitmap.Range(uint32(start), uint32(end), func(position uint32) bool {
+		i := int(position)
+		yield(self.KeyAt(i), self.PayloadAt(i), i, j)
+		j++
+		return true
+	})
+}
 
-				i = self.GetNextFilledPosition(i+1, false)
-				pos++
+// IterateFilledPositionsReverse Calls yield for every key in positions [start, end) from the last to the first,
+// stops as soon as yield returns false. Returns false if yield stopped the iteration
+// While an incremental resize runs, start, end and the positions yielded are positions of SlotsAt
+func (self *DataNode) IterateFilledPositionsReverse(yield func(shared.KeyType, shared.PayloadType, int) bool, start int, end int) bool {
+	if migration := self.migration; migration != nil {
+		source := migration.source
+		sourceStart, sourceEnd := max(start-self.DataCapacity, migration.cursor), min(end-self.DataCapacity, source.DataCapacity)
+		if sourceStart < sourceEnd {
+			completed := true
+			source.Bitmap.RangeReverse(uint32(sourceStart), uint32(sourceEnd), func(position uint32) bool {
+				i := int(position)
+				completed = yield(source.KeyAt(i), source.PayloadAt(i), self.DataCapacity+i)
+				return completed
+			})
+			if !completed {
+				return false
 			}
-
-			lastPosition = pos - 1
-			break
-		}
-
-		for j := lastPosition + 1; j < position; j++ {
-			newKeySlots[j] = self.Keys[i]
 		}
+		// The new slots are only filled up to the last migrated key
+		end = min(end, migration.lastPosition+1)
+	}
+	start, end = max(start, 0), min(self.DataCapacity, end)
+	if start >= end {
+		return true
+	}
+	completed := true
+	self.Bitmap.RangeReverse(uint32(start), uint32(end), func(position uint32) bool {
+		i := int(position)
+		completed = yield(self.KeyAt(i), self.PayloadAt(i), i)
+		return completed
+	})
+	return completed
+}
 
-		newKeySlots[position] = self.Keys[i]
-		newPayloadSlots[position] = self.Payloads[i]
-		newBitmap.Set(uint32(position))
+// Calls yield for every key in positions [start, end) with its payload, stops as soon as yield returns false.
+// Returns false if yield stopped the iteration
+func (self *DataNode) rangeFilled(start int, end int, yield func(shared.KeyType, shared.PayloadType) bool) bool {
+	completed := true
+	if start < end {
+		self.Bitmap.Range(uint32(start), uint32(end), func(position uint32) bool {
+			completed = yield(self.KeyAt(int(position)), self.PayloadAt(int(position)))
+			return completed
+		})
+	}
+	return completed
+}
 
-		lastPosition = position
-		keysRemaining--
+// Same as rangeFilled, from the last position to the first
+func (self *DataNode) rangeFilledReverse(start int, end int, yield func(shared.KeyType, shared.PayloadType) bool) bool {
+	completed := true
+	if start < end {
+		self.Bitmap.RangeReverse(uint32(start), uint32(end), func(position uint32) bool {
+			completed = yield(self.KeyAt(int(position)), self.PayloadAt(int(position)))
+			return completed
+		})
+	}
+	return completed
+}
 
-		i = self.GetNextFilledPosition(i+1, false)
+// Ascend Calls yield for every key no less than from in ascending order, with its payload. Stops as soon as yield
+// returns false and returns false if it did
+func (self *DataNode) Ascend(from shared.KeyType, yield func(shared.KeyType, shared.PayloadType) bool) bool {
+	migration := self.migration
+	if migration == nil {
+		return self.rangeFilled(self.LowerBound(from), self.DataCapacity, yield)
+	}
+	if !self.rangeFilled(self.migratedLowerBound(from), migration.lastPosition+1, yield) {
+		return false
 	}
+	return migration.source.rangeFilled(migration.sourceBound(from, false), migration.source.DataCapacity, yield)
+}
 
-	for i = lastPosition + 1; i < newDataCapacity; i++ {
-		newKeySlots[i] = shared.KEndSentinel
+// Descend Calls yield for every key smaller than key, or smaller than or equal to key if inclusive, in descending
+// order, with its payload. Stops as soon as yield returns false and returns false if it did
+func (self *DataNode) Descend(key shared.KeyType, inclusive bool, yield func(shared.KeyType, shared.PayloadType) bool) bool {
+	migration := self.migration
+	if migration == nil {
+		end := self.LowerBound(key)
+		if inclusive {
+			end = self.UpperBound(key)
+		}
+		return self.rangeFilledReverse(0, end, yield)
+	}
+	if !migration.source.rangeFilledReverse(migration.cursor, migration.sourceBound(key, inclusive), yield) {
+		return false
+	}
+	end := self.migratedLowerBound(key)
+	if inclusive {
+		end = self.migratedUpperBound(key)
 	}
+	return self.rangeFilledReverse(0, end, yield)
+}
 
-	self.DataCapacity = newDataCapacity
-	self.Keys = newKeySlots
-	self.Payloads = newPayloadSlots
-	self.Bitmap = newBitmap
-	self.ExpansionThreshold = min(max(float64(self.DataCapacity)*shared.KMaxDensity, float64(self.NumKeys+1)), float64(self.DataCapacity))
-	self.ContractionThreshold = float64(self.DataCapacity) * shared.KMinDensity
+// CountBefore Number of keys smaller than key, or smaller than or equal to key if inclusive
+func (self *DataNode) CountBefore(key shared.KeyType, inclusive bool) int {
+	if self.NumKeys == 0 {
+		return 0
+	}
+	migration := self.migration
+	if migration == nil {
+		if inclusive {
+			return self.NumKeysInRange(0, self.UpperBound(key))
+		}
+		return self.NumKeysInRange(0, self.LowerBound(key))
+	}
+	end := self.migratedLowerBound(key)
+	if inclusive {
+		end = self.migratedUpperBound(key)
+	}
+	count := self.Bitmap.CountRange(0, uint32(end))
+	if sourceEnd := migration.sourceBound(key, inclusive); sourceEnd > migration.cursor {
+		count += migration.source.Bitmap.CountRange(uint32(migration.cursor), uint32(sourceEnd))
+	}
+	return count
 }
 
-func (self *DataNode) IterateFilledPositions(yield func(shared.KeyType, shared.PayloadType, int, int), start int, end int) {
-	j := 0
-	for i := max(start, 0); i < min(self.DataCapacity, end); i++ {
-		if self.Bitmap.Contains(uint32(i)) {
-			key := self.Keys[i]
-			payload := self.Payloads[i]
-			yield(key, payload, i, j)
-			j++
+// SelectKey Returns the k-th smallest key of the node, counting from 0, with its payload. Returns false if k is out
+// of range
+func (self *DataNode) SelectKey(k int) (shared.KeyType, shared.PayloadType, bool) {
+	var noPayload shared.PayloadType
+	if k < 0 {
+		return 0, noPayload, false
+	}
+	slots := self
+	if migration := self.migration; migration != nil {
+		if numMigrated := self.Bitmap.CountRange(0, uint32(migration.lastPosition+1)); k >= numMigrated {
+			slots = migration.source
+			k += slots.Bitmap.Rank(uint32(migration.cursor)) - numMigrated
 		}
 	}
+	position, ok := slots.Bitmap.Select(k)
+	if !ok {
+		return 0, noPayload, false
+	}
+	return slots.KeyAt(int(position)), slots.PayloadAt(int(position)), true
+}
+
+// Clone Deep copy of the node, detached from its neighbours. A running incremental resize is copied along and
+// finishes on the copy
+func (self *DataNode) Clone() *DataNode {
+	clone := *self
+	clone.NextLeaf = nil
+	clone.PrevLeaf = nil
+	clone.ChangeLog = nil
+	clone.allocateSlots(self.DataCapacity)
+	copy(clone.Keys, self.Keys)
+	copy(clone.Payloads, self.Payloads)
+	copy(clone.Slots, self.Slots)
+	clone.Bitmap = shared.NewBitmap(self.DataCapacity)
+	self.Bitmap.Range(0, uint32(self.DataCapacity), func(position uint32) bool {
+		clone.Bitmap.Set(position)
+		return true
+	})
+	if self.migration != nil {
+		migration := *self.migration
+		migration.source = self.migration.source.Clone()
+		clone.migration = &migration
+	}
+	return &clone
 }
 
 func (self *DataNode) GetFirstKey() shared.KeyType {
+	if self.migration != nil && self.migration.lastPosition < 0 {
+		// Nothing migrated yet, the first key is the next key to migrate
+		return self.migration.boundary()
+	}
 	for i := 0; i < self.DataCapacity; i++ {
 		if self.Bitmap.Contains(uint32(i)) {
-			return self.Keys[i]
+			return self.KeyAt(i)
 		}
 	}
 	return shared.MaxKey
 }
 
 func (self *DataNode) GetLastKey() shared.KeyType {
+	if self.migration != nil {
+		// The keys that are not migrated yet are the largest ones
+		return self.migration.source.GetLastKey()
+	}
 	for i := self.DataCapacity - 1; i >= 0; i-- {
 		if self.Bitmap.Contains(uint32(i)) {
-			return self.Keys[i]
+			return self.KeyAt(i)
 		}
 	}
 	return shared.MinKey
@@ -637,15 +1016,25 @@ func (self *DataNode) GetLastKey() shared.KeyType {
 }
 
 // Number of keys between positions left and right (exclusive) in
-// key/data_slots
+// key/data_slots, positions of SlotsAt while an incremental resize runs
 func (self *DataNode) NumKeysInRange(left int, right int) int {
-	numKeys := 0
-	for i := left; i < right; i++ {
-		if self.Bitmap.Contains(uint32(i)) {
-			numKeys++
+	if migration := self.migration; migration != nil {
+		count := 0
+		source := migration.source
+		if sourceLeft, sourceRight := max(left-self.DataCapacity, migration.cursor), min(right-self.DataCapacity, source.DataCapacity); sourceLeft < sourceRight {
+			count += source.Bitmap.CountRange(uint32(sourceLeft), uint32(sourceRight))
+		}
+		// The new slots are only filled up to the last migrated key
+		left, right = max(left, 0), min(right, migration.lastPosition+1)
+		if left < right {
+			count += self.Bitmap.CountRange(uint32(left), uint32(right))
 		}
+		return count
 	}
-	return numKeys
+	if left >= right {
+		return 0
+	}
+	return self.Bitmap.CountRange(uint32(left), uint32(right))
 }
 
 func (self *DataNode) ResetStats() {
@@ -654,6 +1043,7 @@ func (self *DataNode) ResetStats() {
 	self.NumLookups = 0
 	self.NumInserts = 0
 	self.NumResizes = 0
+	self.NumResizeWrites = 0
 }
 
 func (self *DataNode) IsLeaf() bool {
@@ -663,33 +1053,25 @@ func (self *DataNode) IsLeaf() bool {
 func (self *DataNode) Initialize(numKeys int, density float64) {
 	self.NumKeys = numKeys
 	self.DataCapacity = int(max(float64(numKeys)/density, float64(numKeys)+1))
-	self.Keys = make([]shared.KeyType, self.DataCapacity)
-	self.Payloads = make([]shared.PayloadType, self.DataCapacity)
+	self.allocateSlots(self.DataCapacity)
 	self.Bitmap = shared.NewBitmap(self.DataCapacity)
 }
 
-func (self *DataNode) BulkLoad(values []shared.PayloadType, numKeys int, preTrainedModel *linear_model.LinearModel, trainWithSample bool) {
-	self.Initialize(len(values), shared.KInitialDensity)
-
-	if numKeys == 0 {
-		self.ExpansionThreshold = float64(self.DataCapacity)
-		self.ContractionThreshold = 0.0
-		for i := 0; i < self.DataCapacity; i++ {
-			self.Keys[i] = shared.KEndSentinel
-		}
-		return
+// BulkLoad Only supports loading an empty node so far, returns NotImplementedError otherwise and leaves the node
+// unchanged
+func (self *DataNode) BulkLoad(values []shared.PayloadType, numKeys int, preTrainedModel *linear_model.LinearModel, trainWithSample bool) error {
+	if numKeys != 0 {
+		return fmt.Errorf("%w: bulk loading %d keys into a data node", shared.NotImplementedError, numKeys)
 	}
 
-	// Build model
-	if preTrainedModel == nil {
-		self.LinearModel.A = preTrainedModel.A
-		self.LinearModel.B = preTrainedModel.B
-	} else {
-		panic("not implemented")
+	self.Initialize(len(values), shared.KInitialDensity)
+	self.MinError, self.MaxError = 0, 0
+	self.ExpansionThreshold = float64(self.DataCapacity)
+	self.ContractionThreshold = 0.0
+	for i := 0; i < self.DataCapacity; i++ {
+		self.setKey(i, shared.KEndSentinel)
 	}
-	self.LinearModel.Expand(float64(self.DataCapacity) / float64(numKeys))
-
-	panic("not implemented")
+	return nil
 }
 
 func (self *DataNode) BulkLoadFromExisting(
@@ -700,14 +1082,18 @@ func (self *DataNode) BulkLoadFromExisting(
 	keepRight bool,
 	preComputedModel *linear_model.LinearModel,
 	preComputedActualKeys int,
-) {
+) error {
 	if !(left >= 0 && right <= node.DataCapacity) {
-		panic("left and right must be within the range of the node")
+		return fmt.Errorf("%w: [%d, %d) is not within the %d slots of the node", shared.InvalidRangeError, left, right, node.DataCapacity)
 	}
 
+	self.KeysOnly = node.KeysOnly
+	self.SlotLayout = node.SlotLayout
+	self.MinDensity = node.MinDensity
+	self.MaxDensity = node.MaxDensity
 	numActualKeys := 0
 	if preComputedModel == nil || preComputedActualKeys == -1 {
-		linearModelBuilder := linear_model.NewLinearModelBuilder(&node.LinearModel)
+		linearModelBuilder := linear_model.NewLinearModelBuilder(&self.LinearModel)
 		node.IterateFilledPositions(func(key shared.KeyType, payload shared.PayloadType, i int, j int) {
 			linearModelBuilder.Add(float64(key), float64(j))
 			numActualKeys++
@@ -719,21 +1105,22 @@ func (self *DataNode) BulkLoadFromExisting(
 		self.LinearModel.B = preComputedModel.B
 	}
 
-	self.Initialize(numActualKeys, shared.KMinDensity)
+	self.Initialize(numActualKeys, self.MinDensity)
+	self.MinError, self.MaxError = 0, 0
 	if numActualKeys == 0 {
 		self.ExpansionThreshold = float64(self.DataCapacity)
 		self.ContractionThreshold = 0.0
 		for i := 0; i < self.DataCapacity; i++ {
-			self.Keys[i] = shared.KEndSentinel
+			self.setKey(i, shared.KEndSentinel)
 		}
-		return
+		return nil
 	}
 
 	if keepLeft {
-		self.LinearModel.Expand(float64(numActualKeys) / shared.KMaxDensity / float64(self.NumKeys))
+		self.LinearModel.Expand(float64(numActualKeys) / self.MaxDensity / float64(self.NumKeys))
 	} else if keepRight {
-		self.LinearModel.Expand(float64(numActualKeys) / shared.KMaxDensity / float64(self.NumKeys))
-		self.LinearModel.B += float64(self.DataCapacity) - (float64(numActualKeys) / shared.KMaxDensity)
+		self.LinearModel.Expand(float64(numActualKeys) / self.MaxDensity / float64(self.NumKeys))
+		self.LinearModel.B += float64(self.DataCapacity) - (float64(numActualKeys) / self.MaxDensity)
 	} else {
 		self.LinearModel.Expand(float64(self.DataCapacity) / float64(self.NumKeys))
 	}
@@ -742,9 +1129,9 @@ func (self *DataNode) BulkLoadFromExisting(
 	lastPosition := -1
 	keysRemaining := self.NumKeys
 	i := node.GetNextFilledPosition(left, false)
-	self.MinKey = node.Keys[i]
+	self.MinKey = node.KeyAt(i)
 	for i < right {
-		position := self.LinearModel.Predict(float64(node.Keys[i]))
+		position := self.LinearModel.Predict(float64(node.KeyAt(i)))
 		position = max(position, lastPosition+1)
 
 		positionsRemaining := self.DataCapacity - position
@@ -753,13 +1140,13 @@ func (self *DataNode) BulkLoadFromExisting(
 			pos := self.DataCapacity - keysRemaining
 
 			for j := lastPosition + 1; j < pos; j++ {
-				self.Keys[j] = node.Keys[i]
+				self.setKey(j, node.KeyAt(i))
 			}
 
 			for pos < self.DataCapacity {
-				self.Keys[pos] = node.Keys[i]
-				self.Payloads[pos] = node.Payloads[i]
+				self.setSlot(pos, node.KeyAt(i), node.PayloadAt(i))
 				self.Bitmap.Set(uint32(pos))
+				self.recordError(node.KeyAt(i), pos)
 
 				i = node.GetNextFilledPosition(i+1, false)
 				pos++
@@ -770,12 +1157,12 @@ func (self *DataNode) BulkLoadFromExisting(
 		}
 
 		for j := lastPosition + 1; j < position; j++ {
-			self.Keys[j] = node.Keys[i]
+			self.setKey(j, node.KeyAt(i))
 		}
 
-		self.Keys[position] = node.Keys[i]
-		self.Payloads[position] = node.Payloads[i]
+		self.setSlot(position, node.KeyAt(i), node.PayloadAt(i))
 		self.Bitmap.Set(uint32(position))
+		self.recordError(node.KeyAt(i), position)
 
 		lastPosition = position
 		keysRemaining--
@@ -783,12 +1170,13 @@ func (self *DataNode) BulkLoadFromExisting(
 	}
 
 	for i = lastPosition + 1; i < self.DataCapacity; i++ {
-		self.Keys[i] = shared.KEndSentinel
+		self.setKey(i, shared.KEndSentinel)
 	}
 
-	self.MaxKey = self.Keys[lastPosition]
-	self.ExpansionThreshold = min(max(float64(self.DataCapacity)*shared.KMaxDensity, float64(self.NumKeys+1)), float64(self.DataCapacity))
-	self.ContractionThreshold = float64(self.DataCapacity) * shared.KMinDensity
+	self.MaxKey = self.KeyAt(lastPosition)
+	self.ExpansionThreshold = min(max(float64(self.DataCapacity)*self.MaxDensity, float64(self.NumKeys+1)), float64(self.DataCapacity))
+	self.ContractionThreshold = float64(self.DataCapacity) * self.MinDensity
+	return nil
 }
 
 func BuildNodeImplicitFromExisting(
@@ -804,13 +1192,13 @@ func BuildNodeImplicitFromExisting(
 	keysRemaining := numActualKeys
 	i := node.GetNextFilledPosition(left, false)
 	for i < right {
-		predictedPosition := max(0, min(dataCapacity-1, linearModel.Predict(float64(node.Keys[i]))))
+		predictedPosition := max(0, min(dataCapacity-1, linearModel.Predict(float64(node.KeyAt(i)))))
 		actualPosition := max(predictedPosition, lastPosition+1)
 		positionRemaining := dataCapacity - actualPosition
 		if positionRemaining < keysRemaining {
 			actualPosition = dataCapacity - keysRemaining
 			for actualPosition < dataCapacity {
-				predictedPosition = max(0, min(dataCapacity-1, linearModel.Predict(float64(node.Keys[i]))))
+				predictedPosition = max(0, min(dataCapacity-1, linearModel.Predict(float64(node.KeyAt(i)))))
 				acc.Accumulate(actualPosition, predictedPosition)
 				actualPosition++
 				i = node.GetNextFilledPosition(i+1, false)
@@ -831,9 +1219,10 @@ func ComputeExpectedCostFromExisting(
 	density float64,
 	expectedInsertFrac float64,
 	existingModel *linear_model.LinearModel,
-) (float64, float64, float64) {
+	costModel cost_models.CostModel,
+) (float64, float64, float64, error) {
 	if !(left >= 0 && right <= node.DataCapacity) {
-		panic("Invalid range")
+		return 0, 0, 0, fmt.Errorf("%w: [%d, %d) is not within the %d slots of the node", shared.InvalidRangeError, left, right, node.DataCapacity)
 	}
 
 	linearModel := linear_model.NewLinearModel(0, 0)
@@ -852,7 +1241,7 @@ func ComputeExpectedCostFromExisting(
 	}
 
 	if numActualKeys == 0 {
-		return 0, -1, -1
+		return 0, -1, -1, nil
 	}
 
 	dataCapacity := max(int(float64(numActualKeys)/density), numActualKeys+1)
@@ -871,9 +1260,9 @@ func ComputeExpectedCostFromExisting(
 		expectedAvgExpSearchIterations = accumulator.GetExpectedNumSearchIterations()
 		expectedAvgShifts = accumulator.GetExpectedNumShifts()
 	}
-	cost = shared.KExpSearchIterationsWeight*float64(expectedAvgExpSearchIterations) + shared.KShiftsWeight*float64(expectedAvgShifts)*expectedInsertFrac
+	cost = costModel.DataNodeCost(expectedAvgExpSearchIterations, expectedAvgShifts, expectedInsertFrac)
 
-	return cost, expectedAvgExpSearchIterations, expectedAvgShifts
+	return cost, expectedAvgExpSearchIterations, expectedAvgShifts, nil
 }
 
 func NewDataNode(dataCapacity int) *DataNode {
@@ -891,6 +1280,8 @@ func NewDataNode(dataCapacity int) *DataNode {
 		Bitmap:                         shared.NewBitmap(dataCapacity),
 		ExpansionThreshold:             1.0,
 		ContractionThreshold:           0.0,
+		MinDensity:                     shared.KMinDensity,
+		MaxDensity:                     shared.KMaxDensity,
 		NumShifts:                      0,
 		NumExpSearchIterations:         0,
 		NumLookups:                     0,
@@ -904,6 +1295,7 @@ func NewDataNode(dataCapacity int) *DataNode {
 		ExpectedAvgShifts:              0.0,
 		CurrentIteratorPosition:        0,
 		MaxSlots:                       shared.MaxSlots,
+		CostModel:                      cost_models.NewDefaultCostModel(),
 	}
 
 	return dataNode
@@ -0,0 +1,419 @@
+package node
+
+import (
+	"alex_go/linear_model"
+	"alex_go/shared"
+)
+
+// resizeMigration State of an incremental resize.
+// The keys are migrated in order, so every key smaller than the boundary lives in the new slots of the data node
+// and every other key still lives in the old slots, from the cursor on. The old slots before the cursor hold stale
+// copies of the migrated keys and are never read.
+// The new slots are initialised lazily: positions after the last filled one are gaps whose keys are only written
+// up to filledUpTo and from sentinelStart on, searches of the new slots stop at the last filled position.
+type resizeMigration struct {
+	// The data node as it was before the resize, sharing its old slots and model
+	source *DataNode
+	// Next filled position of the old slots to migrate
+	cursor int
+	// Last filled position of the new slots, everything after it is a gap
+	lastPosition int
+	// The gaps after lastPosition up to this position already hold the boundary. The gaps before the position of
+	// a key are filled a few at a time, so that keys predicted far from the last filled position do not stall the
+	// insert that migrates them
+	filledUpTo int
+	// Number of keys of the old slots that are not migrated yet
+	keysRemaining int
+	// The trailing gaps of the new slots from this position on hold KEndSentinel
+	sentinelStart int
+	// Number of trailing gaps set to KEndSentinel per key migrated or erased from the old slots, so that they are all
+	// set by the time the migration finishes
+	sentinelStep int
+}
+
+// boundary Smallest key that is not migrated yet
+func (self *resizeMigration) boundary() shared.KeyType {
+	return self.source.KeyAt(self.cursor)
+}
+
+// StartIncrementalResize Allocates new slots sized for targetDensity and retrains or rescales the model like
+// Resize does, but leaves the keys in the old slots.
+// Keys are then migrated a chunk at a time by subsequent inserts and lookups, see IncrementalResizeChunk
+func (self *DataNode) StartIncrementalResize(targetDensity float64, forceRetrain bool, keepLeft bool, keepRight bool) {
+	self.FinishResize()
+	if self.NumKeys == 0 {
+		return
+	}
+
+	// The old slots keep their own model, counters are folded back once the migration finishes
+	source := &DataNode{
+		LinearModel:  *linear_model.CopyLinearModel(&self.LinearModel),
+		Keys:         self.Keys,
+		Payloads:     self.Payloads,
+		Slots:        self.Slots,
+		SlotLayout:   self.SlotLayout,
+		KeysOnly:     self.KeysOnly,
+		DataCapacity: self.DataCapacity,
+		NumKeys:      self.NumKeys,
+		Bitmap:       self.Bitmap,
+		CostModel:    self.CostModel,
+		MinError:     self.MinError,
+		MaxError:     self.MaxError,
+	}
+
+	newDataCapacity := max(int(float64(self.NumKeys)/targetDensity), self.NumKeys+1)
+	if self.NumKeys < shared.NumKeysDataNodeRetrainThreshold || forceRetrain {
+		linearModelBuilder := linear_model.NewLinearModelBuilder(&self.LinearModel)
+		self.IterateFilledPositions(func(key shared.KeyType, payload shared.PayloadType, i int, j int) {
+			linearModelBuilder.Add(float64(key), float64(j))
+		}, 0, self.DataCapacity)
+		linearModelBuilder.Build()
+
+		if keepLeft {
+			self.LinearModel.Expand(float64(self.DataCapacity) / float64(self.NumKeys))
+		} else if keepRight {
+			self.LinearModel.Expand(float64(self.DataCapacity) / float64(self.NumKeys))
+			self.LinearModel.B += float64(newDataCapacity - self.DataCapacity)
+		} else {
+			self.LinearModel.Expand(float64(newDataCapacity) / float64(self.NumKeys))
+		}
+	} else {
+		if keepRight {
+			self.LinearModel.B += float64(newDataCapacity - self.DataCapacity)
+		} else if !keepLeft {
+			self.LinearModel.Expand(float64(newDataCapacity) / float64(self.DataCapacity))
+		}
+	}
+
+	self.DataCapacity = newDataCapacity
+	self.allocateSlots(newDataCapacity)
+	self.Bitmap = shared.NewBitmap(newDataCapacity)
+	self.MinError, self.MaxError = 0, 0
+	self.ExpansionThreshold = min(max(float64(self.DataCapacity)*self.MaxDensity, float64(self.NumKeys+1)), float64(self.DataCapacity))
+	self.ContractionThreshold = float64(self.DataCapacity) * self.MinDensity
+
+	self.migration = &resizeMigration{
+		source:        source,
+		cursor:        source.GetNextFilledPosition(0, false),
+		lastPosition:  -1,
+		filledUpTo:    -1,
+		keysRemaining: source.NumKeys,
+		sentinelStart: newDataCapacity,
+		sentinelStep:  (newDataCapacity + source.NumKeys - 1) / source.NumKeys,
+	}
+}
+
+// IsResizing Whether an incremental resize is running
+func (self *DataNode) IsResizing() bool {
+	return self.migration != nil
+}
+
+// FinishResize Migrates every remaining key of a running incremental resize
+func (self *DataNode) FinishResize() {
+	for self.migration != nil {
+		self.migrateKeys(self.NumKeys + 1)
+	}
+}
+
+// migrateChunk Migrates the next chunk of keys of a running incremental resize, more if that is needed to finish
+// the migration before the node expands again
+func (self *DataNode) migrateChunk() {
+	migration := self.migration
+	if migration == nil {
+		return
+	}
+	insertsLeft := max(int(self.ExpansionThreshold)-self.NumKeys, 1)
+	self.migrateKeys(max(self.IncrementalResizeChunk, (migration.keysRemaining+insertsLeft-1)/insertsLeft))
+}
+
+// migrateKeys Places up to numKeys keys of the old slots in the new slots, the same way Resize would.
+// At most 2 * numKeys * sentinelStep gaps are filled on the way, a key whose gaps are not all filled yet is placed
+// by a later call
+func (self *DataNode) migrateKeys(numKeys int) {
+	migration := self.migration
+	if migration == nil {
+		return
+	}
+
+	source := migration.source
+	numGapWrites := 2 * numKeys * migration.sentinelStep
+	for moved := 0; moved < numKeys && migration.cursor < source.DataCapacity; moved++ {
+		key := source.KeyAt(migration.cursor)
+		position := self.LinearModel.Predict(float64(key))
+		position = max(position, migration.lastPosition+1)
+		if self.DataCapacity-position < migration.keysRemaining {
+			// fill the rest of the store contiguously
+			position = self.DataCapacity - migration.keysRemaining
+		}
+
+		start := max(migration.filledUpTo, migration.lastPosition) + 1
+		end := max(min(position, start+numGapWrites), start)
+		for j := start; j < end; j++ {
+			self.setKey(j, key)
+		}
+		numGapWrites -= end - start
+		self.NumResizeWrites += int64(end - start)
+		migration.filledUpTo = end - 1
+		migration.sentinelStart = max(migration.sentinelStart, end)
+		if end < position {
+			break
+		}
+
+		self.setSlot(position, key, source.PayloadAt(migration.cursor))
+		self.Bitmap.Set(uint32(position))
+		self.recordError(key, position)
+		self.NumResizeWrites++
+
+		migration.lastPosition = position
+		migration.filledUpTo = position
+		migration.sentinelStart = max(migration.sentinelStart, position+1)
+		migration.keysRemaining--
+		migration.cursor = source.GetNextFilledPosition(migration.cursor+1, false)
+		self.writeSentinels(migration.sentinelStep)
+	}
+
+	if migration.cursor == source.DataCapacity {
+		self.writeSentinels(migration.sentinelStart)
+		self.NumShifts += source.NumShifts
+		self.NumExpSearchIterations += source.NumExpSearchIterations
+		self.migration = nil
+	}
+}
+
+// Sets up to n more trailing gaps of the new slots to KEndSentinel, from the end of the slots backwards
+func (self *DataNode) writeSentinels(n int) {
+	migration := self.migration
+	for ; n > 0 && migration.sentinelStart > max(migration.lastPosition, migration.filledUpTo)+1; n-- {
+		migration.sentinelStart--
+		self.setKey(migration.sentinelStart, shared.KEndSentinel)
+		self.NumResizeWrites++
+	}
+}
+
+// Searches the new slots for the first position greater than key, which must be smaller than the migration
+// boundary. Only reads the slots up to the last filled one, the gaps after it are not initialised yet.
+// Returns position in range [0, lastPosition + 1]
+func (self *DataNode) migratedUpperBound(key shared.KeyType) int {
+	end := self.migration.lastPosition + 1
+	if end == 0 {
+		return 0
+	}
+	return self.exponentialSearchUpperBound(min(self.PredictPosition(key), end-1), key, 0, end)
+}
+
+// Searches the new slots for the first position no less than key, see migratedUpperBound
+func (self *DataNode) migratedLowerBound(key shared.KeyType) int {
+	end := self.migration.lastPosition + 1
+	if end == 0 {
+		return 0
+	}
+	return self.exponentialSearchLowerBound(min(self.PredictPosition(key), end-1), key, 0, end)
+}
+
+// Searches the new slots for the last position equal to key, which must be smaller than the migration boundary
+func (self *DataNode) findMigratedPosition(key shared.KeyType) (int, error) {
+	position := self.migratedUpperBound(key) - 1
+	if position < 0 || self.KeyAt(position) != key {
+		return 0, shared.KeyNotFoundError
+	}
+	return position, nil
+}
+
+// Searches the old slots that are not migrated yet for the first position greater than key, or no less than key
+// if !inclusive. Returns position in range [cursor, source.DataCapacity]
+func (self *resizeMigration) sourceBound(key shared.KeyType, inclusive bool) int {
+	if inclusive {
+		return max(self.source.UpperBound(key), self.cursor)
+	}
+	return max(self.source.LowerBound(key), self.cursor)
+}
+
+// SlotsAt Returns the node whose slots hold position, and the position in them.
+// While an incremental resize runs, positions below DataCapacity address the new slots, which only hold keys up to
+// the last migrated one, and positions from DataCapacity on address the old slots, offset by DataCapacity. Lookups
+// returning positions never return one past the last migrated key in the new slots or before the migration cursor
+// in the old slots, the end of the old slots stands for the end of the node
+func (self *DataNode) SlotsAt(position int) (*DataNode, int) {
+	if self.migration != nil && position >= self.DataCapacity {
+		return self.migration.source, position - self.DataCapacity
+	}
+	return self, position
+}
+
+// Searches both slots of a running incremental resize for the first position greater than key, or no less than
+// key if !inclusive. Returns a position of SlotsAt
+func (self *DataNode) migrationBound(key shared.KeyType, inclusive bool) int {
+	migration := self.migration
+	if key >= migration.boundary() {
+		return self.DataCapacity + migration.sourceBound(key, inclusive)
+	}
+	position := self.migratedLowerBound(key)
+	if inclusive {
+		position = self.migratedUpperBound(key)
+	}
+	if position > migration.lastPosition {
+		// The next key is the first one that is not migrated yet
+		return self.DataCapacity + migration.cursor
+	}
+	return position
+}
+
+// First filled position of SlotsAt from position on, which migrationBound returned
+func (self *DataNode) nextMigrationPosition(position int) int {
+	if position < self.DataCapacity {
+		// The last migrated key is filled, so the new slots hold the next one
+		return self.GetNextFilledPosition(position, false)
+	}
+	return self.DataCapacity + self.migration.source.GetNextFilledPosition(position-self.DataCapacity, false)
+}
+
+// slotsFor Returns the node whose slots hold key: the old slots if key is not migrated yet, the node itself
+// otherwise
+func (self *DataNode) slotsFor(key shared.KeyType) *DataNode {
+	if self.migration != nil && key >= self.migration.boundary() {
+		return self.migration.source
+	}
+	return self
+}
+
+// insertDuringMigration Inserts key in the new slots if it is smaller than the migration boundary, in the old slots
+// otherwise.
+// Inserts never move a key across the boundary: new slots only grow towards their end and old slots shift keys to
+// the right, or to the left into the stale position before the cursor. In the rare cases where that is impossible,
+// the migration is finished first.
+func (self *DataNode) insertDuringMigration(key shared.KeyType, payload shared.PayloadType) (int, error) {
+	migration := self.migration
+	if self.DataCapacity-(migration.lastPosition+1) <= migration.keysRemaining {
+		// The new slots left have no room for one more key, wherever it is inserted
+		self.FinishResize()
+		return self.insertIntoSlots(key, payload)
+	}
+	if key < migration.boundary() {
+		position := self.migratedUpperBound(key)
+		if !self.Bitmap.Contains(uint32(position)) {
+			self.InsertElementAt(key, payload, position)
+		} else {
+			var err error
+			if position, err = self.InsertUsingShifts(key, payload, position); err != nil {
+				return 0, err
+			}
+		}
+		for migration.lastPosition+1 < self.DataCapacity && self.Bitmap.Contains(uint32(migration.lastPosition+1)) {
+			migration.lastPosition++
+		}
+		return position, nil
+	}
+
+	source := migration.source
+	position, _ := source.FindInsertPosition(key)
+	if position < source.DataCapacity && !source.Bitmap.Contains(uint32(position)) {
+		source.InsertElementAt(key, payload, position)
+		migration.keysRemaining++
+		return position, nil
+	}
+	if source.insertUsingRightShifts(key, payload, position) {
+		migration.keysRemaining++
+		return position, nil
+	}
+	if position, ok := migration.insertUsingLeftShifts(key, payload, position); ok {
+		migration.keysRemaining++
+		return position, nil
+	}
+	self.FinishResize()
+	return self.insertIntoSlots(key, payload)
+}
+
+// Erases the keys in [startKey, endKey), or [startKey, endKey] if endKeyInclusive, from both slots of a running
+// incremental resize, without migrating any key. Returns the number of keys erased
+func (self *DataNode) eraseDuringMigration(startKey shared.KeyType, endKey shared.KeyType, endKeyInclusive bool) int {
+	migration := self.migration
+	source := migration.source
+
+	// New slots, past the last filled position the gaps hold KEndSentinel
+	end := self.migratedLowerBound(endKey)
+	if endKeyInclusive {
+		end = self.migratedUpperBound(endKey)
+	}
+	nextKey := shared.KEndSentinel
+	if end <= migration.lastPosition {
+		nextKey = self.KeyAt(end)
+	}
+	numErased := 0
+	for pos := end - 1; pos >= 0 && self.KeyAt(pos) >= startKey; pos-- {
+		self.setKey(pos, nextKey)
+		if self.Bitmap.Remove(uint32(pos)) {
+			numErased++
+		}
+	}
+	for migration.lastPosition >= 0 && !self.Bitmap.Contains(uint32(migration.lastPosition)) {
+		migration.lastPosition--
+	}
+
+	// Old slots from the cursor on
+	end = migration.sourceBound(endKey, endKeyInclusive)
+	nextKey = shared.KEndSentinel
+	if end < source.DataCapacity {
+		nextKey = source.KeyAt(end)
+	}
+	numSourceErased := 0
+	for pos := end - 1; pos >= migration.cursor && source.KeyAt(pos) >= startKey; pos-- {
+		source.setKey(pos, nextKey)
+		if source.Bitmap.Remove(uint32(pos)) {
+			numSourceErased++
+		}
+	}
+	source.NumKeys -= numSourceErased
+	migration.keysRemaining -= numSourceErased
+	migration.cursor = source.GetNextFilledPosition(migration.cursor, false)
+	// The boundary may have changed, the gaps filled ahead of the last filled position no longer hold it
+	migration.filledUpTo = migration.lastPosition
+	self.writeSentinels(numSourceErased * migration.sentinelStep)
+	// Finishes the migration if no key is left to migrate
+	self.migrateKeys(0)
+
+	return numErased + numSourceErased
+}
+
+// insertUsingLeftShifts Inserts key of the old slots into pos - 1 by shifting the keys before pos to the left, up
+// to the closest gap from the cursor on or to the stale position right before the cursor, which is free.
+// Returns the position of the key, or false if the old slots hold no key before the cursor and no gap on the left
+// of pos
+func (self *resizeMigration) insertUsingLeftShifts(key shared.KeyType, payload shared.PayloadType, pos int) (int, bool) {
+	source := self.source
+	gapPos := pos - 1
+	for gapPos >= self.cursor && source.Bitmap.Contains(uint32(gapPos)) {
+		gapPos--
+	}
+	if gapPos < 0 {
+		return 0, false
+	}
+	if gapPos < self.cursor {
+		self.cursor = gapPos
+	}
+
+	source.Bitmap.Set(uint32(gapPos))
+	source.moveSlots(gapPos, gapPos+1, pos-1-gapPos)
+	source.recordShiftedErrors(gapPos, pos-1)
+	source.InsertElementAt(key, payload, pos-1)
+	source.NumShifts += int64(pos - 1 - gapPos)
+	return pos - 1, true
+}
+
+// insertUsingRightShifts Inserts key into pos by shifting the keys up to the closest gap on the right of pos.
+// Returns false if there is no gap on the right of pos
+func (self *DataNode) insertUsingRightShifts(key shared.KeyType, payload shared.PayloadType, pos int) bool {
+	gapPos := pos
+	for gapPos < self.DataCapacity && self.Bitmap.Contains(uint32(gapPos)) {
+		gapPos++
+	}
+	if gapPos == self.DataCapacity {
+		return false
+	}
+
+	self.Bitmap.Set(uint32(gapPos))
+	self.moveSlots(pos+1, pos, gapPos-pos)
+	self.recordShiftedErrors(pos+1, gapPos+1)
+	self.InsertElementAt(key, payload, pos)
+	self.NumShifts += int64(gapPos - pos)
+	return true
+}
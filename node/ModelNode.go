@@ -2,8 +2,10 @@ package node
 
 import "C"
 import (
+	"alex_go/cost_models"
 	"alex_go/linear_model"
 	"alex_go/shared"
+	"fmt"
 	"unsafe"
 )
 
@@ -19,6 +21,15 @@ type ModelNode struct {
 
 	// Number of logical Children. Must be a power of 2
 	NumChildren int
+
+	// Decaying estimate of the fraction of inserts among recent operations routed through this node
+	Workload cost_models.InsertFracEstimator
+
+	// Number of keys in the data nodes under this node, maintained by the index
+	NumKeys int
+	// Number of keys under each child, counted at the first bucket of the child, as a Fenwick tree over the
+	// buckets. Maintained by the index along with NumKeys, see ChildCounts.go
+	childCounts []int
 }
 
 func (self *ModelNode) GetChildNode(key shared.KeyType) *Node {
@@ -27,9 +38,11 @@ func (self *ModelNode) GetChildNode(key shared.KeyType) *Node {
 	return &self.Children[bucketId]
 }
 
-func (self *ModelNode) Expand(log2ExpansionFactor int) int {
+// Expand Multiplies the number of children by 2^log2ExpansionFactor, duplicating the pointers to every child.
+// Returns the expansion factor
+func (self *ModelNode) Expand(log2ExpansionFactor int) (int, error) {
 	if log2ExpansionFactor < 0 {
-		panic("Expansion factor must be non-negative")
+		return 0, fmt.Errorf("%w: log2 expansion factor %d is negative", shared.InvalidExpansionFactorError, log2ExpansionFactor)
 	}
 
 	expansionFactor := 1 << log2ExpansionFactor
@@ -49,7 +62,8 @@ func (self *ModelNode) Expand(log2ExpansionFactor int) int {
 	self.Children = newChildren
 	self.NumChildren = numNewChildren
 	self.LinearModel.Expand(float64(expansionFactor))
-	return expansionFactor
+	self.RebuildChildCounts()
+	return expansionFactor, nil
 }
 
 func (self *ModelNode) IsLeaf() bool {
@@ -90,8 +104,9 @@ func (self *ModelNode) SetLinearModel(linearModel linear_model.LinearModel) {
 
 func (self *ModelNode) GetNodeSize() int64 {
 	size := int64(unsafe.Sizeof(*self))
-	// Pointers to Children
-	size += int64(self.NumChildren) * int64(unsafe.Sizeof(uintptr(0)))
+	// Interface values pointing to the children
+	size += int64(cap(self.Children)) * int64(unsafe.Sizeof(Node(nil)))
+	size += int64(cap(self.childCounts)) * int64(unsafe.Sizeof(0))
 	return size
 }
 
@@ -23,6 +23,6 @@ type Node interface {
 	GetLinearModel() *linear_model.LinearModel
 	SetLinearModel(linearModel linear_model.LinearModel)
 
-	// GetNodeSize The size in bytes of all member variables in this class
+	// GetNodeSize The size in bytes of all member variables in this class, including the arrays the node owns
 	GetNodeSize() int64
 }
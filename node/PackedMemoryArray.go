@@ -0,0 +1,135 @@
+package node
+
+import (
+	"alex_go/shared"
+	"math/bits"
+)
+
+// DataNodeLayout How a data node makes room for a key whose insert position is already filled. Both layouts keep
+// the keys sorted in gapped slots, so that lookups, scans and the cost model work the same on either
+type DataNodeLayout int
+
+const (
+	// GappedArrayLayout Shifts the keys between the insert position and the closest gap, as ALEX does. Inserts into
+	// a long run of keys shift the whole run, which the cost model catches with CatastrophicCost
+	GappedArrayLayout DataNodeLayout = iota
+	// PackedMemoryArrayLayout Spreads the keys of the smallest aligned window around the insert position whose
+	// density stays below the threshold of its level, from segments of about log2(capacity) slots up to the whole
+	// node. Amortised shifts per insert are O(log² n) whatever the order of the inserts
+	PackedMemoryArrayLayout
+)
+
+func (self DataNodeLayout) String() string {
+	switch self {
+	case GappedArrayLayout:
+		return "gapped"
+	case PackedMemoryArrayLayout:
+		return "pma"
+	default:
+		return "unknown"
+	}
+}
+
+// Number of slots of the smallest windows of the packed memory array, a power of 2 about log2 of the capacity
+func (self *DataNode) pmaSegmentSize() int {
+	return max(shared.KPMAMinSegmentSize, 1<<bits.Len(uint(bits.Len(uint(self.DataCapacity)))))
+}
+
+// Upper density threshold of the windows of the given level out of height: full for segments, down to the density
+// at which the node expands for the whole node
+func (self *DataNode) pmaDensityThreshold(level int, height int) float64 {
+	if height == 0 {
+		return 1.0
+	}
+	return 1.0 - (1.0-self.MaxDensity)*float64(level)/float64(height)
+}
+
+// insertUsingRebalance Inserts key into pos, which is filled, by shifting keys if the segment of pos has a gap, by
+// spreading the keys of the smallest window around pos that can take one more key without exceeding the density
+// threshold of its level otherwise.
+// Falls back to InsertUsingShifts if even the whole node is too dense, which happens when it is about to expand.
+// Returns the actual position of insertion
+func (self *DataNode) insertUsingRebalance(key shared.KeyType, payload shared.PayloadType, pos int) (int, error) {
+	segmentSize := self.pmaSegmentSize()
+	height := bits.Len(uint((self.DataCapacity - 1) / segmentSize))
+	anchor := min(pos, self.DataCapacity-1)
+	left := anchor &^ (segmentSize - 1)
+	right := min(left+segmentSize, self.DataCapacity)
+	if self.Bitmap.CountRange(uint32(left), uint32(right)) < right-left {
+		// The segment has a gap, the closest gap is at most a segment away
+		return self.InsertUsingShifts(key, payload, pos)
+	}
+	for level := 1; level <= height; level++ {
+		windowSize := segmentSize << level
+		left := anchor &^ (windowSize - 1)
+		right := min(left+windowSize, self.DataCapacity)
+		numKeys := self.Bitmap.CountRange(uint32(left), uint32(right)) + 1
+		if numKeys <= right-left && float64(numKeys) <= self.pmaDensityThreshold(level, height)*float64(right-left) {
+			return self.rebalance(key, payload, pos, left, right, numKeys), nil
+		}
+	}
+	return self.InsertUsingShifts(key, payload, pos)
+}
+
+// Spreads the numKeys - 1 keys of the window [left, right) and key, which goes into pos, evenly over the window.
+// Returns the position of key
+func (self *DataNode) rebalance(key shared.KeyType, payload shared.PayloadType, pos int, left int, right int, numKeys int) int {
+	// Allocated per rebalance, so that idle nodes hold no memory beyond their slots
+	keys := make([]shared.KeyType, 0, numKeys)
+	var payloads []shared.PayloadType
+	if !self.KeysOnly {
+		payloads = make([]shared.PayloadType, 0, numKeys)
+	}
+	keyIndex := -1
+	self.Bitmap.Range(uint32(left), uint32(right), func(position uint32) bool {
+		if keyIndex < 0 && int(position) >= pos {
+			keyIndex = len(keys)
+			keys = append(keys, key)
+			if !self.KeysOnly {
+				payloads = append(payloads, payload)
+			}
+		}
+		keys = append(keys, self.KeyAt(int(position)))
+		if !self.KeysOnly {
+			payloads = append(payloads, self.PayloadAt(int(position)))
+		}
+		return true
+	})
+	if keyIndex < 0 {
+		keyIndex = len(keys)
+		keys = append(keys, key)
+		if !self.KeysOnly {
+			payloads = append(payloads, payload)
+		}
+	}
+
+	// Gaps hold the next key, those at the end of the window the first key after it
+	nextKey := shared.KEndSentinel
+	if right < self.DataCapacity {
+		nextKey = self.KeyAt(right)
+	}
+	self.Bitmap.RemoveRange(uint32(left), uint32(right))
+	windowSize := right - left
+	next := right
+	for i := numKeys - 1; i >= 0; i-- {
+		position := left + i*windowSize/numKeys
+		for next--; next > position; next-- {
+			self.setKey(next, nextKey)
+		}
+		var slotPayload shared.PayloadType
+		if !self.KeysOnly {
+			slotPayload = payloads[i]
+		}
+		self.setSlot(position, keys[i], slotPayload)
+		self.Bitmap.Set(uint32(position))
+		self.recordError(keys[i], position)
+		nextKey = keys[i]
+	}
+	// The first key of the window may be key, the gaps before the window hold it
+	for position := left - 1; position >= 0 && !self.Bitmap.Contains(uint32(position)); position-- {
+		self.setKey(position, nextKey)
+	}
+
+	self.NumShifts += int64(numKeys - 1)
+	return left + keyIndex*windowSize/numKeys
+}
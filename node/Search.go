@@ -0,0 +1,245 @@
+package node
+
+import (
+	"alex_go/shared"
+	"math"
+	"math/bits"
+)
+
+// SearchStrategy How a data node searches for a key around the position predicted by its model
+type SearchStrategy int
+
+const (
+	// AdaptiveSearch Every data node selects one of the strategies below from the error of its model
+	AdaptiveSearch SearchStrategy = iota
+	// ExponentialSearch Doubles the distance from the predicted position until the key is bracketed, then searches
+	// the bracket with a binary search. Costs about 2 log2(error) comparisons
+	ExponentialSearch
+	// LinearSearch Scans blocks of keys from the predicted position, for models whose error is a few slots
+	LinearSearch
+	// BinarySearch Ignores the prediction and searches all the slots, or only the error bounds of the model around the
+	// prediction when looking up a key as every strategy does, for models whose error is so large that the
+	// exponential search costs more
+	BinarySearch
+)
+
+func (self SearchStrategy) String() string {
+	switch self {
+	case AdaptiveSearch:
+		return "adaptive"
+	case ExponentialSearch:
+		return "exponential"
+	case LinearSearch:
+		return "linear"
+	case BinarySearch:
+		return "binary"
+	default:
+		return "unknown"
+	}
+}
+
+// GetSearchStrategy The strategy the data node currently searches with, never AdaptiveSearch
+func (self *DataNode) GetSearchStrategy() SearchStrategy {
+	if self.SearchStrategy != AdaptiveSearch {
+		return self.SearchStrategy
+	}
+	if self.selectedSearchStrategy == AdaptiveSearch {
+		return ExponentialSearch
+	}
+	return self.selectedSearchStrategy
+}
+
+// Selects the search strategy of an adaptive data node from the average number of iterations of its exponential
+// searches: the observed one once the node served enough operations, the one expected from its model before
+func (self *DataNode) selectSearchStrategy() {
+	iterations := self.ExpectedAvgExpSearchIterations
+	if self.NumLookups+self.NumInserts >= shared.SearchStrategyCheckFrequency {
+		iterations = self.ExpSearchIterationsPerOperation()
+	}
+	switch {
+	case iterations <= shared.KLinearSearchMaxIterations:
+		self.selectedSearchStrategy = LinearSearch
+	case 2*iterations >= math.Log2(float64(self.MaxError-self.MinError+1)):
+		self.selectedSearchStrategy = BinarySearch
+	default:
+		self.selectedSearchStrategy = ExponentialSearch
+	}
+}
+
+// Searches for the first position greater than key with the search strategy of the node, starting from position m
+// Returns position in range [0, data_capacity]
+func (self *DataNode) searchUpperBound(m int, key shared.KeyType) int {
+	if self.SearchStrategy == AdaptiveSearch && (self.NumLookups+self.NumInserts)&(shared.SearchStrategyCheckFrequency-1) == 0 {
+		self.selectSearchStrategy()
+	}
+	var position int
+	switch self.GetSearchStrategy() {
+	case LinearSearch:
+		position = self.LinearSearchUpperBound(m, key)
+	case BinarySearch:
+		position = self.BinarySearchUpperBound(0, self.DataCapacity, key)
+	default:
+		return self.ExponentialSearchUpperBound(m, key)
+	}
+	self.NumExpSearchIterations += expSearchIterations(m, position)
+	return position
+}
+
+// Searches for the first position greater than key with the search strategy of the node, starting from position m
+// predicted for key. Every strategy only searches within the error bounds of the model around m, which is only
+// valid for keys in the node.
+// Returns position in range [0, data_capacity]
+func (self *DataNode) searchUpperBoundWithinErrorBounds(m int, key shared.KeyType) int {
+	if self.SearchStrategy == AdaptiveSearch && (self.NumLookups+self.NumInserts)&(shared.SearchStrategyCheckFrequency-1) == 0 {
+		self.selectSearchStrategy()
+	}
+	var position int
+	l, r := max(m+self.MinError, 0), min(m+self.MaxError+1, self.DataCapacity)
+	switch self.GetSearchStrategy() {
+	case LinearSearch:
+		position = self.linearSearchUpperBound(m, key, l, r)
+	case BinarySearch:
+		position = self.BinarySearchUpperBound(l, r, key)
+	default:
+		return self.exponentialSearchUpperBound(m, key, l, r)
+	}
+	self.NumExpSearchIterations += expSearchIterations(m, position)
+	return position
+}
+
+// Searches for the first position no less than key with the search strategy of the node, starting from position m
+// Returns position in range [0, data_capacity]
+func (self *DataNode) searchLowerBound(m int, key shared.KeyType) int {
+	if self.SearchStrategy == AdaptiveSearch && (self.NumLookups+self.NumInserts)&(shared.SearchStrategyCheckFrequency-1) == 0 {
+		self.selectSearchStrategy()
+	}
+	var position int
+	switch self.GetSearchStrategy() {
+	case LinearSearch:
+		position = self.LinearSearchLowerBound(m, key)
+	case BinarySearch:
+		position = self.BinarySearchLowerBound(0, self.DataCapacity, key)
+	default:
+		return self.ExponentialSearchLowerBound(m, key)
+	}
+	self.NumExpSearchIterations += expSearchIterations(m, position)
+	return position
+}
+
+// Number of iterations an exponential search from m would have taken to bracket position, so that the cost
+// model sees the error of the model whatever the search strategy
+func expSearchIterations(m int, position int) int64 {
+	if position > m {
+		return int64(bits.Len(uint(position - m - 1)))
+	}
+	return int64(bits.Len(uint(m - position)))
+}
+
+// 1 if a <= b, 0 otherwise. Compiled to a conditional set rather than a branch, so that a block of keys is
+// compared without mispredictions
+func lessOrEqual(a shared.KeyType, b shared.KeyType) int {
+	result := 0
+	if a <= b {
+		result = 1
+	}
+	return result
+}
+
+// 1 if a < b, 0 otherwise, see lessOrEqual
+func less(a shared.KeyType, b shared.KeyType) int {
+	result := 0
+	if a < b {
+		result = 1
+	}
+	return result
+}
+
+// Number of keys no greater than key in positions [start, end)
+func (self *DataNode) countLessOrEqual(start int, end int, key shared.KeyType) int {
+	count := 0
+	if self.Slots != nil {
+		for _, slot := range self.Slots[start:end] {
+			count += lessOrEqual(slot.Key, key)
+		}
+		return count
+	}
+	for _, blockKey := range self.Keys[start:end] {
+		count += lessOrEqual(blockKey, key)
+	}
+	return count
+}
+
+// Number of keys smaller than key in positions [start, end)
+func (self *DataNode) countLess(start int, end int, key shared.KeyType) int {
+	count := 0
+	if self.Slots != nil {
+		for _, slot := range self.Slots[start:end] {
+			count += less(slot.Key, key)
+		}
+		return count
+	}
+	for _, blockKey := range self.Keys[start:end] {
+		count += less(blockKey, key)
+	}
+	return count
+}
+
+// LinearSearchUpperBound Searches for the first position greater than key, starting from position m.
+// Counts the keys no greater than key in whole blocks of KLinearSearchBlockSize keys, without branching on each
+// key. Falls back to a binary search after KLinearSearchMaxBlocks blocks.
+// Returns position in range [0, data_capacity]
+func (self *DataNode) LinearSearchUpperBound(m int, key shared.KeyType) int {
+	return self.linearSearchUpperBound(m, key, 0, self.DataCapacity)
+}
+
+// Searches for the first position greater than key in positions [l, r), starting from position m in that range.
+// Returns position in range [l, r]
+func (self *DataNode) linearSearchUpperBound(m int, key shared.KeyType, l int, r int) int {
+	if self.KeyAt(m) <= key {
+		start := m + 1
+		for block := 0; block < shared.KLinearSearchMaxBlocks && start < r; block++ {
+			end := min(start+shared.KLinearSearchBlockSize, r)
+			// Keys are sorted, the first count keys of the block are no greater than key
+			if count := self.countLessOrEqual(start, end, key); count < end-start {
+				return start + count
+			}
+			start = end
+		}
+		return self.BinarySearchUpperBound(start, r, key)
+	}
+	end := m
+	for block := 0; block < shared.KLinearSearchMaxBlocks && end > l; block++ {
+		start := max(end-shared.KLinearSearchBlockSize, l)
+		if count := self.countLessOrEqual(start, end, key); count > 0 {
+			return start + count
+		}
+		end = start
+	}
+	return self.BinarySearchUpperBound(l, end, key)
+}
+
+// LinearSearchLowerBound Searches for the first position no less than key, starting from position m.
+// See LinearSearchUpperBound.
+// Returns position in range [0, data_capacity]
+func (self *DataNode) LinearSearchLowerBound(m int, key shared.KeyType) int {
+	if self.KeyAt(m) < key {
+		start := m + 1
+		for block := 0; block < shared.KLinearSearchMaxBlocks && start < self.DataCapacity; block++ {
+			end := min(start+shared.KLinearSearchBlockSize, self.DataCapacity)
+			if count := self.countLess(start, end, key); count < end-start {
+				return start + count
+			}
+			start = end
+		}
+		return self.BinarySearchLowerBound(start, self.DataCapacity, key)
+	}
+	end := m
+	for block := 0; block < shared.KLinearSearchMaxBlocks && end > 0; block++ {
+		start := max(end-shared.KLinearSearchBlockSize, 0)
+		if count := self.countLess(start, end, key); count > 0 {
+			return start + count
+		}
+		end = start
+	}
+	return self.BinarySearchLowerBound(0, end, key)
+}
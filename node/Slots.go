@@ -0,0 +1,120 @@
+package node
+
+import "alex_go/shared"
+
+// SlotLayout How a data node stores its keys and payloads
+type SlotLayout int
+
+const (
+	// SeparateSlots Keys and payloads in two arrays. Searches scan densely packed keys, but a lookup reads its
+	// payload from another cache line and shifts move both arrays
+	SeparateSlots SlotLayout = iota
+	// InterleavedSlots Every key next to its payload in one array of Slot. A lookup finds its payload in the cache
+	// line of its key and shifts move a single array, at the cost of searches scanning twice as many bytes.
+	// Keys-only nodes store their keys alone whatever the layout
+	InterleavedSlots
+)
+
+func (self SlotLayout) String() string {
+	switch self {
+	case SeparateSlots:
+		return "separate"
+	case InterleavedSlots:
+		return "interleaved"
+	default:
+		return "unknown"
+	}
+}
+
+// Slot A key and its payload, stored next to each other by the InterleavedSlots layout
+type Slot struct {
+	Key     shared.KeyType
+	Payload shared.PayloadType
+}
+
+// KeyAt Key stored at position, the next key if position is a gap
+func (self *DataNode) KeyAt(position int) shared.KeyType {
+	if self.Slots != nil {
+		return self.Slots[position].Key
+	}
+	return self.Keys[position]
+}
+
+// Sets the key at position, leaving its payload unchanged
+func (self *DataNode) setKey(position int, key shared.KeyType) {
+	if self.Slots != nil {
+		self.Slots[position].Key = key
+		return
+	}
+	self.Keys[position] = key
+}
+
+// Sets the key and the payload at position, only the key if the node is keys-only
+func (self *DataNode) setSlot(position int, key shared.KeyType, payload shared.PayloadType) {
+	if self.Slots != nil {
+		self.Slots[position] = Slot{Key: key, Payload: payload}
+		return
+	}
+	self.Keys[position] = key
+	if !self.KeysOnly {
+		self.Payloads[position] = payload
+	}
+}
+
+// Pointer to the payload stored at position, nil if the node is keys-only
+func (self *DataNode) payloadPointer(position int) *shared.PayloadType {
+	if self.Slots != nil {
+		return &self.Slots[position].Payload
+	}
+	if self.KeysOnly {
+		return nil
+	}
+	return &self.Payloads[position]
+}
+
+// Moves the keys and payloads of the n slots from src to dst, the two ranges may overlap
+func (self *DataNode) moveSlots(dst int, src int, n int) {
+	if self.Slots != nil {
+		copy(self.Slots[dst:dst+n], self.Slots[src:src+n])
+		return
+	}
+	copy(self.Keys[dst:dst+n], self.Keys[src:src+n])
+	if !self.KeysOnly {
+		copy(self.Payloads[dst:dst+n], self.Payloads[src:src+n])
+	}
+}
+
+// Allocates the slots of the given capacity, laid out as SlotLayout requires
+func (self *DataNode) allocateSlots(dataCapacity int) {
+	if self.SlotLayout == InterleavedSlots && !self.KeysOnly {
+		self.Keys = nil
+		self.Payloads = nil
+		self.Slots = make([]Slot, dataCapacity)
+		return
+	}
+	self.Slots = nil
+	self.Keys = make([]shared.KeyType, dataCapacity)
+	self.Payloads = self.newPayloadSlots(dataCapacity)
+}
+
+// SetSlotLayout Moves the keys and payloads of the node into slots laid out as layout requires, both slots of a
+// running incremental resize
+func (self *DataNode) SetSlotLayout(layout SlotLayout) {
+	if self.migration != nil {
+		self.migration.source.SetSlotLayout(layout)
+	}
+	if self.SlotLayout == layout {
+		return
+	}
+	keys := make([]shared.KeyType, self.DataCapacity)
+	payloads := make([]shared.PayloadType, self.DataCapacity)
+	for position := range keys {
+		keys[position] = self.KeyAt(position)
+		payloads[position] = self.PayloadAt(position)
+	}
+	self.SlotLayout = layout
+	self.allocateSlots(self.DataCapacity)
+	for position := range keys {
+		self.setSlot(position, keys[position], payloads[position])
+	}
+}
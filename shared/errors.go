@@ -1,6 +1,9 @@
 package shared
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var NoGapFoundError = errors.New("no gap found")
 var KeyNotFoundError = errors.New("key not found")
@@ -8,3 +11,37 @@ var CatastrophicCostInsertionError = errors.New("catastrophic cost insertion")
 var SignificantCostDeviationInsertionError = errors.New("significant cost insertion")
 var MaxCapacityInsertionError = errors.New("max capacity insertion")
 var NoInsertionError = errors.New("no insertion")
+var BatchLengthMismatchError = errors.New("batch keys and payloads differ in length")
+var RankOutOfRangeError = errors.New("rank out of range")
+var MemoryBudgetExceededError = errors.New("memory budget exceeded")
+var IncorrectTraversalPathError = errors.New("incorrect traversal path")
+var InvalidExpansionFactorError = errors.New("invalid expansion factor")
+var InvalidFanoutTreeError = errors.New("invalid fanout tree")
+var InvalidDuplicationFactorError = errors.New("invalid duplication factor")
+var InvalidRootNodeError = errors.New("invalid root node")
+var InvalidRangeError = errors.New("invalid range")
+var NotImplementedError = errors.New("not implemented")
+var TxnClosedError = errors.New("transaction already committed or rolled back")
+var KeyOutOfRangeError = errors.New("key out of range")
+
+// MemoryBudgetError Returned by an insert that would grow an index past its memory budget.
+// Matches MemoryBudgetExceededError with errors.Is
+type MemoryBudgetError struct {
+	// Budget Memory budget of the index, in bytes
+	Budget int64
+	// Footprint Memory held by the nodes of the index when the insert was attempted, in bytes
+	Footprint int64
+	// Required Memory the insert would have added, in bytes
+	Required int64
+	// Splitting Whether the insert failed while splitting or retraining a data node. The splits completed before
+	// stay in place, only the key is not inserted
+	Splitting bool
+}
+
+func (self *MemoryBudgetError) Error() string {
+	return fmt.Sprintf("memory budget of %d bytes exceeded: %d bytes held, %d more required", self.Budget, self.Footprint, self.Required)
+}
+
+func (self *MemoryBudgetError) Unwrap() error {
+	return MemoryBudgetExceededError
+}
@@ -2,7 +2,6 @@ package shared
 
 import (
 	LocalBitmap "alex_go/bitmap"
-	"github.com/kelindar/bitmap"
 	"math"
 	"unsafe"
 )
@@ -62,12 +61,66 @@ const KMaxOutOfDomainKeys = 1000
 // factor.
 const KOutOfDomainToleranceFactor = 2
 
+// KMaxRootExpansionFactor Maximum number of children of a root created above the previous one to expand the key
+// domain. Keys further away expand the key domain over several levels
+const KMaxRootExpansionFactor = 1 << 10
+
 // CatastropheCheckFrequency The frequency of catastrophic checks while inserting keys to a data node.
 const CatastropheCheckFrequency = 64
 
+// SearchStrategyCheckFrequency The number of lookups and inserts of a data node between two selections of its
+// search strategy. Must be a power of 2
+const SearchStrategyCheckFrequency = 64
+
+// KLinearSearchBlockSize The number of keys compared at once by the linear search, a cache line of keys
+const KLinearSearchBlockSize = 8
+
+// KLinearSearchMaxBlocks The number of blocks the linear search scans before falling back to a binary search of
+// the rest of the data node
+const KLinearSearchMaxBlocks = 4
+
+// KLinearSearchMaxIterations Data nodes whose exponential searches take at most this many iterations on average,
+// i.e. whose keys are at most a few slots away from their predicted position, search linearly
+const KLinearSearchMaxIterations = 2.0
+
+// KPMAMinSegmentSize The number of slots of the smallest windows rebalanced by the packed memory array layout, in
+// small data nodes
+const KPMAMinSegmentSize = 8
+
+// KDegradedErrorWindow Data nodes whose model error bounds span more positions than this are reported as degraded,
+// their lookups search more than a few cache lines of keys
+const KDegradedErrorWindow = 256
+
 // NumKeysDataNodeRetrainThreshold The number of keys that must be inserted before the model on a data node is retrained.
 const NumKeysDataNodeRetrainThreshold = 50
 
+// KInsertFracDecayWeight Weight of the latest operation in the decaying insert fraction estimates.
+// Roughly, the estimates reflect the last 1/KInsertFracDecayWeight operations
+const KInsertFracDecayWeight = 1.0 / 4096
+
+// KMinInsertFracObservations A subtree's insert fraction estimate is only used once it has observed this many
+// operations, otherwise the estimate of its closest ancestor is used
+const KMinInsertFracObservations = 64
+
+// KMaintenanceQueueSize Maximum number of data nodes waiting to be reorganised by the maintenance goroutine.
+// Inserts split synchronously when the queue is full
+const KMaintenanceQueueSize = 1024
+
+// KArenaSlabSize Number of values per slab of a value arena
+const KArenaSlabSize = 1 << 12
+
+// KArenaCompactionRatio A value arena compacts itself once this fraction of its values are deleted
+const KArenaCompactionRatio = 0.5
+
+// KMemoryPressureRatio An index is under memory pressure once its nodes hold this fraction of its memory budget
+const KMemoryPressureRatio = 0.9
+
+// KMemoryPressureMinDensity Density after expanding a data node while the index is under memory pressure
+const KMemoryPressureMinDensity = 0.8
+
+// KMemoryPressureMaxDensity Density at which a data node expands while the index is under memory pressure
+const KMemoryPressureMaxDensity = 0.95
+
 // FanoutSelectionMethod Fanout selection method used during bulk loading: 0 means use bottom-up fanout tree, 1 means top-down
 const FanoutSelectionMethod int = 0
 
@@ -90,7 +143,7 @@ const SplittingPolicyMethod int = DecideBetweenNoSplittingOrSplittingInTwo
 const AllowSplittingUpwards bool = false
 
 func NewBitmapSMID(dataCapacity int) LocalBitmap.Bitmap {
-	return &bitmap.Bitmap{}
+	return LocalBitmap.NewSIMDBitmap(dataCapacity)
 }
 
 func NewBitmapNaive(dataCapacity int) LocalBitmap.Bitmap {
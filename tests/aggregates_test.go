@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"errors"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// checkAggregates Compares Rank, CountRange and Select with the sorted keys the index should hold
+func checkAggregates(t *testing.T, rng *rand.Rand, alex *index.Index, sorted []int) {
+	t.Helper()
+	for probe := 0; probe < 200; probe++ {
+		key := sorted[rng.Intn(len(sorted))] + rng.Intn(3) - 1
+		expectedRank := sort.SearchInts(sorted, key)
+		if rank := alex.Rank(key); rank != expectedRank {
+			t.Fatalf("rank of %d: expected %d, got %d", key, expectedRank, rank)
+		}
+
+		hi := key + rng.Intn(1e9)
+		expectedCount := sort.SearchInts(sorted, hi+1) - expectedRank
+		if count := alex.CountRange(key, hi); count != expectedCount {
+			t.Fatalf("count of [%d, %d]: expected %d, got %d", key, hi, expectedCount, count)
+		}
+
+		k := rng.Intn(len(sorted))
+		selected, _, err := alex.Select(k)
+		if err != nil || selected != sorted[k] {
+			t.Fatalf("select %d: expected %d, got %d (%v)", k, sorted[k], selected, err)
+		}
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	rng := rand.New(rand.NewSource(21))
+	keys := GenerateExponentialKeys(200_000, 21)
+	alex := index.NewIndex()
+	inserted := make([]int, 0, len(keys))
+	for start := 0; start < len(keys); start += 20_000 {
+		chunk := keys[start : start+20_000]
+		if start%40_000 == 0 {
+			for i, key := range chunk {
+				if err := alex.Insert(key, start+i); err != nil {
+					t.Fatal(err)
+				}
+			}
+		} else if err := alex.InsertBatch(chunk, indices(start, start+20_000)); err != nil {
+			t.Fatal(err)
+		}
+		inserted = append(inserted, chunk...)
+		sorted := append([]int(nil), inserted...)
+		sort.Ints(sorted)
+		checkAggregates(t, rng, alex, sorted)
+	}
+
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+	lo, hi := sorted[1_000], sorted[50_000]
+	alex.DeleteRange(lo, hi)
+	remaining := append(append([]int(nil), sorted[:1_000]...), sorted[50_000:]...)
+	checkAggregates(t, rng, alex, remaining)
+
+	if alex.CountRange(shared.MinKey, shared.MaxKey) != len(remaining) {
+		t.Fatal("the full range must count every key")
+	}
+	if _, _, err := alex.Select(len(remaining)); !errors.Is(err, shared.RankOutOfRangeError) {
+		t.Fatalf("expected RankOutOfRangeError, got %v", err)
+	}
+	if _, _, err := alex.Select(-1); !errors.Is(err, shared.RankOutOfRangeError) {
+		t.Fatalf("expected RankOutOfRangeError, got %v", err)
+	}
+}
+
+func TestSubtreeCountsKeptUpToDate(t *testing.T) {
+	rng := rand.New(rand.NewSource(22))
+	keys := GenerateRandomKeys(100_000)
+	alex := index.NewIndex()
+	// The extremes first, so that the key domain never has to expand past them
+	keys[0], keys[1] = 0, 2*len(keys)
+	for i, key := range keys[:10_000] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inserted := slices.Clone(keys[:10_000])
+	slices.Sort(inserted)
+	checkAggregates(t, rng, alex, inserted)
+
+	stats := alex.GetStats()
+	for start := 10_000; start < len(keys); start += 30_000 {
+		chunk := keys[start:min(start+30_000, len(keys))]
+		for i, key := range chunk {
+			if err := alex.Insert(key, start+i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		inserted = append(inserted, chunk...)
+		slices.Sort(inserted)
+		// Deletes that empty and merge whole data nodes, and a few single keys
+		lo := inserted[rng.Intn(len(inserted)/2)]
+		hi := lo + len(keys)/10
+		alex.DeleteRange(lo, hi)
+		inserted = slices.DeleteFunc(inserted, func(key int) bool { return lo <= key && key < hi })
+		for i := 0; i < 100; i++ {
+			position := rng.Intn(len(inserted))
+			alex.Delete(inserted[position])
+			inserted = slices.Delete(inserted, position, position+1)
+		}
+		checkAggregates(t, rng, alex, inserted)
+	}
+
+	after := alex.GetStats()
+	if after.NumSidewaysSplits+after.NumDownwardSplits == stats.NumSidewaysSplits+stats.NumDownwardSplits {
+		t.Fatal("no data node was split")
+	}
+	if after.NumSubtreeRecounts != stats.NumSubtreeRecounts {
+		t.Fatalf("inserts, splits and deletes must update the subtree counts in place, %d recounts",
+			after.NumSubtreeRecounts-stats.NumSubtreeRecounts)
+	}
+}
+
+func TestAggregatesAfterCorrectedTraversals(t *testing.T) {
+	// Runs next to extreme keys, whose traversals are corrected into neighbouring subtrees: the inserts must count
+	// in the subtree that received them
+	keys := make([]shared.KeyType, 0, 62)
+	for key := 22220; key >= 22003; key -= 7 {
+		if key != 22024 && key != 22017 {
+			keys = append(keys, key)
+		}
+	}
+	keys = append(keys, 21828, 21821, 21814, 21807, 9223372036854742100, -24422352276160512, -24422352276160520,
+		-24422352276160528, 212, 133, 9223372036854735569, -9223372036854750293, 238069854, 21728548788109312,
+		162547609, 162547613, -9223372036854742974, -9223372036854768088, 244357122, 18594940648947712,
+		-29192033717452800, -9223372036854753894, 20897)
+	for key := 13488808649555979; key <= 13488808649555986; key++ {
+		keys = append(keys, key)
+	}
+	keys = append(keys, 20671)
+
+	alex := index.NewIndex()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted)
+	for rank, key := range sorted {
+		if got := alex.Rank(key); got != rank {
+			t.Fatalf("rank of %d: expected %d, got %d", key, rank, got)
+		}
+		if selected, _, err := alex.Select(rank); err != nil || selected != key {
+			t.Fatalf("selecting rank %d: expected %d, got %d (%v)", rank, key, selected, err)
+		}
+	}
+	if count := alex.CountRange(shared.MinKey, shared.MaxKey); count != len(keys) {
+		t.Fatalf("the full range must count every key, counted %d of %d", count, len(keys))
+	}
+	if _, _, err := alex.Select(len(keys)); !errors.Is(err, shared.RankOutOfRangeError) {
+		t.Fatalf("expected RankOutOfRangeError, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"alex_go/arena"
+	"alex_go/index"
+	"alex_go/shared"
+	"bytes"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestArenaHandlesSurviveCompaction(t *testing.T) {
+	values := arena.NewArena[string]()
+	handles := make([]arena.Handle, 0)
+	for i := 0; i < 3*shared.KArenaSlabSize; i++ {
+		handles = append(handles, values.Put(string(rune('a'+i%26))))
+	}
+	for i := 0; i < len(handles); i += 3 {
+		values.Free(handles[i])
+	}
+	values.Compact()
+	if values.Len() != len(handles)-len(handles)/3 {
+		t.Fatalf("expected %d live values, got %d", len(handles)-len(handles)/3, values.Len())
+	}
+	if values.Capacity() >= 3*shared.KArenaSlabSize {
+		t.Fatalf("compaction must release slabs, capacity %d", values.Capacity())
+	}
+	for i, handle := range handles {
+		if i%3 != 0 && values.Get(handle) != string(rune('a'+i%26)) {
+			t.Fatalf("handle %d lost its value", handle)
+		}
+	}
+
+	// Freed handles are reused
+	reused := values.Put("z")
+	if values.Get(reused) != "z" {
+		t.Fatal("a reused handle must hold its new value")
+	}
+}
+
+func TestArenaIndex(t *testing.T) {
+	keys := GenerateExponentialKeys(20_000, 29)
+	valueOf := func(key int, version byte) []byte {
+		return bytes.Repeat([]byte{byte(key), version}, 256)
+	}
+
+	alex := index.NewArenaIndex[[]byte]()
+	for _, key := range keys {
+		if err := alex.Insert(key, valueOf(key, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range keys[:10_000] {
+		if err := alex.Upsert(key, valueOf(key, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if alex.NumValues() != len(keys) {
+		t.Fatalf("upserts must update values in place, %d values for %d keys", alex.NumValues(), len(keys))
+	}
+
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+	lo, hi := sorted[0], sorted[len(sorted)/2]
+	if deleted := alex.DeleteRange(lo, hi); deleted != len(sorted)/2 {
+		t.Fatalf("expected %d keys deleted, got %d", len(sorted)/2, deleted)
+	}
+	if alex.NumValues() != len(keys)-len(sorted)/2 {
+		t.Fatalf("deleted values must be freed, %d values left", alex.NumValues())
+	}
+
+	for i, key := range keys {
+		value, err := alex.Find(key)
+		if key >= lo && key < hi {
+			if !errors.Is(err, shared.KeyNotFoundError) {
+				t.Fatalf("deleted key %d is still found", key)
+			}
+			continue
+		}
+		version := byte(0)
+		if i < 10_000 {
+			version = 1
+		}
+		if err != nil || !bytes.Equal(value, valueOf(key, version)) {
+			t.Fatalf("key %d has a wrong value", key)
+		}
+	}
+
+	numValues := alex.NumValues()
+	if deleted := alex.Delete(sorted[len(sorted)-1]); deleted != 1 || alex.NumValues() != numValues-1 {
+		t.Fatalf("deleting the largest key must free its value, deleted %d, %d values left", deleted, alex.NumValues())
+	}
+}
+
+func TestArenaIndexFailedUpsert(t *testing.T) {
+	keys := GenerateExponentialKeys(50_000, 37)
+	alex := index.NewArenaIndex[int]()
+	for _, key := range keys[:10_000] {
+		if err := alex.Insert(key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alex.Index().SetMemoryBudget(alex.Index().MemoryFootprint() + 16<<10)
+
+	// Upserts of new keys run into the budget, the values of those that fail must be freed
+	var err error
+	numKeys := 10_000
+	for _, key := range keys[10_000:] {
+		if err = alex.Upsert(key, key); err != nil {
+			break
+		}
+		numKeys++
+	}
+	if !errors.Is(err, shared.MemoryBudgetExceededError) {
+		t.Fatalf("expected the upserts to exceed the memory budget, got %v", err)
+	}
+	if alex.NumValues() != numKeys {
+		t.Fatalf("expected %d values for %d keys, got %d", numKeys, numKeys, alex.NumValues())
+	}
+}
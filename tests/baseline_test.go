@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"alex_go/baseline"
+	"alex_go/shared"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// Ordered structures the index is compared with
+type orderedBaseline interface {
+	Put(key shared.KeyType, payload shared.PayloadType)
+	Find(key shared.KeyType) (shared.PayloadType, bool)
+	Scan(from shared.KeyType, yield func(shared.KeyType, shared.PayloadType) bool)
+	Len() int
+}
+
+func TestBaselines(t *testing.T) {
+	for name, structure := range map[string]orderedBaseline{
+		"bplustree":    baseline.NewBPlusTree(),
+		"sorted-slice": baseline.NewSortedSlice(),
+	} {
+		rng := rand.New(rand.NewSource(41))
+		reference := map[int]int{}
+		for i := 0; i < 50_000; i++ {
+			key := rng.Intn(100_000)
+			structure.Put(key, i)
+			reference[key] = i
+		}
+		if structure.Len() != len(reference) {
+			t.Fatalf("%s: expected %d keys, got %d", name, len(reference), structure.Len())
+		}
+		sorted := make([]int, 0, len(reference))
+		for key, payload := range reference {
+			sorted = append(sorted, key)
+			if found, ok := structure.Find(key); !ok || found != payload {
+				t.Fatalf("%s: expected payload %d for key %d, got %d", name, payload, key, found)
+			}
+		}
+		sort.Ints(sorted)
+		if _, ok := structure.Find(-1); ok {
+			t.Fatalf("%s: found a missing key", name)
+		}
+
+		position := sort.SearchInts(sorted, 50_000)
+		structure.Scan(50_000, func(key shared.KeyType, payload shared.PayloadType) bool {
+			if key != sorted[position] || payload != reference[key] {
+				t.Fatalf("%s: expected key %d in the scan, got %d", name, sorted[position], key)
+			}
+			position++
+			return position < len(sorted)
+		})
+		if position != len(sorted) {
+			t.Fatalf("%s: the scan stopped at %d of %d keys", name, position, len(sorted))
+		}
+	}
+
+	tree := baseline.NewBPlusTree()
+	for i := 0; i < 100_000; i++ {
+		tree.Put(i, i)
+	}
+	// Nodes of 64 keys are at least half full
+	if tree.Height() < 3 || tree.Height() > 4 {
+		t.Fatalf("unexpected height %d for 100000 keys", tree.Height())
+	}
+}
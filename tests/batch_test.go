@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestInsertBatchSorted(t *testing.T) {
+	keys := GenerateRandomKeys(200_000)
+	alex := index.NewIndex()
+	// Seed the index so that batches land in existing leaves
+	if err := alex.InsertBatch(keys[:20_000], indices(0, 20_000)); err != nil {
+		t.Fatal(err)
+	}
+
+	rest := append([]int(nil), keys[20_000:]...)
+	sort.Ints(rest)
+	payloadOf := map[int]int{}
+	for i, key := range rest {
+		payloadOf[key] = 20_000 + i
+	}
+	for start := 0; start < len(rest); start += 5_000 {
+		end := min(start+5_000, len(rest))
+		if err := alex.InsertBatch(rest[start:end], indices(20_000+start, 20_000+end)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkLeafChain(t, alex, len(keys))
+
+	payloads, found := alex.FindBatch(rest)
+	for i, key := range rest {
+		if !found[i] || payloads[i] != payloadOf[key] {
+			t.Fatalf("key %d: expected payload %d, got %d (found %t)", key, payloadOf[key], payloads[i], found[i])
+		}
+	}
+	if err := SequentialLookups(alex, keys[:20_000]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchUnsortedAndMissing(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	keys := GenerateRandomKeys(100_000)
+	alex := index.NewIndex()
+	// Mostly sorted: sorted blocks in random order
+	order := rng.Perm(100)
+	batch := make([]int, 0, len(keys))
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+	for _, block := range order {
+		batch = append(batch, sorted[block*1_000:(block+1)*1_000]...)
+	}
+	if err := alex.InsertBatch(batch, indices(0, len(batch))); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, len(batch))
+
+	probes := append(append([]int(nil), batch...), -5, 1<<62)
+	rng.Shuffle(len(probes), func(i, j int) { probes[i], probes[j] = probes[j], probes[i] })
+	payloads, found := alex.FindBatch(probes)
+	position := map[int]int{}
+	for i, key := range batch {
+		position[key] = i
+	}
+	for i, key := range probes {
+		expected, ok := position[key]
+		if found[i] != ok {
+			t.Fatalf("key %d: expected found %t", key, ok)
+		}
+		if ok && payloads[i] != expected {
+			t.Fatalf("key %d: expected payload %d, got %d", key, expected, payloads[i])
+		}
+	}
+
+	if err := alex.InsertBatch([]int{1, 2}, []int{1}); !errors.Is(err, shared.BatchLengthMismatchError) {
+		t.Fatalf("expected BatchLengthMismatchError, got %v", err)
+	}
+}
+
+func indices(start int, end int) []int {
+	result := make([]int, 0, end-start)
+	for i := start; i < end; i++ {
+		result = append(result, i)
+	}
+	return result
+}
+
+func TestSortedBatchesFollowLeafChain(t *testing.T) {
+	keys := GenerateExponentialKeys(400_000, 3)
+	alex := index.NewIndex()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One key from the middle of every leaf, away from the boundaries of the ranges routed to the leaves
+	middles := make([]int, 0)
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leafKeys := make([]int, 0, leaf.NumKeys)
+		leaf.IterateFilledPositions(func(key int, _ int, _ int, _ int) {
+			leafKeys = append(leafKeys, key)
+		}, 0, leaf.DataCapacity)
+		if len(leafKeys) > 1 && leafKeys[len(leafKeys)/2]+1 < leafKeys[len(leafKeys)/2+1] {
+			middles = append(middles, leafKeys[len(leafKeys)/2])
+		}
+	}
+	if len(middles) < 10 {
+		t.Fatalf("expected the keys to spread over many leaves, got %d", len(middles))
+	}
+
+	before := alex.GetStats()
+	payloads, found := alex.FindBatch(middles)
+	after := alex.GetStats()
+	if traversed := after.NumNodeLookups - before.NumNodeLookups; traversed > int64(len(middles)/4) {
+		t.Fatalf("a sorted batch over %d leaves traversed %d nodes instead of following the leaf chain", len(middles), traversed)
+	}
+	position := map[int]int{}
+	for i, key := range keys {
+		position[key] = i
+	}
+	for i, key := range middles {
+		if !found[i] || payloads[i] != position[key] {
+			t.Fatalf("key %d: expected payload %d, got %d (found %t)", key, position[key], payloads[i], found[i])
+		}
+	}
+
+	// Keys next to the middle ones are inserted along the leaf chain as well
+	next := make([]int, len(middles))
+	for i, key := range middles {
+		next[i] = key + 1
+	}
+	before = alex.GetStats()
+	if err := alex.InsertBatch(next, indices(len(keys), len(keys)+len(next))); err != nil {
+		t.Fatal(err)
+	}
+	after = alex.GetStats()
+	if after.NumSidewaysSplits+after.NumDownwardSplits == before.NumSidewaysSplits+before.NumDownwardSplits {
+		if traversed := after.NumNodeLookups - before.NumNodeLookups; traversed > int64(len(next)/4) {
+			t.Fatalf("a sorted batch over %d leaves traversed %d nodes instead of following the leaf chain", len(next), traversed)
+		}
+	}
+	checkLeafChain(t, alex, len(keys)+len(next))
+	for i, key := range next {
+		if payload, err := alex.Find(key); err != nil || payload != len(keys)+i {
+			t.Fatalf("key %d inserted in a batch is not found: %v", key, err)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package tests
 
 import (
+	"alex_go/index"
+	"alex_go/shared"
+	"alex_go/workload"
 	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -32,3 +36,76 @@ func BenchmarkSequentialLookups(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkInsertBatchSorted(b *testing.B) {
+	b.Run("InsertBatchSorted", func(b *testing.B) {
+		keys := GenerateRandomKeys(b.N)
+		sort.Ints(keys)
+		alex := index.NewIndex()
+		b.ResetTimer()
+
+		for start := 0; start < len(keys); start += 4096 {
+			end := min(start+4096, len(keys))
+			if err := alex.InsertBatch(keys[start:end], indices(start, end)); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkYCSB(b *testing.B) {
+	mixes := []struct {
+		name string
+		mix  workload.Mix
+	}{
+		{"A", workload.WorkloadA},
+		{"B", workload.WorkloadB},
+		{"C", workload.WorkloadC},
+		{"D", workload.WorkloadD},
+		{"E", workload.WorkloadE},
+		{"F", workload.WorkloadF},
+	}
+	const numLoaded = 200_000
+	for _, distribution := range []workload.KeyDistribution{workload.UniformKeys, workload.LognormalKeys} {
+		keys := workload.GenerateKeys(distribution, 2*numLoaded, 42)
+		for _, mix := range mixes {
+			b.Run(fmt.Sprintf("%s/%s", distribution, mix.name), func(b *testing.B) {
+				alex, _, err := SequentialInserts(keys[:numLoaded])
+				if err != nil {
+					b.Fatal(err)
+				}
+				operations := workload.NewWorkload(mix.mix, keys[:numLoaded], keys[numLoaded:], 7).Operations(b.N)
+				b.ResetTimer()
+				for _, operation := range operations {
+					if err := applyOperation(alex, operation); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Runs a workload operation against the index, the payload of a key being its position in the workload
+func applyOperation(alex *index.Index, operation workload.Operation) error {
+	switch operation.Kind {
+	case workload.Read:
+		_, err := alex.Find(operation.Key)
+		return err
+	case workload.Update:
+		return alex.Update(operation.Key, operation.Key)
+	case workload.Insert:
+		return alex.Insert(operation.Key, operation.Key)
+	case workload.Scan:
+		visited := 0
+		alex.Scan(operation.Key, func(shared.KeyType, shared.PayloadType) bool {
+			visited++
+			return visited < operation.ScanLength
+		})
+		return nil
+	default:
+		return alex.Compute(operation.Key, func(payload shared.PayloadType, exists bool) (shared.PayloadType, bool) {
+			return payload + 1, exists
+		})
+	}
+}
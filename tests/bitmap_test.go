@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"alex_go/bitmap"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func compareBitmaps(naive bitmap.Bitmap, simd bitmap.Bitmap, capacity int) error {
+	if naive.Count() != simd.Count() {
+		return fmt.Errorf("count mismatch: naive %d simd %d", naive.Count(), simd.Count())
+	}
+	for i := 0; i <= capacity; i++ {
+		value := uint32(i)
+		if naive.Contains(value) != simd.Contains(value) {
+			return fmt.Errorf("contains mismatch at %d", i)
+		}
+		if naive.Rank(value) != simd.Rank(value) {
+			return fmt.Errorf("rank mismatch at %d: naive %d simd %d", i, naive.Rank(value), simd.Rank(value))
+		}
+		for _, start := range []uint32{0, value / 2, max(value, 63) - 63} {
+			if naive.CountRange(start, value) != simd.CountRange(start, value) {
+				return fmt.Errorf("count mismatch in [%d, %d): naive %d simd %d", start, value, naive.CountRange(start, value), simd.CountRange(start, value))
+			}
+		}
+	}
+	for k := -1; k <= naive.Count(); k++ {
+		naivePosition, naiveOk := naive.Select(k)
+		simdPosition, simdOk := simd.Select(k)
+		if naiveOk != simdOk || naivePosition != simdPosition {
+			return fmt.Errorf("select mismatch for k=%d: naive (%d, %v) simd (%d, %v)", k, naivePosition, naiveOk, simdPosition, simdOk)
+		}
+	}
+	return nil
+}
+
+func collectRange(b bitmap.Bitmap, start uint32, end uint32, limit int, reverse bool) []uint32 {
+	values := make([]uint32, 0)
+	yield := func(value uint32) bool {
+		values = append(values, value)
+		return len(values) < limit
+	}
+	if reverse {
+		b.RangeReverse(start, end, yield)
+	} else {
+		b.Range(start, end, yield)
+	}
+	return values
+}
+
+func TestBitmapImplementationsAgree(t *testing.T) {
+	for _, capacity := range []int{1, 63, 64, 65, 200, 1000} {
+		t.Run(fmt.Sprintf("Capacity%d", capacity), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(capacity)))
+			naive := bitmap.NewNaiveBitmap(capacity)
+			simd := bitmap.NewSIMDBitmap(capacity)
+
+			for step := 0; step < 500; step++ {
+				value := uint32(rng.Intn(capacity))
+				start := uint32(rng.Intn(capacity))
+				end := start + uint32(rng.Intn(capacity-int(start)+1))
+				switch rng.Intn(5) {
+				case 0, 1:
+					if naive.Set(value) != simd.Set(value) {
+						t.Fatalf("set(%d) reported different changes", value)
+					}
+				case 2:
+					if naive.Remove(value) != simd.Remove(value) {
+						t.Fatalf("remove(%d) reported different changes", value)
+					}
+				case 3:
+					naive.SetRange(start, end)
+					simd.SetRange(start, end)
+				case 4:
+					naive.RemoveRange(start, end)
+					simd.RemoveRange(start, end)
+				}
+
+				if err := compareBitmaps(naive, simd, capacity); err != nil {
+					t.Fatalf("step %d: %v", step, err)
+				}
+
+				limit := 1 + rng.Intn(capacity)
+				for _, reverse := range []bool{false, true} {
+					naiveValues := collectRange(naive, start, end, limit, reverse)
+					simdValues := collectRange(simd, start, end, limit, reverse)
+					if fmt.Sprint(naiveValues) != fmt.Sprint(simdValues) {
+						t.Fatalf("step %d: range [%d, %d) reverse %t mismatch: naive %v simd %v", step, start, end, reverse, naiveValues, simdValues)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBitmapSetAndRemoveAreIdempotent(t *testing.T) {
+	for name, b := range map[string]bitmap.Bitmap{
+		"Naive": bitmap.NewNaiveBitmap(128),
+		"SIMD":  bitmap.NewSIMDBitmap(128),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if !b.Set(5) || b.Set(5) {
+				t.Fatal("second set of the same bit must not report a change")
+			}
+			if b.Count() != 1 {
+				t.Fatalf("expected count 1, got %d", b.Count())
+			}
+			if !b.Remove(5) || b.Remove(5) {
+				t.Fatal("second remove of the same bit must not report a change")
+			}
+			if b.Count() != 0 {
+				t.Fatalf("expected count 0, got %d", b.Count())
+			}
+		})
+	}
+}
+
+func TestBitmapCountMatchesNumKeys(t *testing.T) {
+	alex, _, err := SequentialInserts(GenerateRandomKeys(100_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.Bitmap.Count() != leaf.NumKeys {
+			t.Fatalf("leaf bitmap count %d does not match its number of keys %d", leaf.Bitmap.Count(), leaf.NumKeys)
+		}
+	}
+}
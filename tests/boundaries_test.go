@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"testing"
+)
+
+// Inserts the keys and checks that every one of them is reachable and that a full scan visits them all
+func checkInsertedKeysReachable(t *testing.T, keys []shared.KeyType) {
+	t.Helper()
+	alex := index.NewIndex()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatalf("inserting %d: %v", key, err)
+		}
+	}
+	for _, key := range keys {
+		if _, err := alex.Find(key); err != nil {
+			t.Fatalf("key %d is unreachable: %v", key, err)
+		}
+	}
+	numScanned := 0
+	alex.Scan(shared.MinKey, func(key shared.KeyType, payload shared.PayloadType) bool {
+		numScanned++
+		return true
+	})
+	if numScanned != len(keys) {
+		t.Fatalf("a full scan visited %d keys, expected %d", numScanned, len(keys))
+	}
+}
+
+func TestSplitBoundariesOfRoundedKeys(t *testing.T) {
+	// Consecutive keys above 2^53, which float64 cannot tell apart: the split must hand every key to the data node
+	// the model node routes it to, even if inverting the model lands next to it
+	keys := make([]shared.KeyType, 0, 49)
+	for i := 0; i < 48; i++ {
+		keys = append(keys, 16690<<40+i)
+	}
+	checkInsertedKeysReachable(t, append(keys, 0))
+}
+
+func TestRootExpansionBoundaries(t *testing.T) {
+	// Two runs of negative keys, then a run of positive keys expands the root next to them: the new data nodes
+	// must take exactly the keys the new root model routes to them
+	keys := make([]shared.KeyType, 0, 167)
+	for i := 0; i < 63; i++ {
+		keys = append(keys, 55-1<<15+2*i)
+	}
+	for i := 0; i < 55; i++ {
+		keys = append(keys, 49-1<<15-i)
+	}
+	for i := 0; i < 48; i++ {
+		keys = append(keys, 48+i)
+	}
+	checkInsertedKeysReachable(t, append(keys, 0))
+}
+
+func TestCorrectedPathIntoModelNode(t *testing.T) {
+	// A descending run, then extreme keys split the root next to it: correcting the traversal of a key predicted
+	// past its leaf crosses a bucket holding a model node, which the corrected path must descend into
+	keys := make([]shared.KeyType, 0, 46)
+	for key := 69; key >= -187; key -= 8 {
+		keys = append(keys, key)
+	}
+	keys = append(keys, -25719775996936227, 9223372036854756754, 9223372036854717516, 9223372036854717514, 36753555,
+		-9223372036854711735, -9223372036854773852, 10979723114971136, -9223372036854762988, -9223372036854770157,
+		-9223372036854732278, 47, 41)
+	checkInsertedKeysReachable(t, keys)
+}
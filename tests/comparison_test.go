@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"alex_go/baseline"
+	"alex_go/index"
+	"alex_go/shared"
+	"alex_go/workload"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// Operations of the compared ordered indexes used by the comparison benchmarks
+type comparedIndex interface {
+	Insert(key shared.KeyType, payload shared.PayloadType) error
+	Find(key shared.KeyType) (shared.PayloadType, bool)
+	Len() int
+	// Average number of nodes, or of memory accesses for flat structures, visited by a lookup
+	Depth() float64
+}
+
+type alexCompared struct {
+	alex *index.Index
+}
+
+func (self alexCompared) Insert(key shared.KeyType, payload shared.PayloadType) error {
+	return self.alex.Insert(key, payload)
+}
+
+func (self alexCompared) Find(key shared.KeyType) (shared.PayloadType, bool) {
+	payload, err := self.alex.Find(key)
+	if err != nil {
+		return 0, false
+	}
+	return payload, true
+}
+
+func (self alexCompared) Len() int {
+	return self.alex.GetStats().NumKeys
+}
+
+func (self alexCompared) Depth() float64 {
+	depth, _ := self.alex.Depth()
+	return depth
+}
+
+type mapCompared map[shared.KeyType]shared.PayloadType
+
+func (self mapCompared) Insert(key shared.KeyType, payload shared.PayloadType) error {
+	self[key] = payload
+	return nil
+}
+
+func (self mapCompared) Find(key shared.KeyType) (shared.PayloadType, bool) {
+	payload, ok := self[key]
+	return payload, ok
+}
+
+func (self mapCompared) Len() int {
+	return len(self)
+}
+
+func (self mapCompared) Depth() float64 {
+	return 1
+}
+
+type sortedSliceCompared struct {
+	*baseline.SortedSlice
+}
+
+func (self sortedSliceCompared) Insert(key shared.KeyType, payload shared.PayloadType) error {
+	self.Put(key, payload)
+	return nil
+}
+
+// Probes of the binary search
+func (self sortedSliceCompared) Depth() float64 {
+	return math.Ceil(math.Log2(float64(self.Len() + 1)))
+}
+
+type bPlusTreeCompared struct {
+	*baseline.BPlusTree
+}
+
+func (self bPlusTreeCompared) Insert(key shared.KeyType, payload shared.PayloadType) error {
+	self.Put(key, payload)
+	return nil
+}
+
+func (self bPlusTreeCompared) Depth() float64 {
+	return float64(self.Height())
+}
+
+// Heap bytes in use after a garbage collection
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// BenchmarkComparison Runs the same reads and inserts of new keys against the index and its baselines, per dataset
+// and read fraction. Reports the throughput, the allocations per operation, the heap bytes per key held by each
+// structure once the operations ran and the depth of a lookup.
+func BenchmarkComparison(b *testing.B) {
+	const numLoaded = 100_000
+	datasets := []struct {
+		name     string
+		generate func(n int) []shared.KeyType
+	}{
+		{"uniform", func(n int) []shared.KeyType { return workload.GenerateKeys(workload.UniformKeys, n, 42) }},
+		{"lognormal", func(n int) []shared.KeyType { return workload.GenerateKeys(workload.LognormalKeys, n, 42) }},
+		{"books", func(n int) []shared.KeyType { return workload.GenerateDataset(workload.BooksDataset, n, 42) }},
+		{"fb", func(n int) []shared.KeyType { return workload.GenerateDataset(workload.FacebookDataset, n, 42) }},
+		{"osm", func(n int) []shared.KeyType { return workload.GenerateDataset(workload.OsmDataset, n, 42) }},
+		{"wiki", func(n int) []shared.KeyType { return workload.GenerateDataset(workload.WikiDataset, n, 42) }},
+	}
+	structures := []struct {
+		name  string
+		build func() comparedIndex
+	}{
+		{"alex", func() comparedIndex { return alexCompared{index.NewIndex()} }},
+		{"map", func() comparedIndex { return mapCompared{} }},
+		{"sorted-slice", func() comparedIndex { return sortedSliceCompared{baseline.NewSortedSlice()} }},
+		{"bplustree", func() comparedIndex { return bPlusTreeCompared{baseline.NewBPlusTree()} }},
+	}
+
+	for _, dataset := range datasets {
+		for _, readFrac := range []float64{1, 0.95, 0.5, 0.05} {
+			for _, structure := range structures {
+				name := fmt.Sprintf("%s/reads=%v/%s", dataset.name, readFrac, structure.name)
+				b.Run(name, func(b *testing.B) {
+					// Enough keys for every insert to add a new key, shuffled since datasets are sorted
+					keys := dataset.generate(numLoaded + int(float64(b.N)*(1-readFrac)) + 1)
+					rand.New(rand.NewSource(7)).Shuffle(len(keys), func(i int, j int) {
+						keys[i], keys[j] = keys[j], keys[i]
+					})
+					mix := workload.Mix{ReadFrac: readFrac, InsertFrac: 1 - readFrac, Requests: workload.UniformRequestDistribution}
+					operations := workload.NewWorkload(mix, keys[:numLoaded], keys[numLoaded:], 7).Operations(b.N)
+
+					before := heapInUse()
+					compared := structure.build()
+					for i, key := range keys[:numLoaded] {
+						if err := compared.Insert(key, i); err != nil {
+							b.Fatal(err)
+						}
+					}
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i, operation := range operations {
+						if operation.Kind == workload.Insert {
+							if err := compared.Insert(operation.Key, i); err != nil {
+								b.Fatal(err)
+							}
+						} else if _, ok := compared.Find(operation.Key); !ok {
+							b.Fatalf("key %d not found", operation.Key)
+						}
+					}
+					b.StopTimer()
+
+					b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "ops/s")
+					after := heapInUse()
+					b.ReportMetric(float64(after-min(before, after))/float64(compared.Len()), "bytes/key")
+					b.ReportMetric(compared.Depth(), "depth")
+					// Only the structure may be collected between the two measures of the heap
+					runtime.KeepAlive(keys)
+					runtime.KeepAlive(operations)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"alex_go/cost_models"
+	"alex_go/index"
+	"alex_go/shared"
+	"math"
+	"testing"
+)
+
+// countingCostModel Wraps a cost model and counts how often the index consults it
+type countingCostModel struct {
+	cost_models.CostModel
+	numDataNodeCosts int
+	numModelSizeCost int
+}
+
+func (c *countingCostModel) DataNodeCost(expSearchIterations float64, shifts float64, fracInserts float64) float64 {
+	c.numDataNodeCosts++
+	return c.CostModel.DataNodeCost(expSearchIterations, shifts, fracInserts)
+}
+
+func (c *countingCostModel) ModelSizeCost(modelSize float64, totalKeys int, numKeys int) float64 {
+	c.numModelSizeCost++
+	return c.CostModel.ModelSizeCost(modelSize, totalKeys, numKeys)
+}
+
+func TestCalibrateProducesUsableWeights(t *testing.T) {
+	model := cost_models.Calibrate(cost_models.CalibrationConfig{
+		WorkingSetBytes: 1 << 20,
+		NumSamples:      1 << 12,
+		Seed:            1,
+	})
+	for name, weight := range map[string]float64{
+		"ExpSearchIterationsWeight": model.ExpSearchIterationsWeight,
+		"ShiftsWeight":              model.ShiftsWeight,
+		"TraversalWeight":           model.TraversalWeight,
+		"ModelSizeWeight":           model.ModelSizeWeight,
+	} {
+		if weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+			t.Errorf("%s must be a positive finite weight, got %f", name, weight)
+		}
+	}
+	// Calibrated weights are on the scale of the default ones
+	if model.TraversalWeight != shared.KNodeLookupsWeight || model.ModelSizeWeight != shared.KModelSizeWeight {
+		t.Errorf("expected the default traversal and model size weights, got %f and %g", model.TraversalWeight, model.ModelSizeWeight)
+	}
+
+	alex := index.NewIndex()
+	alex.SetCostModel(model)
+	keys := GenerateRandomKeys(50_000)
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCostModelIsConsulted(t *testing.T) {
+	model := &countingCostModel{CostModel: cost_models.NewDefaultCostModel()}
+	alex := index.NewIndex()
+	alex.SetCostModel(model)
+	keys := GenerateRandomKeys(50_000)
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if model.numDataNodeCosts == 0 {
+		t.Error("data node costs were never computed through the cost model")
+	}
+	if model.numModelSizeCost == 0 {
+		t.Error("fanout selection never consulted the cost model")
+	}
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+}
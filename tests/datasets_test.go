@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"alex_go/shared"
+	"alex_go/workload"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSOSDFormat(t *testing.T) {
+	keys := workload.GenerateDataset(workload.OsmDataset, 10_000, 3)
+	path := filepath.Join(t.TempDir(), "osm_10K_uint64")
+	if err := workload.WriteSOSD(path, keys); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := workload.LoadSOSD(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(loaded, keys) {
+		t.Fatal("the loaded keys differ from the written ones")
+	}
+
+	// The count is followed by fewer keys than it announces
+	var truncated bytes.Buffer
+	binary.Write(&truncated, binary.LittleEndian, []uint64{3, 1, 2})
+	if _, err := workload.ReadSOSD(&truncated); err == nil {
+		t.Fatal("a truncated file must fail to load")
+	}
+	// A prefix stops reading before the missing keys
+	truncated.Reset()
+	binary.Write(&truncated, binary.LittleEndian, []uint64{3, 1, 2})
+	if prefix, err := workload.ReadSOSDPrefix(&truncated, 2); err != nil || !slices.Equal(prefix, []shared.KeyType{1, 2}) {
+		t.Fatalf("expected the first 2 keys, got %v, %v", prefix, err)
+	}
+	var outOfRange bytes.Buffer
+	binary.Write(&outOfRange, binary.LittleEndian, []uint64{2, 1, 1 << 63})
+	if _, err := workload.ReadSOSD(&outOfRange); !errors.Is(err, shared.KeyOutOfRangeError) {
+		t.Fatalf("expected KeyOutOfRangeError, got %v", err)
+	}
+}
+
+func TestGenerateDatasets(t *testing.T) {
+	for _, dataset := range []workload.Dataset{workload.BooksDataset, workload.FacebookDataset, workload.OsmDataset, workload.WikiDataset} {
+		keys := workload.GenerateDataset(dataset, 100_000, 7)
+		if !slices.Equal(keys, workload.GenerateDataset(dataset, 100_000, 7)) {
+			t.Fatalf("%s keys differ for the same seed", dataset)
+		}
+		if !slices.IsSorted(keys) || len(slices.Compact(slices.Clone(keys))) != len(keys) {
+			t.Fatalf("%s keys must be sorted and distinct", dataset)
+		}
+		if keys[0] < 0 {
+			t.Fatalf("%s keys must not be negative", dataset)
+		}
+
+		alex, _, err := SequentialInserts(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SequentialLookups(alex, keys); err != nil {
+			t.Fatalf("%s: %v", dataset, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"errors"
+	"sort"
+	"testing"
+)
+
+func TestDeleteRange(t *testing.T) {
+	keys := GenerateExponentialKeys(200_000, 13)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+
+	// Drop the oldest third, then a slice in the middle
+	lo, hi := sorted[0], sorted[len(sorted)/3]
+	if deleted := alex.DeleteRange(lo, hi); deleted != len(sorted)/3 {
+		t.Fatalf("expected %d keys deleted, got %d", len(sorted)/3, deleted)
+	}
+	midLo, midHi := sorted[len(sorted)/2], sorted[len(sorted)/2+1_000]
+	if deleted := alex.DeleteRange(midLo, midHi); deleted != 1_000 {
+		t.Fatalf("expected 1000 keys deleted, got %d", deleted)
+	}
+	if deleted := alex.DeleteRange(midHi, midLo); deleted != 0 {
+		t.Fatalf("an empty range must not delete anything, deleted %d", deleted)
+	}
+
+	remaining := 0
+	for i, key := range keys {
+		deleted := (key >= lo && key < hi) || (key >= midLo && key < midHi)
+		payload, err := alex.Find(key)
+		if deleted {
+			if !errors.Is(err, shared.KeyNotFoundError) {
+				t.Fatalf("deleted key %d is still found", key)
+			}
+			continue
+		}
+		remaining++
+		if err != nil || payload != i {
+			t.Fatalf("key %d lost after deleting other ranges", key)
+		}
+	}
+	checkLeafChain(t, alex, remaining)
+	if alex.GetMinKey() != hi {
+		t.Fatalf("expected min key %d, got %d", hi, alex.GetMinKey())
+	}
+	if alex.GetMaxKey() != sorted[len(sorted)-1] {
+		t.Fatalf("expected max key %d, got %d", sorted[len(sorted)-1], alex.GetMaxKey())
+	}
+
+	// Deleted ranges accept inserts again
+	for i, key := range keys {
+		if (key >= lo && key < hi) || (key >= midLo && key < midHi) {
+			if err := alex.Insert(key, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, len(keys))
+}
+
+func TestDeleteEverything(t *testing.T) {
+	keys := GenerateExponentialKeys(50_000, 17)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	numLeaves := countLeaves(alex)
+	if deleted := alex.DeleteRange(shared.MinKey, shared.MaxKey); deleted != len(keys) {
+		t.Fatalf("expected %d keys deleted, got %d", len(keys), deleted)
+	}
+	checkLeafChain(t, alex, 0)
+	if countLeaves(alex) >= numLeaves {
+		t.Fatalf("empty data nodes must be merged, still %d out of %d", countLeaves(alex), numLeaves)
+	}
+	if alex.GetMinKey() != shared.MaxKey || alex.GetMaxKey() != shared.MinKey {
+		t.Fatal("an empty index has no min or max key")
+	}
+
+	alex2 := index.NewIndex()
+	for _, target := range []*index.Index{alex, alex2} {
+		for i, key := range keys {
+			if err := target.Insert(key, i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := SequentialLookups(target, keys); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteExtremeKeys(t *testing.T) {
+	alex := index.NewIndex()
+	keys := []shared.KeyType{shared.MinKey, -1, 0, 1, shared.MaxKey, shared.MaxKey}
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// DeleteRange excludes hi, so it cannot reach MaxKey, Delete does
+	if deleted := alex.DeleteRange(1, shared.MaxKey); deleted != 1 {
+		t.Fatalf("expected 1 key deleted, got %d", deleted)
+	}
+	if deleted := alex.Delete(shared.MaxKey); deleted != 2 {
+		t.Fatalf("expected both copies of MaxKey deleted, got %d", deleted)
+	}
+	if _, err := alex.Find(shared.MaxKey); !errors.Is(err, shared.KeyNotFoundError) {
+		t.Fatalf("deleted MaxKey is still found: %v", err)
+	}
+	if deleted := alex.Delete(shared.MinKey); deleted != 1 {
+		t.Fatalf("expected MinKey deleted, got %d", deleted)
+	}
+	if deleted := alex.Delete(shared.MinKey); deleted != 0 {
+		t.Fatalf("deleting a missing key must not delete anything, deleted %d", deleted)
+	}
+	if alex.GetMinKey() != -1 || alex.GetMaxKey() != 0 {
+		t.Fatalf("expected keys in [-1, 0], got [%d, %d]", alex.GetMinKey(), alex.GetMaxKey())
+	}
+	checkLeafChain(t, alex, 2)
+}
+
+func countLeaves(alex *index.Index) int {
+	numLeaves := 0
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		numLeaves++
+	}
+	return numLeaves
+}
+
+func TestDeleteRangeOfRoundedKeys(t *testing.T) {
+	// Consecutive keys above 2^53, which float64 cannot tell apart, so that models route them by rounded values:
+	// ranges straddling the boundaries of the leaves must reach the keys on both sides
+	keys := make([]shared.KeyType, 0, 20_000)
+	for i := 0; i < 20_000; i++ {
+		keys = append(keys, 16690<<40+i)
+	}
+	alex := index.NewIndex()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	boundaries := make([]shared.KeyType, 0)
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.NumKeys > 0 && leaf != alex.FirstDataNode() {
+			boundaries = append(boundaries, leaf.GetFirstKey())
+		}
+	}
+	if len(boundaries) == 0 {
+		t.Fatal("expected the keys to span several leaves")
+	}
+
+	deleted := make(map[shared.KeyType]bool)
+	for _, boundary := range boundaries {
+		expected := 0
+		for key := boundary - 2; key < boundary+2; key++ {
+			if !deleted[key] {
+				expected++
+				deleted[key] = true
+			}
+		}
+		if numDeleted := alex.DeleteRange(boundary-2, boundary+2); numDeleted != expected {
+			t.Fatalf("expected %d keys deleted around %d, got %d", expected, boundary, numDeleted)
+		}
+	}
+	for i, key := range keys {
+		payload, err := alex.Find(key)
+		if deleted[key] {
+			if !errors.Is(err, shared.KeyNotFoundError) {
+				t.Fatalf("deleted key %d is still found", key)
+			}
+			continue
+		}
+		if err != nil || payload != i {
+			t.Fatalf("key %d lost after deleting other ranges", key)
+		}
+	}
+	checkLeafChain(t, alex, len(keys)-len(deleted))
+}
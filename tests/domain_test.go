@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Inserts keys in order, then checks that every key is found with its payload and that a full scan returns them
+// sorted
+func checkReachableAfterInserts(t *testing.T, keys []shared.KeyType) *index.Index {
+	alex := index.NewIndex()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatalf("inserting %d: %v", key, err)
+		}
+	}
+	for i, key := range keys {
+		payload, err := alex.Find(key)
+		if err != nil {
+			t.Fatalf("key %d is unreachable: %v", key, err)
+		}
+		if payload != i {
+			t.Fatalf("expected payload %d for key %d, got %d", i, key, payload)
+		}
+	}
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted)
+	scanned := make([]shared.KeyType, 0, len(keys))
+	alex.Scan(shared.MinKey, func(key shared.KeyType, payload shared.PayloadType) bool {
+		scanned = append(scanned, key)
+		return true
+	})
+	if !slices.Equal(scanned, sorted) {
+		t.Fatalf("a full scan returned %d keys, expected %d", len(scanned), len(sorted))
+	}
+	return alex
+}
+
+func TestRootExpansionPreservesReachability(t *testing.T) {
+	rng := rand.New(rand.NewSource(31))
+	// Dense run of keys from start with the given stride
+	run := func(start shared.KeyType, n int, stride int) []shared.KeyType {
+		keys := make([]shared.KeyType, n)
+		for i := range keys {
+			keys[i] = start + shared.KeyType(i*stride)
+		}
+		return keys
+	}
+
+	testCases := []struct {
+		name string
+		keys []shared.KeyType
+	}{
+		{"NegativeAppends", run(-1, 20_000, -3)},
+		{"NegativeAndPositive", slices.Concat(run(0, 10_000, 1), run(-1, 10_000, -1))},
+		{"ExtremesFirst", slices.Concat([]shared.KeyType{shared.MinKey, shared.MaxKey}, run(-5_000, 10_000, 1))},
+		{"ExtremesLast", slices.Concat(run(-5_000, 10_000, 1), []shared.KeyType{shared.MaxKey, shared.MinKey})},
+		{"NextToExtremes", slices.Concat(run(100, 5_000, 1), run(shared.MaxKey, 5_000, -1), run(shared.MinKey, 5_000, 1))},
+		{"FarFirstInsert", slices.Concat([]shared.KeyType{1 << 60}, run(0, 20_000, 2))},
+		{"FarNegativeFirstInsert", slices.Concat([]shared.KeyType{-1 << 60}, run(0, 20_000, 2))},
+		{"GrowingGaps", func() []shared.KeyType {
+			keys := make([]shared.KeyType, 0)
+			for shift := 8; shift < 62; shift++ {
+				keys = append(keys, run(1<<shift, 200, 1)...)
+				keys = append(keys, run(-1<<shift-200, 200, 1)...)
+			}
+			return keys
+		}()},
+		{"RandomSpread", func() []shared.KeyType {
+			keys := make([]shared.KeyType, 0)
+			for len(keys) < 20_000 {
+				// Clusters at random magnitudes and signs
+				start := shared.KeyType(rng.Int63n(1<<uint(rng.Intn(62)+1))) * shared.KeyType(rng.Intn(2)*2-1)
+				keys = append(keys, run(start, 100, 1)...)
+			}
+			slices.Sort(keys)
+			keys = slices.Compact(keys)
+			rng.Shuffle(len(keys), func(i int, j int) {
+				keys[i], keys[j] = keys[j], keys[i]
+			})
+			return keys
+		}()},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			alex := checkReachableAfterInserts(t, testCase.keys)
+			if numKeys := alex.GetStats().NumKeys; numKeys != len(testCase.keys) {
+				t.Fatalf("expected %d keys, got %d", len(testCase.keys), numKeys)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDataNodeErrors(t *testing.T) {
+	dataNode := node.NewDataNode(4)
+	for i := 0; i < dataNode.DataCapacity; i++ {
+		dataNode.InsertElementAt(10*(i+1), i, i)
+	}
+	keys := slices.Clone(dataNode.Keys)
+
+	// A full node reports that no gap was found and is left unchanged
+	if _, err := dataNode.InsertUsingShifts(25, 0, 2); !errors.Is(err, shared.NoGapFoundError) {
+		t.Fatalf("expected NoGapFoundError, got %v", err)
+	}
+	if !slices.Equal(dataNode.Keys, keys) || dataNode.Bitmap.Count() != dataNode.DataCapacity {
+		t.Fatal("a failed insert must leave the data node unchanged")
+	}
+
+	if err := dataNode.BulkLoad(make([]shared.PayloadType, 2), 2, nil, false); !errors.Is(err, shared.NotImplementedError) {
+		t.Fatalf("expected NotImplementedError, got %v", err)
+	}
+	if !slices.Equal(dataNode.Keys, keys) {
+		t.Fatal("a failed bulk load must leave the data node unchanged")
+	}
+
+	err := node.NewDataNode(0).BulkLoadFromExisting(dataNode, 0, dataNode.DataCapacity+1, true, true, nil, -1)
+	if !errors.Is(err, shared.InvalidRangeError) {
+		t.Fatalf("expected InvalidRangeError, got %v", err)
+	}
+}
+
+func TestModelNodeErrors(t *testing.T) {
+	modelNode := node.NewModelNode(0)
+	modelNode.NumChildren = 2
+	modelNode.Children = []node.Node{node.NewDataNode(1), node.NewDataNode(1)}
+	if _, err := modelNode.Expand(-1); !errors.Is(err, shared.InvalidExpansionFactorError) {
+		t.Fatalf("expected InvalidExpansionFactorError, got %v", err)
+	}
+	if modelNode.NumChildren != 2 || len(modelNode.Children) != 2 {
+		t.Fatal("a failed expansion must leave the model node unchanged")
+	}
+
+	expansionFactor, err := modelNode.Expand(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expansionFactor != 2 || modelNode.NumChildren != 4 || modelNode.Children[1] != modelNode.Children[0] {
+		t.Fatalf("expected the children to be duplicated, got %d children", modelNode.NumChildren)
+	}
+}
+
+func TestFailedInsertsLeaveIndexConsistent(t *testing.T) {
+	keys := GenerateExponentialKeys(200_000, 37)
+	alex := index.NewIndex()
+	alex.SetMemoryBudget(1 << 20)
+	reference := newReferenceMap()
+
+	numFailures, numFailedSplits := 0, 0
+	for i, key := range keys {
+		err := alex.Insert(key, i)
+		if err == nil {
+			reference.insert(key, i)
+			continue
+		}
+		var budgetErr *shared.MemoryBudgetError
+		if !errors.As(err, &budgetErr) {
+			t.Fatalf("inserting %d: expected the budget to be exceeded, got %v", key, err)
+		}
+		numFailures++
+		if budgetErr.Splitting {
+			numFailedSplits++
+		}
+		// The key is not inserted, the splits completed before the failure stay in place
+		after := alex.GetStats()
+		if after.NumKeys != reference.numKeys {
+			t.Fatalf("inserting %d failed but the index holds %d keys, expected %d", key, after.NumKeys, reference.numKeys)
+		}
+		if _, err := alex.Find(key); !errors.Is(err, shared.KeyNotFoundError) {
+			t.Fatalf("inserting %d failed but the key is found: %v", key, err)
+		}
+		if numFailures%500 == 1 {
+			checkAgainstReference(t, alex, reference)
+		}
+	}
+	if numFailures == 0 || numFailedSplits == 0 {
+		t.Fatalf("expected inserts to fail before and while splitting, %d failures, %d while splitting", numFailures, numFailedSplits)
+	}
+	checkAgainstReference(t, alex, reference)
+	checkLeafChain(t, alex, reference.numKeys)
+	checkFootprint(t, alex)
+}
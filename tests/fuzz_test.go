@@ -0,0 +1,428 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"errors"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// Sorted map of keys to the payloads inserted for them, the reference the index is compared with
+type referenceMap struct {
+	// Distinct keys in ascending order
+	keys     []shared.KeyType
+	payloads map[shared.KeyType][]shared.PayloadType
+	numKeys  int
+}
+
+func newReferenceMap() *referenceMap {
+	return &referenceMap{payloads: map[shared.KeyType][]shared.PayloadType{}}
+}
+
+func (self *referenceMap) insert(key shared.KeyType, payload shared.PayloadType) {
+	if _, ok := self.payloads[key]; !ok {
+		position := sort.SearchInts(self.keys, key)
+		self.keys = slices.Insert(self.keys, position, key)
+	}
+	self.payloads[key] = append(self.payloads[key], payload)
+	self.numKeys++
+}
+
+// Deletes the keys in [lo, hi) and returns how many copies were deleted
+func (self *referenceMap) deleteRange(lo shared.KeyType, hi shared.KeyType) int {
+	if lo >= hi {
+		return 0
+	}
+	start, end := sort.SearchInts(self.keys, lo), sort.SearchInts(self.keys, hi)
+	numDeleted := 0
+	for _, key := range self.keys[start:end] {
+		numDeleted += len(self.payloads[key])
+		delete(self.payloads, key)
+	}
+	self.keys = slices.Delete(self.keys, start, end)
+	self.numKeys -= numDeleted
+	return numDeleted
+}
+
+// Replaces one copy of payload of key with replacement, as updating the copy the index finds does
+func (self *referenceMap) replace(key shared.KeyType, payload shared.PayloadType, replacement shared.PayloadType) bool {
+	position := slices.Index(self.payloads[key], payload)
+	if position < 0 {
+		return false
+	}
+	self.payloads[key][position] = replacement
+	return true
+}
+
+// k-th smallest copy of the keys, counting from 0
+func (self *referenceMap) selectKey(k int) (shared.KeyType, bool) {
+	for _, key := range self.keys {
+		if k < len(self.payloads[key]) {
+			return key, true
+		}
+		k -= len(self.payloads[key])
+	}
+	return 0, false
+}
+
+// Number of copies of the keys smaller than key, or smaller than or equal to key if inclusive
+func (self *referenceMap) countBefore(key shared.KeyType, inclusive bool) int {
+	end := sort.Search(len(self.keys), func(i int) bool {
+		return self.keys[i] > key || (!inclusive && self.keys[i] == key)
+	})
+	count := 0
+	for _, key := range self.keys[:end] {
+		count += len(self.payloads[key])
+	}
+	return count
+}
+
+// Every copy of the keys in ascending order
+func (self *referenceMap) expandedKeys(from int, to int) []shared.KeyType {
+	expanded := make([]shared.KeyType, 0)
+	for _, key := range self.keys[from:to] {
+		for range self.payloads[key] {
+			expanded = append(expanded, key)
+		}
+	}
+	return expanded
+}
+
+// Reads the operations of a fuzz input, reading past its end returns zeros
+type fuzzReader struct {
+	data     []byte
+	position int
+}
+
+func (self *fuzzReader) done() bool {
+	return self.position >= len(self.data)
+}
+
+func (self *fuzzReader) byte() byte {
+	if self.done() {
+		return 0
+	}
+	self.position++
+	return self.data[self.position-1]
+}
+
+func (self *fuzzReader) uint16() int {
+	return int(self.byte())<<8 | int(self.byte())
+}
+
+// Reads a key, from one of several ranges chosen by the first byte, so that inputs reach dense clusters, sparse
+// keys, negative keys and keys next to the extremes of KeyType
+func (self *fuzzReader) key() shared.KeyType {
+	switch mode := self.byte(); mode % 6 {
+	case 0:
+		// Dense, many keys per data node
+		return shared.KeyType(self.byte())
+	case 1:
+		return shared.KeyType(self.uint16()) - 1<<15
+	case 2:
+		// Sparse, far apart keys spread the root model
+		return shared.KeyType(int16(self.uint16())) << 40
+	case 3:
+		return shared.MinKey + shared.KeyType(self.uint16())
+	case 4:
+		return shared.MaxKey - shared.KeyType(self.uint16())
+	default:
+		return shared.KeyType(mode)<<20 + shared.KeyType(self.uint16())
+	}
+}
+
+// Adds width to key without overflowing
+func saturatingAdd(key shared.KeyType, width int) shared.KeyType {
+	if key > shared.MaxKey-width {
+		return shared.MaxKey
+	}
+	return key + width
+}
+
+// Runs the operations encoded by data against a new index and the reference, and fails as soon as they disagree
+func runDifferential(t *testing.T, data []byte) {
+	runDifferentialOn(t, index.NewIndex(), data)
+}
+
+// Runs the operations encoded by data against alex, empty but possibly configured, see runDifferential
+func runDifferentialOn(t *testing.T, alex *index.Index, data []byte) {
+	reference := newReferenceMap()
+	reader := &fuzzReader{data: data}
+	for step := 0; !reader.done(); step++ {
+		switch operation := reader.byte(); operation % 16 {
+		case 0, 1:
+			key := reader.key()
+			if err := alex.Insert(key, step); err != nil {
+				t.Fatalf("step %d: inserting %d: %v", step, key, err)
+			}
+			reference.insert(key, step)
+		case 2:
+			// A run of keys with a constant stride, ascending or descending, as appends and prepends do
+			key, length, stride := reader.key(), int(reader.byte()%64), int(reader.byte()%8)+1
+			if operation&0x80 != 0 {
+				stride = -stride
+			}
+			for i := 0; i < length; i++ {
+				if err := alex.Insert(key, step); err != nil {
+					t.Fatalf("step %d: inserting %d: %v", step, key, err)
+				}
+				reference.insert(key, step)
+				if (stride > 0 && key > shared.MaxKey-stride) || (stride < 0 && key < shared.MinKey-stride) {
+					break
+				}
+				key += stride
+			}
+		case 3:
+			key := reader.key()
+			payload, err := alex.Find(key)
+			expected, ok := reference.payloads[key]
+			if ok != (err == nil) {
+				t.Fatalf("step %d: finding %d: expected found %v, got %v", step, key, ok, err)
+			}
+			if ok && !slices.Contains(expected, payload) {
+				t.Fatalf("step %d: finding %d: unexpected payload %d", step, key, payload)
+			}
+			if !ok && !errors.Is(err, shared.KeyNotFoundError) {
+				t.Fatalf("step %d: finding %d: expected KeyNotFoundError, got %v", step, key, err)
+			}
+		case 4:
+			lo := reader.key()
+			hi := saturatingAdd(lo, reader.uint16())
+			if deleted, expected := alex.DeleteRange(lo, hi), reference.deleteRange(lo, hi); deleted != expected {
+				t.Fatalf("step %d: deleting [%d, %d): expected %d deleted keys, got %d", step, lo, hi, expected, deleted)
+			}
+		case 5:
+			from, n := reader.key(), int(reader.byte()%32)+1
+			visited := make([]shared.KeyType, 0, n)
+			alex.Scan(from, func(key shared.KeyType, payload shared.PayloadType) bool {
+				visited = append(visited, key)
+				return len(visited) < n
+			})
+			start := sort.SearchInts(reference.keys, from)
+			expected := reference.expandedKeys(start, min(len(reference.keys), start+n))
+			if !slices.Equal(visited, expected[:min(n, len(expected))]) {
+				t.Fatalf("step %d: scanning %d keys from %d: expected %v, got %v", step, n, from, expected, visited)
+			}
+		case 6:
+			before, n := reader.key(), int(reader.byte()%32)+1
+			last, _ := alex.LastNBefore(before, n)
+			end := sort.SearchInts(reference.keys, before)
+			expected := reference.expandedKeys(max(0, end-n), end)
+			expected = expected[max(0, len(expected)-n):]
+			slices.Reverse(expected)
+			if !slices.Equal(last, expected) {
+				t.Fatalf("step %d: last %d keys before %d: expected %v, got %v", step, n, before, expected, last)
+			}
+		case 8, 9:
+			// Update replaces the payload of the copy Find returns, Upsert inserts missing keys as well
+			key := reader.key()
+			previous, findErr := alex.Find(key)
+			var err error
+			if operation%16 == 8 {
+				err = alex.Update(key, step)
+			} else {
+				err = alex.Upsert(key, step)
+			}
+			switch {
+			case findErr == nil && err == nil:
+				if !reference.replace(key, previous, step) {
+					t.Fatalf("step %d: updating %d: unexpected payload %d", step, key, previous)
+				}
+			case findErr != nil && operation%16 == 8:
+				if !errors.Is(err, shared.KeyNotFoundError) {
+					t.Fatalf("step %d: updating missing key %d: expected KeyNotFoundError, got %v", step, key, err)
+				}
+			case findErr != nil && err == nil:
+				reference.insert(key, step)
+			default:
+				t.Fatalf("step %d: upserting %d: %v", step, key, err)
+			}
+		case 10:
+			// Compute stores, keeps or inserts depending on the flags of the operation
+			key := reader.key()
+			store, insert := operation&0x40 != 0, operation&0x80 != 0
+			err := alex.Compute(key, func(payload shared.PayloadType, exists bool) (shared.PayloadType, bool) {
+				if _, ok := reference.payloads[key]; ok != exists {
+					t.Fatalf("step %d: computing %d: expected exists %v, got %v", step, key, ok, exists)
+				}
+				if !exists {
+					return step, insert
+				}
+				if !slices.Contains(reference.payloads[key], payload) {
+					t.Fatalf("step %d: computing %d: unexpected payload %d", step, key, payload)
+				}
+				if store {
+					reference.replace(key, payload, step)
+				}
+				return step, store
+			})
+			if err != nil {
+				t.Fatalf("step %d: computing %d: %v", step, key, err)
+			}
+			if _, ok := reference.payloads[key]; !ok && insert {
+				reference.insert(key, step)
+			}
+		case 11:
+			// A batch of keys, sorted if the operation says so, as bulk appends are
+			keys := make([]shared.KeyType, reader.byte()%64)
+			for i := range keys {
+				keys[i] = reader.key()
+			}
+			if operation&0x80 != 0 {
+				slices.Sort(keys)
+			}
+			payloads := make([]shared.PayloadType, len(keys))
+			for i := range payloads {
+				payloads[i] = step
+			}
+			if err := alex.InsertBatch(keys, payloads); err != nil {
+				t.Fatalf("step %d: inserting a batch of %d keys: %v", step, len(keys), err)
+			}
+			for _, key := range keys {
+				reference.insert(key, step)
+			}
+		case 12:
+			keys := make([]shared.KeyType, reader.byte()%64)
+			for i := range keys {
+				keys[i] = reader.key()
+			}
+			if operation&0x80 != 0 {
+				slices.Sort(keys)
+			}
+			payloads, found := alex.FindBatch(keys)
+			for i, key := range keys {
+				expected, ok := reference.payloads[key]
+				if ok != found[i] || (ok && !slices.Contains(expected, payloads[i])) {
+					t.Fatalf("step %d: finding %d in a batch: expected %v, got found %v and payload %d", step, key, expected, found[i], payloads[i])
+				}
+			}
+		case 13:
+			// Ranks past the number of keys are out of range
+			k := reader.uint16() % (reference.numKeys + 8)
+			key, payload, err := alex.Select(k)
+			expected, ok := reference.selectKey(k)
+			if ok != (err == nil) || (!ok && !errors.Is(err, shared.RankOutOfRangeError)) {
+				t.Fatalf("step %d: selecting rank %d of %d: %v", step, k, reference.numKeys, err)
+			}
+			if ok && (key != expected || !slices.Contains(reference.payloads[key], payload)) {
+				t.Fatalf("step %d: selecting rank %d: expected %d, got %d with payload %d", step, k, expected, key, payload)
+			}
+		default:
+			lo := reader.key()
+			hi := saturatingAdd(lo, reader.uint16())
+			if count, expected := alex.CountRange(lo, hi), reference.countBefore(hi, true)-reference.countBefore(lo, false); count != expected {
+				t.Fatalf("step %d: counting [%d, %d]: expected %d, got %d", step, lo, hi, expected, count)
+			}
+			if rank, expected := alex.Rank(lo), reference.countBefore(lo, false); rank != expected {
+				t.Fatalf("step %d: rank of %d: expected %d, got %d", step, lo, expected, rank)
+			}
+		}
+
+		if numKeys := alex.GetStats().NumKeys; numKeys != reference.numKeys {
+			t.Fatalf("step %d: expected %d keys, the index holds %d", step, reference.numKeys, numKeys)
+		}
+	}
+	checkAgainstReference(t, alex, reference)
+}
+
+// Checks that every key of reference is reachable in alex and that the leaves hold exactly the keys of reference
+func checkAgainstReference(t *testing.T, alex *index.Index, reference *referenceMap) {
+	t.Helper()
+	for _, key := range reference.keys {
+		if _, err := alex.Find(key); err != nil {
+			t.Fatalf("key %d is unreachable: %v", key, err)
+		}
+	}
+	all := make([]shared.KeyType, 0, reference.numKeys)
+	alex.Scan(shared.MinKey, func(key shared.KeyType, payload shared.PayloadType) bool {
+		all = append(all, key)
+		return true
+	})
+	if !slices.Equal(all, reference.expandedKeys(0, len(reference.keys))) {
+		t.Fatalf("a full scan returned %d keys, expected %d", len(all), reference.numKeys)
+	}
+	if reference.numKeys > 0 && (alex.GetMinKey() != reference.keys[0] || alex.GetMaxKey() != reference.keys[len(reference.keys)-1]) {
+		t.Fatalf("expected keys in [%d, %d], got [%d, %d]", reference.keys[0], reference.keys[len(reference.keys)-1], alex.GetMinKey(), alex.GetMaxKey())
+	}
+}
+
+// Encodes an operation inserting a run of length keys from offset - 2^15, see runDifferential
+func runOfKeys(descending bool, offset uint16, length byte, stride byte) []byte {
+	operation := byte(2)
+	if descending {
+		operation |= 0x80
+	}
+	return []byte{operation, 1, byte(offset >> 8), byte(offset), length, stride - 1}
+}
+
+// Adds the seed inputs of the fuzz targets
+func addFuzzSeeds(f *testing.F) {
+	// Appends, then prepends, then inserts between the existing keys: resizes, splits data nodes sideways and
+	// downwards, and expands the root on both sides
+	var appendsAndPrepends []byte
+	for i := uint16(0); i < 24; i++ {
+		appendsAndPrepends = append(appendsAndPrepends, runOfKeys(false, 1<<15+i<<8, 63, 4)...)
+	}
+	for i := uint16(1); i < 24; i++ {
+		appendsAndPrepends = append(appendsAndPrepends, runOfKeys(true, 1<<15-i<<8, 63, 4)...)
+	}
+	for i := uint16(0); i < 24; i++ {
+		appendsAndPrepends = append(appendsAndPrepends, runOfKeys(false, 1<<15+i<<8+2, 63, 4)...)
+	}
+	f.Add(appendsAndPrepends)
+	// Dense clusters with queries in between
+	f.Add([]byte{
+		2, 0, 0, 63, 0, 2, 2, 0, 1, 63, 0, 2, 2, 127, 255, 63, 0, 2, 2, 128, 0, 63, 0,
+		5, 0, 0, 31, 6, 2, 127, 255, 31, 7, 2, 0, 1, 255, 255, 4, 0, 10, 0, 40, 5, 0, 0, 31,
+	})
+	// Keys next to the extremes of KeyType
+	f.Add([]byte{
+		0, 3, 0, 0, 0, 4, 0, 0, 0, 0, 5, 0, 7, 0, 0, 0, 0, 1, 3, 3, 0, 0, 3, 4, 0, 0,
+		2, 4, 0, 63, 63, 7, 130, 3, 0, 63, 63, 7, 5, 3, 0, 0, 31, 6, 4, 0, 0, 31, 7, 3, 0, 0, 255, 255,
+	})
+	// Interleaved inserts and deletes of the same dense keys
+	f.Add([]byte{2, 0, 10, 63, 0, 4, 0, 20, 0, 10, 2, 0, 15, 63, 1, 3, 0, 25, 4, 0, 0, 0, 255, 2, 0, 0, 63, 0, 3, 0, 5})
+	// Consecutive keys above 2^53, which float64 cannot tell apart, split by a model node
+	f.Add([]byte("22A2000"))
+	// A run that expands the root next to another run, the new data node must take the keys the root routes to it
+	f.Add([]byte("21\x007?1\x821\x00170200000"))
+	// Updates, upserts and computes of present and missing keys, batches, and selects in and past the range of ranks
+	f.Add([]byte{
+		2, 0, 0, 63, 0, 8, 0, 5, 8, 0, 200, 9, 0, 6, 9, 0, 200, 10 | 0x40, 0, 7, 10 | 0x80, 0, 250, 10, 0, 251,
+		11 | 0x80, 5, 0, 1, 0, 2, 0, 3, 0, 4, 0, 5, 11, 3, 2, 0, 0, 0, 9, 5, 3, 0,
+		12, 4, 0, 1, 0, 100, 0, 250, 0, 255, 12 | 0x80, 3, 0, 200, 0, 5, 0, 5, 13, 0, 10, 13, 0, 70, 13, 0, 77,
+	})
+}
+
+// FuzzIndex Compares random sequences of inserts, updates, lookups, deletes, scans, batches and aggregate queries on
+// the index with a reference sorted map.
+// Run with go test ./tests -run '^$' -fuzz FuzzIndex -fuzzminimizetime 50x
+// Inputs near the extremes of KeyType expand the root to millions of child pointers, bounding the minimization of
+// new inputs keeps the fuzzer executing instead of replaying them for a minute each.
+func FuzzIndex(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 4096 {
+			return
+		}
+		runDifferential(t, data)
+	})
+}
+
+// FuzzIndexWithMaintenance Runs the operations of FuzzIndex while the maintenance goroutine reorganises data nodes
+// in the background.
+// Run with go test ./tests -run '^$' -fuzz FuzzIndexWithMaintenance -fuzzminimizetime 50x
+func FuzzIndexWithMaintenance(f *testing.F) {
+	addFuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > 4096 {
+			return
+		}
+		alex := index.NewIndex()
+		alex.StartMaintenance()
+		defer alex.StopMaintenance()
+		runDifferentialOn(t, alex, data)
+	})
+}
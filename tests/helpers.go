@@ -61,6 +61,22 @@ func GenerateRandomKeys(N int) []shared.KeyType {
 	return keys
 }
 
+// GenerateExponentialKeys Distinct exponentially distributed keys, which spread over many data nodes whose costs
+// deviate from their expectations
+func GenerateExponentialKeys(N int, seed int64) []shared.KeyType {
+	rng := rand.New(rand.NewSource(seed))
+	keys := make([]shared.KeyType, 0, N)
+	existingKeys := map[shared.KeyType]bool{}
+	for len(keys) < N {
+		key := shared.KeyType(rng.ExpFloat64() * 1e9)
+		if !existingKeys[key] {
+			existingKeys[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 func SaveKeysToCSV(keys []shared.KeyType) error {
 	file, err := os.Create(fmt.Sprintf("keys_%d.csv", len(keys)))
 	if err != nil {
@@ -101,8 +117,8 @@ func SequentialLookups(alex *index.Index, keys []shared.KeyType) error {
 		if err != nil {
 			return err
 		} else {
-			if i != *payload {
-				return errors.New(fmt.Sprintf("retrieval error for key %d expected %d got %d", keys[i], i, *payload))
+			if i != payload {
+				return errors.New(fmt.Sprintf("retrieval error for key %d expected %d got %d", keys[i], i, payload))
 			}
 		}
 	}
@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestIncrementalResize(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	keys := GenerateRandomKeys(200_000)
+	// Append a sorted run so that resizes keeping the left or right side are exercised too
+	for i := 0; i < 50_000; i++ {
+		keys = append(keys, 1<<40+i)
+	}
+
+	alex := index.NewIndex()
+	alex.SetIncrementalResizeChunk(8)
+	numResizingLeaves := 0
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+		// Lookups interleaved with inserts see keys on both sides of running migrations
+		probe := rng.Intn(i + 1)
+		payload, err := alex.Find(keys[probe])
+		if err != nil {
+			t.Fatalf("key %d not found after %d inserts", keys[probe], i+1)
+		}
+		if payload != probe {
+			t.Fatalf("expected payload %d for key %d, got %d", probe, keys[probe], payload)
+		}
+		if i%10_000 == 0 {
+			for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+				if leaf.IsResizing() {
+					numResizingLeaves++
+				}
+			}
+		}
+	}
+	if numResizingLeaves == 0 {
+		t.Fatal("no data node was ever caught in the middle of a resize")
+	}
+
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, len(keys))
+
+	alex.SetIncrementalResizeChunk(0)
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.IsResizing() {
+			t.Fatal("disabling incremental resizes must finish the running ones")
+		}
+	}
+}
+
+func TestIncrementalResizeWorkPerInsert(t *testing.T) {
+	keys := GenerateRandomKeys(200_000)
+	for i := 0; i < 50_000; i++ {
+		keys = append(keys, 1<<40+i)
+	}
+
+	const chunk = 8
+	alex := index.NewIndex()
+	alex.SetIncrementalResizeChunk(chunk)
+	maxWrites, maxCapacity := int64(0), 0
+	for i, key := range keys {
+		leaf, _, _ := alex.GetLeaf(key, false)
+		numWrites := leaf.NumResizeWrites
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+		// Splits rebuild the leaf in one go
+		if current, _, _ := alex.GetLeaf(key, false); current != leaf {
+			continue
+		}
+		maxWrites = max(maxWrites, leaf.NumResizeWrites-numWrites)
+		maxCapacity = max(maxCapacity, leaf.DataCapacity)
+	}
+
+	// The slots written by one insert do not grow with the capacity of the node
+	if maxWrites > 16*chunk {
+		t.Fatalf("an insert wrote %d slots of a resize, expected at most %d", maxWrites, 16*chunk)
+	}
+	if maxCapacity < 1000*16*chunk {
+		t.Fatalf("the largest data node only has %d slots, too few to tell incremental resizes apart", maxCapacity)
+	}
+}
+
+func TestReadsDuringIncrementalResize(t *testing.T) {
+	keys := GenerateRandomKeys(20_000)
+	alex := index.NewIndex()
+	alex.SetIncrementalResizeChunk(8)
+	var resizing *node.DataNode
+	var inserted []shared.KeyType
+	for i, key := range keys {
+		if err := alex.Insert(key, key); err != nil {
+			t.Fatal(err)
+		}
+		if leaf, _, _ := alex.GetLeaf(key, false); i >= 1000 && leaf.IsResizing() {
+			resizing = leaf
+			inserted = slices.Clone(keys[:i+1])
+			break
+		}
+	}
+	if resizing == nil {
+		t.Fatal("no data node was ever caught in the middle of a resize")
+	}
+	slices.Sort(inserted)
+
+	check := func() {
+		t.Helper()
+		for i := 0; i < len(inserted); i += 7 {
+			if rank := alex.Rank(inserted[i]); rank != i {
+				t.Fatalf("rank of %d: expected %d, got %d", inserted[i], i, rank)
+			}
+			if key, payload, err := alex.Select(i); err != nil || key != inserted[i] || payload != inserted[i] {
+				t.Fatalf("select %d: expected %d, got %d, %d, %v", i, inserted[i], key, payload, err)
+			}
+			if count := alex.CountRange(inserted[0], inserted[i]); count != i+1 {
+				t.Fatalf("count up to %d: expected %d, got %d", inserted[i], i+1, count)
+			}
+		}
+		all := make([]shared.KeyType, 0, len(inserted))
+		alex.Scan(shared.MinKey, func(key shared.KeyType, payload shared.PayloadType) bool {
+			all = append(all, key)
+			return true
+		})
+		if !slices.Equal(all, inserted) {
+			t.Fatalf("a full scan returned %d keys, expected %d", len(all), len(inserted))
+		}
+		last, _ := alex.LastNBefore(shared.MaxKey, len(inserted))
+		slices.Reverse(last)
+		if !slices.Equal(last, inserted) {
+			t.Fatalf("a full descending scan returned %d keys, expected %d", len(last), len(inserted))
+		}
+	}
+
+	check()
+	// Deletes across the migration boundary and among the keys that are not migrated yet
+	for _, bounds := range [][2]int{{2, 20}, {len(inserted) / 2, len(inserted)/2 + 30}} {
+		lo, hi := inserted[bounds[0]], inserted[bounds[1]]
+		if deleted := alex.DeleteRange(lo, hi); deleted != bounds[1]-bounds[0] {
+			t.Fatalf("deleting [%d, %d): expected %d deleted keys, got %d", lo, hi, bounds[1]-bounds[0], deleted)
+		}
+		inserted = slices.Delete(inserted, bounds[0], bounds[1])
+		check()
+	}
+	if !resizing.IsResizing() {
+		t.Fatal("reads and deletes must not finish a running resize")
+	}
+
+	alex.SetIncrementalResizeChunk(0)
+	check()
+}
+
+func TestPositionsDuringIncrementalResize(t *testing.T) {
+	keys := GenerateRandomKeys(20_000)
+	alex := index.NewIndex()
+	alex.SetIncrementalResizeChunk(8)
+	var resizing *node.DataNode
+	for i, key := range keys {
+		if err := alex.Insert(key, key); err != nil {
+			t.Fatal(err)
+		}
+		if leaf, _, _ := alex.GetLeaf(key, false); i >= 1000 && leaf.IsResizing() {
+			resizing = leaf
+			break
+		}
+	}
+	if resizing == nil {
+		t.Fatal("no data node was ever caught in the middle of a resize")
+	}
+
+	var leafKeys []shared.KeyType
+	resizing.Ascend(shared.MinKey, func(key shared.KeyType, _ shared.PayloadType) bool {
+		leafKeys = append(leafKeys, key)
+		return true
+	})
+	keyAt := func(position int) shared.KeyType {
+		slots, slotPosition := resizing.SlotsAt(position)
+		return slots.KeyAt(slotPosition)
+	}
+	end := math.MaxInt
+	for i, key := range leafKeys {
+		if i+1 < len(leafKeys) {
+			if next := keyAt(resizing.FindUpper(key)); next != leafKeys[i+1] {
+				t.Fatalf("first key after %d: expected %d, got %d", key, leafKeys[i+1], next)
+			}
+		}
+		if found := keyAt(resizing.FindLower(key)); found != key {
+			t.Fatalf("first key from %d: got %d", key, found)
+		}
+		if count := resizing.NumKeysInRange(0, resizing.LowerBound(key)); count != i {
+			t.Fatalf("keys before %d: expected %d, got %d", key, i, count)
+		}
+		if count := resizing.NumKeysInRange(resizing.UpperBound(key), end); count != len(leafKeys)-i-1 {
+			t.Fatalf("keys after %d: expected %d, got %d", key, len(leafKeys)-i-1, count)
+		}
+	}
+	var reversed []shared.KeyType
+	resizing.IterateFilledPositionsReverse(func(key shared.KeyType, _ shared.PayloadType, position int) bool {
+		if keyAt(position) != key {
+			t.Fatalf("key %d yielded with position %d of key %d", key, position, keyAt(position))
+		}
+		reversed = append(reversed, key)
+		return true
+	}, 0, end)
+	slices.Reverse(reversed)
+	if !slices.Equal(reversed, leafKeys) {
+		t.Fatalf("a reverse iteration returned %d keys, expected %d", len(reversed), len(leafKeys))
+	}
+	if !resizing.IsResizing() {
+		t.Fatal("searches returning positions must not finish a running resize")
+	}
+
+	// Lookups of keys migrate a chunk of keys each
+	for _, key := range leafKeys {
+		position, err := resizing.FindKeyPosition(key)
+		if err != nil || keyAt(position) != key {
+			t.Fatalf("key %d not found at its position %d: %v", key, position, err)
+		}
+	}
+}
+
+func TestSplitsOfRetrainedLeavesNextToExtremeKeys(t *testing.T) {
+	// Retrains resize incrementally and running resizes finish before splits, which changes the leaves that split
+	// next to the extreme keys: corrected traversals of the keys after them cross subtrees
+	keys := make([]shared.KeyType, 0, 111)
+	for key := 96; key >= -368; key -= 8 {
+		keys = append(keys, key)
+	}
+	keys = append(keys, 9223372036854753882, -17936333183909888, -9223372036854753466, -9223372036854721764,
+		31342, 11618539370708992, 119, 48, -9223372036854719089, 14, 3, 49333724, -9223372036854719195, 124822065,
+		-9223372036854716410, 9223372036854711669, -28226662508265472, 29873730926673920, -9223372036854711075,
+		9223372036854726267, 156268104, 175, -9223372036854731155, 8, 238083325, -9223372036854775612, 6949, 27207,
+		-33741812833189888, -14359621858754560, 84, -14181, -9223372036854714651, 94, 1510, 9223372036854741845,
+		9223372036854745655, -9223372036854729426, -9223372036854745900, -9223372036854733530, 28613690601242624,
+		9223372036854766385, 3925, 12961, 9223372036854715080, -35341602251603968, -9223372036854736815,
+		-9223372036854773473, -10483, 179, 206586608, 9223372036854746586)
+	checkInsertedKeysReachable(t, keys)
+
+	alex := index.NewIndex()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted)
+	for _, key := range sorted {
+		// Some keys are inserted twice, the rank counts the keys strictly smaller
+		rank, _ := slices.BinarySearch(sorted, key)
+		if got := alex.Rank(key); got != rank {
+			t.Fatalf("rank of %d: expected %d, got %d", key, rank, got)
+		}
+	}
+	checkLeafChain(t, alex, len(keys))
+}
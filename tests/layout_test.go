@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"alex_go/workload"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Inserts widely spaced keys into a single data node with the given layout, then keys that all fall between its
+// two first keys, the worst case of the gapped array. Returns the node and the inserted keys
+func insertIntoOneGap(t *testing.T, layout node.DataNodeLayout) (*node.DataNode, []shared.KeyType) {
+	dataNode := node.NewDataNode(1)
+	dataNode.Layout = layout
+	keys := make([]shared.KeyType, 0)
+	for i := 0; i < 10_000; i++ {
+		keys = append(keys, shared.KeyType(i)*100_000)
+	}
+	for i := 1; i < 20_000; i++ {
+		keys = append(keys, shared.KeyType(i))
+	}
+	for i, key := range keys {
+		if _, err := dataNode.InsertInPlace(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dataNode, keys
+}
+
+func TestPackedMemoryArrayBoundsShifts(t *testing.T) {
+	gapped, _ := insertIntoOneGap(t, node.GappedArrayLayout)
+	pma, keys := insertIntoOneGap(t, node.PackedMemoryArrayLayout)
+	for i, key := range keys {
+		payload, err := pma.FindPayload(key)
+		if err != nil {
+			t.Fatalf("key %d not found: %v", key, err)
+		}
+		if *payload != i {
+			t.Fatalf("expected payload %d for key %d, got %d", i, key, *payload)
+		}
+	}
+	t.Logf("shifts per insert: gapped array %.1f, packed memory array %.1f", gapped.ShiftsPerInserts(), pma.ShiftsPerInserts())
+	if pma.ShiftsPerInserts() >= gapped.ShiftsPerInserts()/4 {
+		t.Fatalf("expected far fewer shifts per insert with the packed memory array, got %.1f against %.1f",
+			pma.ShiftsPerInserts(), gapped.ShiftsPerInserts())
+	}
+}
+
+func TestPackedMemoryArrayLayout(t *testing.T) {
+	rng := rand.New(rand.NewSource(41))
+	descending := make([]shared.KeyType, 50_000)
+	for i := range descending {
+		descending[i] = shared.KeyType(len(descending) - i)
+	}
+	interleaved := make([]shared.KeyType, 0, 50_000)
+	for i := 0; i < 25_000; i++ {
+		interleaved = append(interleaved, shared.KeyType(i)*1_000, shared.KeyType(i)*1_000+500-shared.KeyType(i%500))
+	}
+	testCases := []struct {
+		name string
+		keys []shared.KeyType
+		// Keys migrated per operation by incremental resizes, which insert with shifts while they run
+		resizeChunk int
+	}{
+		{"Random", GenerateRandomKeys(50_000), 0},
+		{"Exponential", GenerateExponentialKeys(50_000, 13), 16},
+		{"Descending", descending, 0},
+		{"Interleaved", interleaved, 16},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			alex := index.NewIndex()
+			alex.SetDataNodeLayout(node.PackedMemoryArrayLayout)
+			alex.SetIncrementalResizeChunk(testCase.resizeChunk)
+			for i, key := range testCase.keys {
+				if err := alex.Insert(key, i); err != nil {
+					t.Fatal(err)
+				}
+				if rng.Intn(100) == 0 {
+					probe := rng.Intn(i + 1)
+					if payload, err := alex.Find(testCase.keys[probe]); err != nil || payload != probe {
+						t.Fatalf("key %d not found with payload %d after %d inserts", testCase.keys[probe], probe, i+1)
+					}
+				}
+			}
+			checkErrorBounds(t, alex)
+			for i, key := range testCase.keys {
+				payload, err := alex.Find(key)
+				if err != nil {
+					t.Fatalf("key %d not found: %v", key, err)
+				}
+				if payload != i {
+					t.Fatalf("expected payload %d for key %d, got %d", i, key, payload)
+				}
+			}
+			sorted := slices.Clone(testCase.keys)
+			slices.Sort(sorted)
+			scanned := make([]shared.KeyType, 0, len(sorted))
+			alex.Scan(shared.MinKey, func(key shared.KeyType, payload shared.PayloadType) bool {
+				scanned = append(scanned, key)
+				return true
+			})
+			if !slices.Equal(scanned, sorted) {
+				t.Fatalf("a full scan returned %d keys, expected %d sorted keys", len(scanned), len(sorted))
+			}
+			for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+				if leaf.Layout != node.PackedMemoryArrayLayout {
+					t.Fatalf("data node created with layout %v", leaf.Layout)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDataNodeLayouts Inserts of shuffled keys, and of keys clustered between the keys of a sparse initial
+// set, with each layout
+func BenchmarkDataNodeLayouts(b *testing.B) {
+	rng := rand.New(rand.NewSource(5))
+	shuffled := workload.GenerateKeys(workload.UniformKeys, 200_000, 42)
+	clustered := make([]shared.KeyType, 0, 200_000)
+	for i := 0; i < 20_000; i++ {
+		clustered = append(clustered, shared.KeyType(i)<<20)
+	}
+	for len(clustered) < cap(clustered) {
+		clustered = append(clustered, shared.KeyType(rng.Intn(200))<<20+shared.KeyType(rng.Intn(1<<20-1)+1))
+	}
+	clustered = slices.Compact(clustered)
+	for _, dataset := range []struct {
+		name string
+		keys []shared.KeyType
+	}{{"shuffled", shuffled}, {"clustered", clustered}} {
+		for _, layout := range []node.DataNodeLayout{node.GappedArrayLayout, node.PackedMemoryArrayLayout} {
+			b.Run(fmt.Sprintf("%s/%v", dataset.name, layout), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					alex := index.NewIndex()
+					alex.SetDataNodeLayout(layout)
+					for j, key := range dataset.keys {
+						if err := alex.Insert(key, j); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(dataset.keys)), "ns/insert")
+			})
+		}
+	}
+}
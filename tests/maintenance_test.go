@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func checkLeafChain(t *testing.T, alex *index.Index, expectedNumKeys int) {
+	t.Helper()
+	numKeys := 0
+	previousKey := 0
+	first := true
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.NextLeaf != nil && leaf.NextLeaf.PrevLeaf != leaf {
+			t.Fatal("leaves are not doubly linked")
+		}
+		leaf.IterateFilledPositions(func(key int, payload int, i int, j int) {
+			if !first && key < previousKey {
+				t.Fatalf("keys out of order across leaves: %d after %d", key, previousKey)
+			}
+			previousKey = key
+			first = false
+			numKeys++
+		}, 0, leaf.DataCapacity)
+	}
+	if numKeys != expectedNumKeys {
+		t.Fatalf("expected %d keys in the leaves, found %d", expectedNumKeys, numKeys)
+	}
+}
+
+func TestBackgroundMaintenance(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	// Exponentially distributed keys make data node costs deviate from their expectations
+	keys := make([]int, 0, 300_000)
+	seen := map[int]struct{}{}
+	for len(keys) < cap(keys) {
+		key := int(rng.ExpFloat64() * 1e9)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+
+	alex := index.NewIndex()
+	alex.StartMaintenance()
+
+	var readers sync.WaitGroup
+	stop := make(chan struct{})
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				alex.Find(keys[rng.Intn(1_000)])
+			}
+		}
+	}()
+
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	readers.Wait()
+	alex.StopMaintenance()
+
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, len(keys))
+}
+
+// Random operations while the maintenance goroutine reorganises data nodes, see FuzzIndexWithMaintenance
+func TestMaintenanceDifferential(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	numDeferred := 0
+	for seed := 0; seed < 8; seed++ {
+		data := make([]byte, 4_000)
+		rng.Read(data)
+		alex := index.NewIndex()
+		alex.StartMaintenance()
+		runDifferentialOn(t, alex, data)
+		alex.StopMaintenance()
+		numDeferred += alex.GetStats().NumDeferredReorganisations
+	}
+	if numDeferred == 0 {
+		t.Fatal("no data node was queued for the maintenance goroutine")
+	}
+}
+
+func TestBulkLoadFromExistingTrainsOwnModel(t *testing.T) {
+	source := node.NewDataNode(8)
+	for i := 0; i < source.DataCapacity; i++ {
+		source.InsertElementAt(10*(i+1), i, i)
+	}
+	source.NumKeys = source.DataCapacity
+	source.LinearModel.A = 0.1
+	source.LinearModel.B = -1
+
+	// Maintenance rebuilds nodes from copies that stay in use until the swap, their model must not change
+	rebuilt := node.NewDataNode(0)
+	rebuilt.BulkLoadFromExisting(source, 0, source.DataCapacity, false, false, nil, -1)
+	if source.LinearModel.A != 0.1 || source.LinearModel.B != -1 {
+		t.Fatalf("the source model changed to %+v", source.LinearModel)
+	}
+	if rebuilt.LinearModel.A <= 0 {
+		t.Fatalf("the rebuilt node was not trained, got %+v", rebuilt.LinearModel)
+	}
+	for i := 0; i < source.DataCapacity; i++ {
+		if _, err := rebuilt.FindKeyPosition(10 * (i + 1)); err != nil {
+			t.Fatalf("key %d not found in the rebuilt node", 10*(i+1))
+		}
+	}
+}
+
+func TestMaintenanceMemoryBudget(t *testing.T) {
+	keys := GenerateExponentialKeys(500_000, 23)
+	const budget = 2 << 20
+	alex := index.NewIndex()
+	alex.SetMemoryBudget(budget)
+	alex.StartMaintenance()
+	inserted := 0
+	for ; inserted < len(keys); inserted++ {
+		if err := alex.Insert(keys[inserted], inserted); err != nil {
+			break
+		}
+	}
+	alex.StopMaintenance()
+	if alex.GetStats().NumDeferredReorganisations == 0 {
+		t.Fatal("no data node was queued for the maintenance goroutine")
+	}
+
+	// Rebuilds swapped in by the maintenance goroutine are budgeted like the splits of inserts
+	if footprint := alex.MemoryFootprint(); footprint > budget {
+		t.Fatalf("the index grew to %d bytes, past its budget of %d bytes", footprint, budget)
+	}
+	if err := SequentialLookups(alex, keys[:inserted]); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, inserted)
+}
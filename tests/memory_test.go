@@ -0,0 +1,237 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestMemoryFootprint(t *testing.T) {
+	keys := GenerateExponentialKeys(200_000, 19)
+	alex := index.NewIndex()
+	set := index.NewAlexSet()
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := set.Add(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every slot of a data node holds a key and a payload
+	leavesSize := int64(0)
+	numSlots := 0
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		leavesSize += leaf.GetNodeSize()
+		numSlots += leaf.DataCapacity
+	}
+	if leavesSize < int64(numSlots*(shared.KeySize+shared.PayloadSize)) {
+		t.Fatalf("the data nodes hold %d slots but account for %d bytes only", numSlots, leavesSize)
+	}
+	footprint := alex.MemoryFootprint()
+	if footprint <= leavesSize {
+		t.Fatalf("the footprint of %d bytes does not account for the model nodes", footprint)
+	}
+
+	setFootprint := set.Index().MemoryFootprint()
+	if float64(setFootprint) > 0.7*float64(footprint) {
+		t.Fatalf("a set takes %d bytes, expected about half of the %d bytes of an index", setFootprint, footprint)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	keys := GenerateExponentialKeys(500_000, 23)
+	const budget = 2 << 20
+	alex := index.NewIndex()
+	alex.SetMemoryBudget(budget)
+
+	inserted := 0
+	var err error
+	for ; inserted < len(keys); inserted++ {
+		if err = alex.Insert(keys[inserted], inserted); err != nil {
+			break
+		}
+	}
+	var budgetErr *shared.MemoryBudgetError
+	if !errors.Is(err, shared.MemoryBudgetExceededError) || !errors.As(err, &budgetErr) {
+		t.Fatalf("expected the budget to be exceeded, got %v after %d inserts", err, inserted)
+	}
+	if budgetErr.Budget != budget || budgetErr.Footprint+budgetErr.Required <= budget {
+		t.Fatalf("inconsistent budget error: %v", budgetErr)
+	}
+	if footprint := alex.MemoryFootprint(); footprint > budget {
+		t.Fatalf("the index grew to %d bytes, past its budget of %d bytes", footprint, budget)
+	}
+	if err := SequentialLookups(alex, keys[:inserted]); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, inserted)
+
+	// Under memory pressure the data nodes are packed more densely than by default
+	numKeys, numSlots := 0, 0
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		numKeys += leaf.NumKeys
+		numSlots += leaf.DataCapacity
+	}
+	if density := float64(numKeys) / float64(numSlots); density < shared.KMinDensity {
+		t.Fatalf("expected data nodes denser than %v under memory pressure, got %v", shared.KMinDensity, density)
+	}
+
+	// Lifting the budget lets the index grow again
+	alex.SetMemoryBudget(0)
+	for ; inserted < len(keys); inserted++ {
+		if err := alex.Insert(keys[inserted], inserted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryBudgetWithIncrementalResize(t *testing.T) {
+	keys := GenerateExponentialKeys(500_000, 29)
+	const budget = 2 << 20
+	alex := index.NewIndex()
+	alex.SetIncrementalResizeChunk(16)
+	alex.SetMemoryBudget(budget)
+
+	// The old slots of running resizes and the nodes added by splits count against the budget as well
+	inserted := 0
+	var err error
+	for ; inserted < len(keys); inserted++ {
+		err = alex.Insert(keys[inserted], inserted)
+		if footprint := alex.MemoryFootprint(); footprint > budget {
+			t.Fatalf("the index grew to %d bytes after %d inserts, past its budget of %d bytes", footprint, inserted, budget)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, shared.MemoryBudgetExceededError) {
+		t.Fatalf("expected the budget to be exceeded, got %v after %d inserts", err, inserted)
+	}
+	if alex.GetStats().NumSidewaysSplits+alex.GetStats().NumDownwardSplits == 0 {
+		t.Fatal("no data node was split")
+	}
+	if err := SequentialLookups(alex, keys[:inserted]); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, inserted)
+}
+
+func TestFootprintKeptUpToDate(t *testing.T) {
+	rng := rand.New(rand.NewSource(31))
+	keys := GenerateExponentialKeys(200_000, 31)
+	alex := index.NewIndex()
+	alex.SetIncrementalResizeChunk(4)
+	alex.SetMemoryBudget(1 << 40)
+	// The extremes first, so that the key domain never has to expand past them
+	keys[0], keys[1] = 0, slices.Max(keys)+1
+	for i, key := range keys[:10_000] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inserted := slices.Clone(keys[:10_000])
+	checkFootprint(t, alex)
+
+	stats := alex.GetStats()
+	for start := 10_000; start < len(keys); start += 50_000 {
+		chunk := keys[start:min(start+50_000, len(keys))]
+		for i, key := range chunk {
+			if err := alex.Insert(key, start+i); err != nil {
+				t.Fatal(err)
+			}
+			// Lookups migrate the keys of running resizes too
+			if _, err := alex.Find(inserted[rng.Intn(len(inserted))]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		inserted = append(inserted, chunk...)
+		slices.Sort(inserted)
+		// Deletes that shrink and merge data nodes, and a few single keys
+		first := 1 + rng.Intn(len(inserted)/2)
+		lo, hi := inserted[first], inserted[first+len(inserted)/10]
+		alex.DeleteRange(lo, hi)
+		inserted = slices.DeleteFunc(inserted, func(key int) bool { return lo <= key && key < hi })
+		for i := 0; i < 100; i++ {
+			position := 1 + rng.Intn(len(inserted)-2)
+			alex.Delete(inserted[position])
+			inserted = slices.Delete(inserted, position, position+1)
+		}
+		checkFootprint(t, alex)
+	}
+
+	after := alex.GetStats()
+	if after.NumSidewaysSplits+after.NumDownwardSplits == stats.NumSidewaysSplits+stats.NumDownwardSplits {
+		t.Fatal("no data node was split")
+	}
+	if after.NumFootprintRecounts != stats.NumFootprintRecounts {
+		t.Fatalf("inserts, lookups, splits and deletes must update the footprint in place, %d recounts",
+			after.NumFootprintRecounts-stats.NumFootprintRecounts)
+	}
+
+	// Appends expand the key domain, which recomputes the footprint, and the aggregate queries that follow must not
+	// grow the nodes behind its back
+	for i := 1; i <= 20_000; i++ {
+		if err := alex.Insert(keys[1]+i*1_000, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFootprint(t, alex)
+	alex.Rank(keys[1])
+	checkFootprint(t, alex)
+}
+
+// Checks the footprint of alex against the sizes of its nodes, walked from the super root
+func checkFootprint(t *testing.T, alex *index.Index) {
+	t.Helper()
+	_, traversalPath, err := alex.GetLeaf(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var walk func(current node.Node) int64
+	walk = func(current node.Node) int64 {
+		size := current.GetNodeSize()
+		if modelNode, ok := current.(*node.ModelNode); ok {
+			for i := 0; i < modelNode.NumChildren; i += 1 << modelNode.Children[i].GetDuplicationFactor() {
+				size += walk(modelNode.Children[i])
+			}
+		}
+		return size
+	}
+	if size, footprint := walk(traversalPath[0].ModelNode), alex.MemoryFootprint(); footprint != size {
+		t.Fatalf("the footprint is %d bytes, the nodes hold %d bytes", footprint, size)
+	}
+}
+
+func TestFootprintKeptUpToDateByMaintenance(t *testing.T) {
+	keys := GenerateExponentialKeys(300_000, 7)
+	keys[0], keys[1] = 0, slices.Max(keys)+1
+	alex := index.NewIndex()
+	for i, key := range keys[:1_000] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkFootprint(t, alex)
+
+	stats := alex.GetStats()
+	alex.StartMaintenance()
+	for i, key := range keys[1_000:] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alex.StopMaintenance()
+	checkFootprint(t, alex)
+	if recounts := alex.GetStats().NumFootprintRecounts - stats.NumFootprintRecounts; recounts != 0 {
+		t.Fatalf("background reorganisations must update the footprint in place, %d recounts", recounts)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Checks that the error of every key of every data node lies within the error bounds of its model
+func checkErrorBounds(t *testing.T, alex *index.Index) {
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.IsResizing() {
+			continue
+		}
+		for position := 0; position < leaf.DataCapacity; position++ {
+			if !leaf.Bitmap.Contains(uint32(position)) {
+				continue
+			}
+			key := leaf.KeyAt(position)
+			if err := position - leaf.PredictPosition(key); err < leaf.MinError || err > leaf.MaxError {
+				t.Fatalf("key %d at position %d has error %d outside of the bounds [%d, %d]", key, position, err, leaf.MinError, leaf.MaxError)
+			}
+		}
+	}
+}
+
+func TestModelErrorBounds(t *testing.T) {
+	rng := rand.New(rand.NewSource(23))
+	keys := GenerateExponentialKeys(100_000, 3)
+	alex := index.NewIndex()
+	// The binary search ignores the prediction, lookups only find keys within the error bounds
+	alex.SetSearchStrategy(node.BinarySearch)
+	alex.SetIncrementalResizeChunk(16)
+	for i, key := range keys {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+		if i%20_000 == 0 {
+			checkErrorBounds(t, alex)
+		}
+	}
+	checkErrorBounds(t, alex)
+
+	deleted := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		lo := keys[rng.Intn(len(keys))]
+		hi := lo + rng.Intn(1_000)
+		alex.DeleteRange(lo, hi)
+		for j, key := range keys {
+			if key >= lo && key < hi {
+				deleted[j] = true
+			}
+		}
+	}
+	checkErrorBounds(t, alex)
+	for i, key := range keys {
+		payload, err := alex.Find(key)
+		if deleted[i] {
+			if err == nil {
+				t.Fatalf("deleted key %d found", key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("key %d not found within the error bounds: %v", key, err)
+		}
+		if payload != i {
+			t.Fatalf("expected payload %d for key %d, got %d", i, key, payload)
+		}
+	}
+
+	modelErrors := alex.ModelErrors()
+	if modelErrors.MinError > 0 || modelErrors.MaxError < 0 || modelErrors.AvgErrorWindow < 1 {
+		t.Fatalf("inconsistent model errors %+v", modelErrors)
+	}
+}
+
+func TestExportTree(t *testing.T) {
+	alex, _, err := SequentialInserts(GenerateExponentialKeys(50_000, 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	if err := alex.ExportTree(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	numDataNodes, numModelNodes := 0, 0
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "data "):
+			numDataNodes++
+			if !strings.Contains(line, " error=[") {
+				t.Fatalf("data node exported without its error bounds: %q", line)
+			}
+		case strings.HasPrefix(line, "model "):
+			numModelNodes++
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	stats := alex.GetStats()
+	if numDataNodes != stats.NumDataNodes || numModelNodes != stats.NumModelNodes {
+		t.Fatalf("exported %d data nodes and %d model nodes, expected %d and %d", numDataNodes, numModelNodes, stats.NumDataNodes, stats.NumModelNodes)
+	}
+}
+
+func TestLookupsAtErrorWindowEdges(t *testing.T) {
+	for _, strategy := range []node.SearchStrategy{node.AdaptiveSearch, node.ExponentialSearch, node.LinearSearch, node.BinarySearch} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			// The model predicts each key at its value: keys 20 to 29 are placed 6 positions before their prediction
+			// and keys 30 to 39 9 positions after it, so that the error bounds are [-6, 9]
+			dataNode := node.NewDataNode(64)
+			dataNode.LinearModel.A = 1
+			dataNode.SearchStrategy = strategy
+			positions := make(map[shared.KeyType]int)
+			for key := 20; key < 40; key++ {
+				position := key - 6
+				if key >= 30 {
+					position = key + 9
+				}
+				dataNode.InsertElementAt(key, key, position)
+				dataNode.NumKeys++
+				positions[key] = position
+			}
+			for position := positions[39] + 1; position < dataNode.DataCapacity; position++ {
+				dataNode.Keys[position] = shared.KEndSentinel
+			}
+			// A gap outside of every error window holds a stale key that only a search past the window would read
+			dataNode.Keys[55] = 39
+			if dataNode.MinError != -6 || dataNode.MaxError != 9 {
+				t.Fatalf("expected error bounds [-6, 9], got [%d, %d]", dataNode.MinError, dataNode.MaxError)
+			}
+
+			// Keys 20 and 39 lie on the edges of their error windows
+			for key, expected := range positions {
+				if position, err := dataNode.FindKeyPosition(key); err != nil || position != expected {
+					t.Fatalf("key %d: expected position %d, got %d, %v", key, expected, position, err)
+				}
+			}
+			for _, key := range []shared.KeyType{0, 19, 40, 63, shared.KEndSentinel} {
+				if _, err := dataNode.FindKeyPosition(key); err == nil {
+					t.Fatalf("missing key %d found", key)
+				}
+			}
+		})
+	}
+}
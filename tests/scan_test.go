@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"alex_go/index"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestScanDescending(t *testing.T) {
+	rng := rand.New(rand.NewSource(23))
+	keys := GenerateExponentialKeys(100_000, 23)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+	payloadOf := make(map[int]int, len(keys))
+	for i, key := range keys {
+		payloadOf[key] = i
+	}
+
+	// A full scan visits every key in descending order
+	previous, numVisited := 0, 0
+	alex.ScanDescending(sorted[len(sorted)-1], func(key int, payload int) bool {
+		if numVisited > 0 && key >= previous {
+			t.Fatalf("keys out of order: %d after %d", key, previous)
+		}
+		if payloadOf[key] != payload {
+			t.Fatalf("expected payload %d for key %d, got %d", payloadOf[key], key, payload)
+		}
+		previous = key
+		numVisited++
+		return true
+	})
+	if numVisited != len(keys) {
+		t.Fatalf("expected %d keys, visited %d", len(keys), numVisited)
+	}
+
+	for probe := 0; probe < 500; probe++ {
+		before := sorted[rng.Intn(len(sorted))] + rng.Intn(3) - 1
+		n := rng.Intn(3_000)
+		last, payloads := alex.LastNBefore(before, n)
+		end := sort.SearchInts(sorted, before)
+		expected := sorted[max(0, end-n):end]
+		if len(last) != len(expected) {
+			t.Fatalf("last %d before %d: expected %d keys, got %d", n, before, len(expected), len(last))
+		}
+		for i, key := range last {
+			if key != expected[len(expected)-1-i] || payloads[i] != payloadOf[key] {
+				t.Fatalf("last %d before %d: unexpected key %d at %d", n, before, key, i)
+			}
+		}
+	}
+
+	if last, _ := alex.LastNBefore(sorted[0], 10); len(last) != 0 {
+		t.Fatalf("nothing precedes the smallest key, got %v", last)
+	}
+	empty := index.NewIndex()
+	if last, _ := empty.LastNBefore(42, 10); len(last) != 0 {
+		t.Fatalf("an empty index has no keys, got %v", last)
+	}
+}
+
+func TestScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(37))
+	keys := GenerateExponentialKeys(100_000, 37)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sorted := append([]int(nil), keys...)
+	sort.Ints(sorted)
+
+	for probe := 0; probe < 500; probe++ {
+		from := sorted[rng.Intn(len(sorted))] + rng.Intn(3) - 1
+		n := rng.Intn(3_000)
+		start := sort.SearchInts(sorted, from)
+		expected := sorted[start:min(len(sorted), start+n)]
+		visited := make([]int, 0, n)
+		alex.Scan(from, func(key int, payload int) bool {
+			if len(visited) == n {
+				return false
+			}
+			visited = append(visited, key)
+			return true
+		})
+		if len(visited) != len(expected) {
+			t.Fatalf("scan of %d keys from %d: expected %d keys, got %d", n, from, len(expected), len(visited))
+		}
+		for i, key := range visited {
+			if key != expected[i] {
+				t.Fatalf("scan of %d keys from %d: expected key %d at %d, got %d", n, from, expected[i], i, key)
+			}
+		}
+	}
+
+	stats := alex.GetStats()
+	if stats.NumKeys != len(keys) || stats.NumInserts != int64(len(keys)) || stats.NumDataNodes < 2 {
+		t.Fatalf("unexpected statistics %+v", stats)
+	}
+}
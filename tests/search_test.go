@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"alex_go/workload"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestLinearSearchMatchesBinarySearch(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	for _, capacity := range []int{1, 7, 8, 9, 100, 1_000} {
+		// Sorted slots with duplicates, as gaps hold the next key, and trailing gaps holding KEndSentinel
+		dataNode := node.NewDataNode(capacity)
+		for i := range dataNode.Keys {
+			dataNode.Keys[i] = shared.KeyType(rng.Intn(capacity))
+		}
+		slices.Sort(dataNode.Keys)
+		for i := capacity - capacity/10; i < capacity; i++ {
+			dataNode.Keys[i] = shared.KEndSentinel
+		}
+
+		for probe := 0; probe < 2_000; probe++ {
+			m := rng.Intn(capacity)
+			key := shared.KeyType(rng.Intn(capacity+2) - 1)
+			if probe%100 == 0 {
+				key = shared.KEndSentinel
+			}
+			if got, expected := dataNode.LinearSearchUpperBound(m, key), dataNode.BinarySearchUpperBound(0, capacity, key); got != expected {
+				t.Fatalf("capacity %d: upper bound of %d from %d: expected %d, got %d", capacity, key, m, expected, got)
+			}
+			if got, expected := dataNode.LinearSearchLowerBound(m, key), dataNode.BinarySearchLowerBound(0, capacity, key); got != expected {
+				t.Fatalf("capacity %d: lower bound of %d from %d: expected %d, got %d", capacity, key, m, expected, got)
+			}
+		}
+	}
+}
+
+func TestSearchStrategies(t *testing.T) {
+	keys := GenerateExponentialKeys(100_000, 5)
+	for _, strategy := range []node.SearchStrategy{node.AdaptiveSearch, node.ExponentialSearch, node.LinearSearch, node.BinarySearch} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			alex := index.NewIndex()
+			alex.SetSearchStrategy(strategy)
+			for i, key := range keys[:len(keys)/2] {
+				if err := alex.Insert(key, i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Data nodes created after the strategy was set search with it as well
+			for i, key := range keys[len(keys)/2:] {
+				if err := alex.Insert(key, len(keys)/2+i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, key := range keys {
+				payload, err := alex.Find(key)
+				if err != nil {
+					t.Fatalf("key %d not found: %v", key, err)
+				}
+				if payload != i {
+					t.Fatalf("expected payload %d for key %d, got %d", i, key, payload)
+				}
+			}
+			sorted := slices.Clone(keys)
+			slices.Sort(sorted)
+			for _, probe := range []int{0, len(sorted) / 3, len(sorted) - 1} {
+				if rank := alex.Rank(sorted[probe]); rank != probe {
+					t.Fatalf("expected rank %d for key %d, got %d", probe, sorted[probe], rank)
+				}
+			}
+
+			strategies := alex.SearchStrategies()
+			if strategy != node.AdaptiveSearch && strategies[strategy] != alex.GetStats().NumDataNodes {
+				t.Fatalf("expected every data node to search with %v, got %v", strategy, strategies)
+			}
+		})
+	}
+}
+
+func TestAdaptiveSearchFollowsModelError(t *testing.T) {
+	// Sequential keys are predicted exactly, every data node searches linearly
+	alex := index.NewIndex()
+	for i := 0; i < 100_000; i++ {
+		if err := alex.Insert(i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 100_000; i++ {
+		if _, err := alex.Find(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strategies := alex.SearchStrategies(); strategies[node.LinearSearch] != alex.GetStats().NumDataNodes {
+		t.Fatalf("expected every data node to search linearly, got %v", strategies)
+	}
+}
+
+// BenchmarkSearchStrategies Lookups of loaded keys with every data node searching with the same strategy
+func BenchmarkSearchStrategies(b *testing.B) {
+	datasets := []struct {
+		name string
+		keys []shared.KeyType
+	}{
+		{"sequential", workload.GenerateKeys(workload.SequentialKeys, 1_000_000, 42)},
+		{"uniform", workload.GenerateKeys(workload.UniformKeys, 1_000_000, 42)},
+		{"lognormal", workload.GenerateKeys(workload.LognormalKeys, 1_000_000, 42)},
+		{"osm", workload.GenerateDataset(workload.OsmDataset, 1_000_000, 42)},
+	}
+	for _, dataset := range datasets {
+		alex, _, err := SequentialInserts(dataset.keys)
+		if err != nil {
+			b.Fatal(err)
+		}
+		lookups := slices.Clone(dataset.keys)
+		rand.New(rand.NewSource(7)).Shuffle(len(lookups), func(i int, j int) {
+			lookups[i], lookups[j] = lookups[j], lookups[i]
+		})
+		for _, strategy := range []node.SearchStrategy{node.AdaptiveSearch, node.ExponentialSearch, node.LinearSearch, node.BinarySearch} {
+			b.Run(fmt.Sprintf("%s/%v", dataset.name, strategy), func(b *testing.B) {
+				alex.SetSearchStrategy(strategy)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := alex.Find(lookups[i%len(lookups)]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
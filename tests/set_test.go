@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestAlexSet(t *testing.T) {
+	keys := GenerateExponentialKeys(100_000, 11)
+	set := index.NewAlexSet()
+	reference := map[int]struct{}{}
+	for _, key := range keys {
+		added, err := set.Add(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !added {
+			t.Fatalf("key %d was reported as already present", key)
+		}
+		reference[key] = struct{}{}
+	}
+	// Adding a key twice keeps a single copy
+	if added, _ := set.Add(keys[0]); added {
+		t.Fatal("adding a present key must not add it again")
+	}
+
+	rng := rand.New(rand.NewSource(13))
+	for _, i := range rng.Perm(len(keys))[:len(keys)/3] {
+		if !set.Remove(keys[i]) {
+			t.Fatalf("key %d was not removed", keys[i])
+		}
+		delete(reference, keys[i])
+	}
+	if set.Remove(-1) {
+		t.Fatal("removing a missing key must fail")
+	}
+	// The extremes of KeyType can be added and removed like any other key
+	for _, key := range []shared.KeyType{shared.MinKey, shared.MaxKey} {
+		if added, err := set.Add(key); err != nil || !added {
+			t.Fatalf("key %d was not added: %v", key, err)
+		}
+		if !set.Remove(key) || set.Contains(key) {
+			t.Fatalf("key %d was not removed", key)
+		}
+	}
+
+	checkSet(t, set, reference)
+	for leaf := set.Index().FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.Payloads != nil {
+			t.Fatal("the data nodes of a set must not hold payloads")
+		}
+	}
+}
+
+func TestAlexSetOperations(t *testing.T) {
+	rng := rand.New(rand.NewSource(17))
+	left, right := index.NewAlexSet(), index.NewAlexSet()
+	inLeft, inRight := map[int]struct{}{}, map[int]struct{}{}
+	for i := 0; i < 50_000; i++ {
+		key := int(rng.ExpFloat64() * 1e6)
+		if rng.Intn(2) == 0 {
+			left.Add(key)
+			inLeft[key] = struct{}{}
+		} else {
+			right.Add(key)
+			inRight[key] = struct{}{}
+		}
+	}
+
+	union, intersection, difference := map[int]struct{}{}, map[int]struct{}{}, map[int]struct{}{}
+	for key := range inLeft {
+		union[key] = struct{}{}
+		if _, ok := inRight[key]; ok {
+			intersection[key] = struct{}{}
+		} else {
+			difference[key] = struct{}{}
+		}
+	}
+	for key := range inRight {
+		union[key] = struct{}{}
+	}
+
+	result, err := left.Union(right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSet(t, result, union)
+	result, err = left.Intersection(right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSet(t, result, intersection)
+	result, err = left.Difference(right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSet(t, result, difference)
+}
+
+// Checks that set holds exactly the keys of reference, in ascending order
+func checkSet(t *testing.T, set *index.AlexSet, reference map[int]struct{}) {
+	expected := make([]shared.KeyType, 0, len(reference))
+	for key := range reference {
+		expected = append(expected, key)
+	}
+	sort.Ints(expected)
+
+	if set.Len() != len(expected) {
+		t.Fatalf("expected %d keys, the set holds %d", len(expected), set.Len())
+	}
+	keys := set.Keys()
+	if len(keys) != len(expected) {
+		t.Fatalf("expected to iterate over %d keys, got %d", len(expected), len(keys))
+	}
+	for i, key := range keys {
+		if key != expected[i] {
+			t.Fatalf("expected key %d at position %d, got %d", expected[i], i, key)
+		}
+		if !set.Contains(key) {
+			t.Fatalf("key %d is missing", key)
+		}
+	}
+}
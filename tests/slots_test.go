@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/node"
+	"alex_go/shared"
+	"alex_go/workload"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Random operations against every combination of data node layout and slot layout, see runDifferential
+func TestLayoutsDifferential(t *testing.T) {
+	for _, layout := range []node.DataNodeLayout{node.GappedArrayLayout, node.PackedMemoryArrayLayout} {
+		for _, slotLayout := range []node.SlotLayout{node.SeparateSlots, node.InterleavedSlots} {
+			for _, resizeChunk := range []int{0, 8} {
+				t.Run(fmt.Sprintf("%v/%v/%d", layout, slotLayout, resizeChunk), func(t *testing.T) {
+					rng := rand.New(rand.NewSource(int64(resizeChunk) + 3))
+					for seed := 0; seed < 4; seed++ {
+						data := make([]byte, 4_000)
+						rng.Read(data)
+						alex := index.NewIndex()
+						alex.SetDataNodeLayout(layout)
+						alex.SetSlotLayout(slotLayout)
+						alex.SetIncrementalResizeChunk(resizeChunk)
+						runDifferentialOn(t, alex, data)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSetSlotLayout(t *testing.T) {
+	keys := GenerateRandomKeys(100_000)
+	alex := index.NewIndex()
+	for i, key := range keys[:len(keys)/2] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Existing data nodes are converted, those built from them inherit the layout
+	alex.SetSlotLayout(node.InterleavedSlots)
+	for i, key := range keys[len(keys)/2:] {
+		if err := alex.Insert(key, len(keys)/2+i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := alex.Update(keys[0], -1); err != nil {
+		t.Fatal(err)
+	}
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.Slots == nil || leaf.Keys != nil || leaf.Payloads != nil {
+			t.Fatalf("data node with %d keys is not interleaved", leaf.NumKeys)
+		}
+	}
+
+	alex.SetSlotLayout(node.SeparateSlots)
+	for i, key := range keys {
+		payload, err := alex.Find(key)
+		if err != nil {
+			t.Fatalf("key %d not found: %v", key, err)
+		}
+		expected := i
+		if i == 0 {
+			expected = -1
+		}
+		if payload != expected {
+			t.Fatalf("expected payload %d for key %d, got %d", expected, key, payload)
+		}
+	}
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted)
+	if first, _, err := alex.Select(0); err != nil || first != sorted[0] {
+		t.Fatalf("expected %d as the smallest key, got %d (%v)", sorted[0], first, err)
+	}
+}
+
+// BenchmarkSlotLayouts Lookups of loaded keys and inserts of new keys in a large index, with each slot layout
+func BenchmarkSlotLayouts(b *testing.B) {
+	const numKeys = 5_000_000
+	for _, distribution := range []workload.KeyDistribution{workload.UniformKeys, workload.LognormalKeys} {
+		keys := workload.GenerateKeys(distribution, 2*numKeys, 42)
+		loaded, inserted := keys[:numKeys], keys[numKeys:]
+		lookups := slices.Clone(loaded)
+		rand.New(rand.NewSource(7)).Shuffle(len(lookups), func(i int, j int) {
+			lookups[i], lookups[j] = lookups[j], lookups[i]
+		})
+		for _, slotLayout := range []node.SlotLayout{node.SeparateSlots, node.InterleavedSlots} {
+			alex := index.NewIndex()
+			alex.SetSlotLayout(slotLayout)
+			for i, key := range loaded {
+				if err := alex.Insert(key, i); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.Run(fmt.Sprintf("%v/%v/lookups", distribution, slotLayout), func(b *testing.B) {
+				checksum := shared.PayloadType(0)
+				for i := 0; i < b.N; i++ {
+					payload, err := alex.Find(lookups[i%len(lookups)])
+					if err != nil {
+						b.Fatal(err)
+					}
+					checksum += payload
+				}
+			})
+			b.Run(fmt.Sprintf("%v/%v/inserts", distribution, slotLayout), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := alex.Insert(inserted[i%len(inserted)], i); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
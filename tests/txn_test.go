@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	keys := GenerateExponentialKeys(50_000, 29)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the record of keys[0] to a new key
+	txn := alex.Begin()
+	payload, err := txn.Get(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved := -1
+	txn.Put(moved, payload)
+	txn.Delete(keys[0])
+	if _, err := txn.Get(keys[0]); !errors.Is(err, shared.KeyNotFoundError) {
+		t.Fatalf("the transaction must see its own delete, got %v", err)
+	}
+	if got, _ := txn.Get(moved); got != payload {
+		t.Fatalf("the transaction must see its own put, got %d", got)
+	}
+	if _, err := alex.Find(moved); err == nil {
+		t.Fatal("writes must not be visible before the commit")
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := alex.Find(moved); err != nil || found != payload {
+		t.Fatalf("the moved record is missing after the commit: %v", err)
+	}
+	if _, err := alex.Find(keys[0]); err == nil {
+		t.Fatal("the moved record is still at its old key")
+	}
+	if err := txn.Put(1, 1); !errors.Is(err, shared.TxnClosedError) {
+		t.Fatalf("expected TxnClosedError, got %v", err)
+	}
+
+	// Rolled back writes are never applied
+	txn = alex.Begin()
+	for i := 1; i < 100; i++ {
+		txn.Put(keys[i], -i)
+	}
+	txn.Rollback()
+	for i := 1; i < 100; i++ {
+		if found, err := alex.Find(keys[i]); err != nil || found != i {
+			t.Fatalf("a rolled back write to key %d was applied", keys[i])
+		}
+	}
+	checkLeafChain(t, alex, len(keys))
+}
+
+func TestTxnCommitFailure(t *testing.T) {
+	keys := GenerateExponentialKeys(100_000, 31)
+	alex := index.NewIndex()
+	for i, key := range keys[:50_000] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alex.SetMemoryBudget(alex.MemoryFootprint() + 64<<10)
+
+	// The inserts exceed the budget halfway through, after splitting data nodes
+	txn := alex.Begin()
+	txn.Put(keys[0], -1)
+	txn.Delete(keys[1])
+	for i, key := range keys[50_000:] {
+		txn.Put(key, 50_000+i)
+	}
+	// Writes are applied in key order, the insert of MinKey is the first one undone
+	txn.Put(shared.MinKey, -1)
+	txn.Put(shared.MaxKey, -1)
+	if err := txn.Commit(); !errors.Is(err, shared.MemoryBudgetExceededError) {
+		t.Fatalf("expected the commit to exceed the memory budget, got %v", err)
+	}
+
+	if err := SequentialLookups(alex, keys[:50_000]); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range append(keys[50_000:], shared.MinKey, shared.MaxKey) {
+		if _, err := alex.Find(key); err == nil {
+			t.Fatalf("key %d of the failed commit is in the index", key)
+		}
+	}
+	checkLeafChain(t, alex, 50_000)
+}
+
+func TestTxnExtremeKeys(t *testing.T) {
+	alex := index.NewIndex()
+	for i, key := range []shared.KeyType{shared.MinKey, 0, shared.MaxKey} {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txn := alex.Begin()
+	txn.Delete(shared.MaxKey)
+	txn.Delete(shared.MinKey)
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []shared.KeyType{shared.MinKey, shared.MaxKey} {
+		if _, err := alex.Find(key); !errors.Is(err, shared.KeyNotFoundError) {
+			t.Fatalf("deleted key %d is still found: %v", key, err)
+		}
+	}
+	checkLeafChain(t, alex, 1)
+}
+
+func TestTxnGetDuringInserts(t *testing.T) {
+	keys := GenerateExponentialKeys(20_000, 31)
+	alex := index.NewIndex()
+	for i, key := range keys[:len(keys)/2] {
+		if err := alex.Insert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The inserts shift and resize the slots of the records read by the transaction
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := len(keys) / 2; i < len(keys); i++ {
+			alex.Insert(keys[i], i)
+		}
+	}()
+	txn := alex.Begin()
+	for i, key := range keys[:len(keys)/2] {
+		if payload, err := txn.Get(key); err != nil || payload != i {
+			t.Errorf("key %d: got payload %d, %v", key, payload, err)
+			break
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"alex_go/index"
+	"alex_go/shared"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestUpdateAndUpsert(t *testing.T) {
+	keys := GenerateRandomKeys(100_000)
+	alex := index.NewIndex()
+	if err := alex.Update(keys[0], 1); !errors.Is(err, shared.KeyNotFoundError) {
+		t.Fatalf("updating a missing key must fail with KeyNotFoundError, got %v", err)
+	}
+
+	for i, key := range keys {
+		if err := alex.Upsert(key, -1); err != nil {
+			t.Fatal(err)
+		}
+		if err := alex.Upsert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Payloads must survive the resizes and splits caused by later inserts
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, len(keys))
+
+	for i, key := range keys {
+		if err := alex.Update(key, 2*i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, key := range keys {
+		payload, err := alex.Find(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload != 2*i {
+			t.Fatalf("expected payload %d for key %d, got %d", 2*i, key, payload)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	alex := index.NewIndex()
+	counts := map[int]int{}
+	for i := 0; i < 200_000; i++ {
+		key := rng.Intn(20_000)
+		counts[key]++
+		err := alex.Compute(key, func(payload int, exists bool) (int, bool) {
+			if !exists {
+				return 1, true
+			}
+			return payload + 1, true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, count := range counts {
+		payload, err := alex.Find(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload != count {
+			t.Fatalf("expected count %d for key %d, got %d", count, key, payload)
+		}
+	}
+	checkLeafChain(t, alex, len(counts))
+
+	// Declining the write leaves the index untouched
+	err := alex.Compute(-1, func(payload int, exists bool) (int, bool) {
+		return 0, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alex.Find(-1); !errors.Is(err, shared.KeyNotFoundError) {
+		t.Fatal("a declined compute must not insert the key")
+	}
+}
+
+func TestUpsertDuringMaintenance(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	keys := make([]int, 0, 100_000)
+	seen := map[int]struct{}{}
+	for len(keys) < cap(keys) {
+		key := int(rng.ExpFloat64() * 1e9)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+
+	alex := index.NewIndex()
+	alex.StartMaintenance()
+	for i, key := range keys {
+		if err := alex.Upsert(key, -1); err != nil {
+			t.Fatal(err)
+		}
+		// Overwrite an earlier key, possibly while its leaf is rebuilt in the background
+		previous := rng.Intn(i + 1)
+		if err := alex.Upsert(keys[previous], previous); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, key := range keys {
+		if err := alex.Upsert(key, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alex.StopMaintenance()
+
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+	checkLeafChain(t, alex, len(keys))
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"alex_go/cost_models"
+	"testing"
+)
+
+func TestInsertFracEstimatorFollowsWorkload(t *testing.T) {
+	estimator := cost_models.InsertFracEstimator{}
+	if estimator.InsertFrac(0.3) != 0.3 {
+		t.Fatal("an empty estimator must return the prior")
+	}
+	for i := 0; i < 10_000; i++ {
+		estimator.RecordInsert()
+	}
+	if frac := estimator.InsertFrac(0); frac < 0.99 {
+		t.Fatalf("expected an insert-only estimate, got %f", frac)
+	}
+	for i := 0; i < 20_000; i++ {
+		estimator.RecordLookup()
+	}
+	if frac := estimator.InsertFrac(1); frac > 0.05 {
+		t.Fatalf("expected the estimate to decay towards lookups, got %f", frac)
+	}
+}
+
+func TestIndexTracksReadWriteMix(t *testing.T) {
+	keys := GenerateRandomKeys(100_000)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frac := alex.ExpectedInsertFrac(); frac < 0.99 {
+		t.Fatalf("expected an insert-heavy estimate after loading, got %f", frac)
+	}
+
+	for round := 0; round < 3; round++ {
+		if err := SequentialLookups(alex, keys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if frac := alex.ExpectedInsertFrac(); frac > 0.05 {
+		t.Fatalf("expected a read-heavy estimate after lookups, got %f", frac)
+	}
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.Workload.IsReliable() && leaf.Workload.InsertFrac(1) > 0.5 {
+			t.Fatalf("leaf still considers itself insert-heavy: %f", leaf.Workload.InsertFrac(1))
+		}
+	}
+
+	// The read-hot index must keep accepting inserts
+	moreKeys := make([]int, 0, 10_000)
+	for i := 0; i < 10_000; i++ {
+		moreKeys = append(moreKeys, 2*len(keys)+i)
+	}
+	for i, key := range moreKeys {
+		if err := alex.Insert(key, len(keys)+i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SequentialLookups(alex, keys); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestComputeRecordsOneOperation(t *testing.T) {
+	keys := GenerateRandomKeys(100_000)
+	alex, _, err := SequentialInserts(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Upserts of present keys replace payloads and count as lookups
+	for round := 0; round < 3; round++ {
+		for i, key := range keys {
+			if err := alex.Upsert(key, i+1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if frac := alex.ExpectedInsertFrac(); frac > 0.05 {
+		t.Fatalf("expected a read-heavy estimate after updating upserts, got %f", frac)
+	}
+
+	// Upserts of missing keys insert them and count as inserts only
+	for i := 0; i < 50_000; i++ {
+		if err := alex.Upsert(2*len(keys)+i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if frac := alex.ExpectedInsertFrac(); frac < 0.95 {
+		t.Fatalf("expected an insert-heavy estimate after inserting upserts, got %f", frac)
+	}
+	for leaf := alex.FirstDataNode(); leaf != nil; leaf = leaf.NextLeaf {
+		if leaf.GetFirstKey() >= 2*len(keys) && leaf.Workload.IsReliable() && leaf.Workload.InsertFrac(0) < 0.95 {
+			t.Fatalf("leaf filled by upserts considers itself read-heavy: %f", leaf.Workload.InsertFrac(0))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"alex_go/workload"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestGenerateKeys(t *testing.T) {
+	for _, distribution := range []workload.KeyDistribution{
+		workload.UniformKeys, workload.LognormalKeys, workload.NormalKeys,
+		workload.SequentialKeys, workload.ReverseSequentialKeys, workload.ClusteredKeys,
+	} {
+		keys := workload.GenerateKeys(distribution, 50_000, 5)
+		if !slices.Equal(keys, workload.GenerateKeys(distribution, 50_000, 5)) {
+			t.Fatalf("%s keys differ for the same seed", distribution)
+		}
+		sorted := slices.Clone(keys)
+		slices.Sort(sorted)
+		if len(slices.Compact(sorted)) != len(keys) {
+			t.Fatalf("%s keys are not distinct", distribution)
+		}
+		if keys[0] < 0 {
+			t.Fatalf("%s keys must not be negative", distribution)
+		}
+	}
+	if keys := workload.GenerateKeys(workload.ReverseSequentialKeys, 3, 0); !slices.Equal(keys, []int{2, 1, 0}) {
+		t.Fatalf("unexpected reverse sequential keys %v", keys)
+	}
+}
+
+func TestYCSBWorkloads(t *testing.T) {
+	loaded := workload.GenerateKeys(workload.UniformKeys, 100_000, 1)
+	inserted := workload.GenerateKeys(workload.SequentialKeys, 10_000, 0)
+
+	operations := workload.NewWorkload(workload.WorkloadA, loaded, inserted, 3).Operations(100_000)
+	if !slices.Equal(operations, workload.NewWorkload(workload.WorkloadA, loaded, inserted, 3).Operations(100_000)) {
+		t.Fatal("operations differ for the same seed")
+	}
+	counts := map[workload.OperationKind]int{}
+	for _, operation := range operations {
+		counts[operation.Kind]++
+	}
+	if counts[workload.Read] < 49_000 || counts[workload.Read] > 51_000 || counts[workload.Read]+counts[workload.Update] != len(operations) {
+		t.Fatalf("expected half reads and half updates, got %v", counts)
+	}
+
+	// Most reads of workload D go to the records inserted last
+	recordOf := map[int]int{}
+	for i, key := range append(slices.Clone(loaded), inserted...) {
+		recordOf[key] = i
+	}
+	numInserts, numRecentReads, numReads := 0, 0, 0
+	for _, operation := range workload.NewWorkload(workload.WorkloadD, loaded, inserted, 3).Operations(100_000) {
+		switch operation.Kind {
+		case workload.Insert:
+			if operation.Key != inserted[numInserts] {
+				t.Fatalf("expected to insert %d, got %d", inserted[numInserts], operation.Key)
+			}
+			numInserts++
+		case workload.Read:
+			numReads++
+			if recordOf[operation.Key] >= len(loaded)+numInserts-1_000 {
+				numRecentReads++
+			}
+		}
+	}
+	if numInserts < 4_000 || float64(numRecentReads) < 0.5*float64(numReads) {
+		t.Fatalf("expected reads of the latest records, %d of %d reads were recent", numRecentReads, numReads)
+	}
+
+	for _, operation := range workload.NewWorkload(workload.WorkloadE, loaded, nil, 3).Operations(10_000) {
+		if operation.Kind == workload.Scan && (operation.ScanLength < 1 || operation.ScanLength > 100) {
+			t.Fatalf("unexpected scan length %d", operation.ScanLength)
+		}
+		if operation.Kind == workload.Insert {
+			t.Fatal("inserts must turn into reads once the keys to insert run out")
+		}
+	}
+}
+
+func TestRequestDistributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(9))
+	const numRecords = 10_000
+	zipfian := workload.NewZipfianRequests(rng, 0.99)
+	hotspot := workload.NewHotspotRequests(rng, 0.2, 0.8)
+	numTop, numHot := 0, 0
+	for i := 0; i < 100_000; i++ {
+		if zipfian.Next(numRecords) < 100 {
+			numTop++
+		}
+		if hotspot.Next(numRecords) < numRecords/5 {
+			numHot++
+		}
+	}
+	// The 1% most popular records of a Zipfian distribution with theta 0.99 receive about half of the requests
+	if numTop < 40_000 {
+		t.Fatalf("expected a skewed distribution, the top 100 records received %d requests", numTop)
+	}
+	if numHot < 79_000 || numHot > 81_000 {
+		t.Fatalf("expected 80%% of the requests in the hot set, got %d", numHot)
+	}
+}
@@ -0,0 +1,175 @@
+package workload
+
+import (
+	"alex_go/shared"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+// Dataset Synthetic approximation of a dataset of the SOSD benchmark, generated offline
+type Dataset int
+
+const (
+	// BooksDataset Popularity of books on Amazon: a smooth mixture of lognormal components
+	BooksDataset Dataset = iota
+	// FacebookDataset User IDs: uniform runs of varying density over [0, 2^40), and a few outliers close to 2^62
+	FacebookDataset
+	// OsmDataset Cell IDs of locations from OpenStreetMap: points clustered around cities, encoded as 62-bit
+	// Z-order cell IDs, which are odd like leaf S2 cell IDs
+	OsmDataset
+	// WikiDataset Edit timestamps of Wikipedia, in seconds: edits grow from 2001 to 2018 and follow weekly and daily
+	// cycles
+	WikiDataset
+)
+
+func (self Dataset) String() string {
+	switch self {
+	case BooksDataset:
+		return "books"
+	case FacebookDataset:
+		return "fb"
+	case OsmDataset:
+		return "osm"
+	case WikiDataset:
+		return "wiki"
+	default:
+		return "unknown"
+	}
+}
+
+// GenerateDataset Returns n distinct keys approximating dataset, sorted like the SOSD files.
+// The same seed always gives the same keys.
+func GenerateDataset(dataset Dataset, n int, seed int64) []shared.KeyType {
+	rng := rand.New(rand.NewSource(seed))
+	var draw func() shared.KeyType
+	switch dataset {
+	case BooksDataset:
+		draw = booksDraw(rng)
+	case FacebookDataset:
+		draw = facebookDraw(rng)
+	case OsmDataset:
+		draw = osmDraw(rng)
+	default:
+		draw = wikiDraw(rng)
+	}
+	keys := drawDistinct(n, draw)
+	slices.Sort(keys)
+	return keys
+}
+
+// Cumulative sums of weights, to draw from with weightedChoice
+func cumulativeWeights(weights []float64) []float64 {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		total += weight
+		cumulative[i] = total
+	}
+	return cumulative
+}
+
+// Draws an index with a probability proportional to its weight
+func weightedChoice(rng *rand.Rand, cumulative []float64) int {
+	return min(sort.SearchFloat64s(cumulative, rng.Float64()*cumulative[len(cumulative)-1]), len(cumulative)-1)
+}
+
+func booksDraw(rng *rand.Rand) func() shared.KeyType {
+	const numComponents = 8
+	weights := make([]float64, numComponents)
+	mus := make([]float64, numComponents)
+	sigmas := make([]float64, numComponents)
+	for i := range weights {
+		weights[i] = rng.ExpFloat64()
+		mus[i] = 18 + 8*rng.Float64()
+		sigmas[i] = 0.2 + 0.8*rng.Float64()
+	}
+	cumulative := cumulativeWeights(weights)
+	return func() shared.KeyType {
+		component := weightedChoice(rng, cumulative)
+		return shared.KeyType(math.Exp(mus[component] + sigmas[component]*rng.NormFloat64()))
+	}
+}
+
+func facebookDraw(rng *rand.Rand) func() shared.KeyType {
+	const numSegments = 1024
+	const segmentSize = (1 << 40) / numSegments
+	densities := make([]float64, numSegments)
+	for i := range densities {
+		densities[i] = math.Exp(1.5 * rng.NormFloat64())
+	}
+	cumulative := cumulativeWeights(densities)
+	return func() shared.KeyType {
+		if rng.Float64() < 1e-4 {
+			return shared.KeyType(1<<60 + rng.Int63n(3<<60))
+		}
+		return shared.KeyType(weightedChoice(rng, cumulative)*segmentSize + rng.Intn(segmentSize))
+	}
+}
+
+func osmDraw(rng *rand.Rand) func() shared.KeyType {
+	const numCities = 256
+	populations := make([]float64, numCities)
+	latitudes := make([]float64, numCities)
+	longitudes := make([]float64, numCities)
+	for i := range populations {
+		// Zipf's law for city sizes
+		populations[i] = 1 / float64(i+1)
+		latitudes[i] = -60 + 130*rng.Float64()
+		longitudes[i] = -180 + 360*rng.Float64()
+	}
+	cumulative := cumulativeWeights(populations)
+	return func() shared.KeyType {
+		var latitude, longitude float64
+		if rng.Float64() < 0.1 {
+			latitude, longitude = -90+180*rng.Float64(), -180+360*rng.Float64()
+		} else {
+			city := weightedChoice(rng, cumulative)
+			latitude = min(max(latitudes[city]+0.2*rng.NormFloat64(), -90), 90)
+			longitude = min(max(longitudes[city]+0.2*rng.NormFloat64(), -180), 180)
+		}
+		x := min(uint64((longitude+180)/360*(1<<31)), 1<<31-1)
+		y := min(uint64((latitude+90)/180*(1<<31)), 1<<31-1)
+		return shared.KeyType((interleaveBits(x)|interleaveBits(y)<<1)<<1 | 1)
+	}
+}
+
+// Spreads the 32 low bits of value to the even bits of the result
+func interleaveBits(value uint64) uint64 {
+	value &= 0xFFFFFFFF
+	value = (value | value<<16) & 0x0000FFFF0000FFFF
+	value = (value | value<<8) & 0x00FF00FF00FF00FF
+	value = (value | value<<4) & 0x0F0F0F0F0F0F0F0F
+	value = (value | value<<2) & 0x3333333333333333
+	value = (value | value<<1) & 0x5555555555555555
+	return value
+}
+
+func wikiDraw(rng *rand.Rand) func() shared.KeyType {
+	const start = 979_516_800 // 2001-01-15, the launch of Wikipedia
+	const end = 1_514_764_800 // 2018-01-01
+	const secondsPerDay = 24 * 60 * 60
+	numDays := (end - start) / secondsPerDay
+	weights := make([]float64, numDays)
+	for day := range weights {
+		// Logistic growth of the activity, saturating around 2007
+		weights[day] = 1 / (1 + math.Exp(-float64(day-6*365)/300))
+		// 2001-01-15 was a Monday, weekends are quieter
+		if day%7 >= 5 {
+			weights[day] *= 0.85
+		}
+	}
+	cumulative := cumulativeWeights(weights)
+	return func() shared.KeyType {
+		day := weightedChoice(rng, cumulative)
+		// Edits peak around 15:00 UTC
+		for {
+			second := rng.Intn(secondsPerDay)
+			activity := 1 + 0.5*math.Cos(2*math.Pi*(float64(second)/secondsPerDay-15.0/24))
+			if 1.5*rng.Float64() < activity {
+				return shared.KeyType(start + day*secondsPerDay + second)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package workload
+
+import (
+	"alex_go/shared"
+	"math"
+	"math/rand"
+)
+
+// KeyDistribution Distribution the keys of a dataset are drawn from
+type KeyDistribution int
+
+const (
+	// UniformKeys Uniform over [0, 2^40)
+	UniformKeys KeyDistribution = iota
+	// LognormalKeys Lognormal with mu 0 and sigma 2, scaled by 10^6, as in the learned index benchmarks
+	LognormalKeys
+	// NormalKeys Normal centered on 2^39 with a standard deviation of 2^35
+	NormalKeys
+	// SequentialKeys 0, 1, 2, ... in ascending order
+	SequentialKeys
+	// ReverseSequentialKeys n-1, n-2, ... 0 in descending order
+	ReverseSequentialKeys
+	// ClusteredKeys Dense clusters of about 10^4 keys around centers spread uniformly over [0, 2^40)
+	ClusteredKeys
+)
+
+const keyDomain = 1 << 40
+
+func (self KeyDistribution) String() string {
+	switch self {
+	case UniformKeys:
+		return "uniform"
+	case LognormalKeys:
+		return "lognormal"
+	case NormalKeys:
+		return "normal"
+	case SequentialKeys:
+		return "sequential"
+	case ReverseSequentialKeys:
+		return "reverse-sequential"
+	case ClusteredKeys:
+		return "clustered"
+	default:
+		return "unknown"
+	}
+}
+
+// GenerateKeys Returns n distinct keys drawn from distribution, in the order they were drawn.
+// The same seed always gives the same keys.
+func GenerateKeys(distribution KeyDistribution, n int, seed int64) []shared.KeyType {
+	switch distribution {
+	case SequentialKeys:
+		keys := make([]shared.KeyType, 0, n)
+		for i := 0; i < n; i++ {
+			keys = append(keys, shared.KeyType(i))
+		}
+		return keys
+	case ReverseSequentialKeys:
+		keys := make([]shared.KeyType, 0, n)
+		for i := n - 1; i >= 0; i-- {
+			keys = append(keys, shared.KeyType(i))
+		}
+		return keys
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	draw := func() shared.KeyType {
+		return shared.KeyType(rng.Int63n(keyDomain))
+	}
+	switch distribution {
+	case LognormalKeys:
+		draw = func() shared.KeyType {
+			return shared.KeyType(math.Exp(rng.NormFloat64()*2) * 1e6)
+		}
+	case NormalKeys:
+		draw = func() shared.KeyType {
+			return shared.KeyType(max(0, keyDomain/2+rng.NormFloat64()*(1<<35)))
+		}
+	case ClusteredKeys:
+		centers := make([]float64, max(1, n/10_000))
+		for i := range centers {
+			centers[i] = float64(rng.Int63n(keyDomain))
+		}
+		draw = func() shared.KeyType {
+			center := centers[rng.Intn(len(centers))]
+			return shared.KeyType(min(max(0, center+rng.NormFloat64()*1e6), keyDomain-1))
+		}
+	}
+
+	return drawDistinct(n, draw)
+}
+
+// Returns the first n distinct keys returned by draw
+func drawDistinct(n int, draw func() shared.KeyType) []shared.KeyType {
+	keys := make([]shared.KeyType, 0, n)
+	existingKeys := make(map[shared.KeyType]struct{}, n)
+	for len(keys) < n {
+		key := draw()
+		if _, ok := existingKeys[key]; !ok {
+			existingKeys[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,137 @@
+package workload
+
+import (
+	"math"
+	"math/rand"
+)
+
+// RequestDistribution Chooses the records requested by the operations of a workload
+type RequestDistribution interface {
+	// Next Position of the next requested record among numRecords records, numbered in insertion order
+	Next(numRecords int) int
+}
+
+// UniformRequests Every record is equally likely to be requested
+type UniformRequests struct {
+	rng *rand.Rand
+}
+
+func NewUniformRequests(rng *rand.Rand) *UniformRequests {
+	return &UniformRequests{rng: rng}
+}
+
+func (self *UniformRequests) Next(numRecords int) int {
+	return self.rng.Intn(numRecords)
+}
+
+// ZipfianRequests The record of rank i is requested with a probability proportional to 1/(i+1)^theta, following
+// the generator of YCSB (Gray et al., "Quickly generating billion-record synthetic databases").
+// Once scrambled, the ranks are hashed over the records so that the popular records are spread over the key space
+// instead of being the first ones inserted.
+type ZipfianRequests struct {
+	rng       *rand.Rand
+	theta     float64
+	alpha     float64
+	zeta2     float64
+	scrambled bool
+	// Number of records zetaN was computed for
+	numRecords int
+	// Sum of 1/i^theta for i in [1, numRecords]
+	zetaN float64
+	eta   float64
+}
+
+func NewZipfianRequests(rng *rand.Rand, theta float64) *ZipfianRequests {
+	return &ZipfianRequests{
+		rng:   rng,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zeta2: 1 + math.Pow(0.5, theta),
+	}
+}
+
+func NewScrambledZipfianRequests(rng *rand.Rand, theta float64) *ZipfianRequests {
+	requests := NewZipfianRequests(rng, theta)
+	requests.scrambled = true
+	return requests
+}
+
+// Updates zetaN and eta for numRecords records, incrementally when records were added
+func (self *ZipfianRequests) resize(numRecords int) {
+	if numRecords < self.numRecords {
+		self.numRecords, self.zetaN = 0, 0
+	}
+	for i := self.numRecords + 1; i <= numRecords; i++ {
+		self.zetaN += 1 / math.Pow(float64(i), self.theta)
+	}
+	self.numRecords = numRecords
+	self.eta = (1 - math.Pow(2/float64(numRecords), 1-self.theta)) / (1 - self.zeta2/self.zetaN)
+}
+
+// Rank of the next requested record, 0 being the most popular
+func (self *ZipfianRequests) nextRank(numRecords int) int {
+	if numRecords != self.numRecords {
+		self.resize(numRecords)
+	}
+	u := self.rng.Float64()
+	uz := u * self.zetaN
+	if uz < 1 || numRecords == 1 {
+		return 0
+	}
+	if uz < self.zeta2 {
+		return 1
+	}
+	return min(int(float64(numRecords)*math.Pow(self.eta*u-self.eta+1, self.alpha)), numRecords-1)
+}
+
+func (self *ZipfianRequests) Next(numRecords int) int {
+	rank := self.nextRank(numRecords)
+	if !self.scrambled {
+		return rank
+	}
+	return int(fnvHash64(uint64(rank)) % uint64(numRecords))
+}
+
+// 64-bit FNV-1a hash of the bytes of value, as used by YCSB to scramble ranks
+func fnvHash64(value uint64) uint64 {
+	hash := uint64(0xCBF29CE484222325)
+	for i := 0; i < 8; i++ {
+		hash ^= value & 0xFF
+		hash *= 0x100000001B3
+		value >>= 8
+	}
+	return hash
+}
+
+// LatestRequests The most recently inserted records are the most popular, with Zipfian popularities
+type LatestRequests struct {
+	zipfian *ZipfianRequests
+}
+
+func NewLatestRequests(rng *rand.Rand, theta float64) *LatestRequests {
+	return &LatestRequests{zipfian: NewZipfianRequests(rng, theta)}
+}
+
+func (self *LatestRequests) Next(numRecords int) int {
+	return numRecords - 1 - self.zipfian.nextRank(numRecords)
+}
+
+// HotspotRequests A fraction hotOpnFraction of the requests go to the first hotDataFraction of the records, the
+// rest to the other records, uniformly within each set
+type HotspotRequests struct {
+	rng             *rand.Rand
+	hotDataFraction float64
+	hotOpnFraction  float64
+}
+
+func NewHotspotRequests(rng *rand.Rand, hotDataFraction float64, hotOpnFraction float64) *HotspotRequests {
+	return &HotspotRequests{rng: rng, hotDataFraction: hotDataFraction, hotOpnFraction: hotOpnFraction}
+}
+
+func (self *HotspotRequests) Next(numRecords int) int {
+	numHot := min(max(1, int(float64(numRecords)*self.hotDataFraction)), numRecords)
+	if numHot == numRecords || self.rng.Float64() < self.hotOpnFraction {
+		return self.rng.Intn(numHot)
+	}
+	return numHot + self.rng.Intn(numRecords-numHot)
+}
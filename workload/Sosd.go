@@ -0,0 +1,87 @@
+package workload
+
+import (
+	"alex_go/shared"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// LoadSOSD Loads the keys of a dataset in the binary format of the SOSD benchmark: the number of keys as a
+// little-endian uint64, followed by the keys as little-endian uint64s.
+// Keys above the largest KeyType fail with KeyOutOfRangeError.
+func LoadSOSD(path string) ([]shared.KeyType, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	keys, err := ReadSOSD(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ReadSOSD Reads keys in the binary format of the SOSD benchmark, see LoadSOSD
+func ReadSOSD(reader io.Reader) ([]shared.KeyType, error) {
+	return ReadSOSDPrefix(reader, math.MaxInt)
+}
+
+// ReadSOSDPrefix Reads the first maxKeys keys in the binary format of the SOSD benchmark, all of them if the file
+// holds fewer. The rest of the file is left unread
+func ReadSOSDPrefix(reader io.Reader, maxKeys int) ([]shared.KeyType, error) {
+	var count uint64
+	if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("reading the number of keys: %w", err)
+	}
+	count = min(count, uint64(max(maxKeys, 0)))
+	// The count is not trusted for the initial allocation, a corrupt header must not exhaust the memory
+	keys := make([]shared.KeyType, 0, min(count, 1<<24))
+	var buffer [8]byte
+	for i := uint64(0); i < count; i++ {
+		if _, err := io.ReadFull(reader, buffer[:]); err != nil {
+			return nil, fmt.Errorf("reading key %d of %d: %w", i, count, err)
+		}
+		key := binary.LittleEndian.Uint64(buffer[:])
+		if key > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: key %d of %d is %d", shared.KeyOutOfRangeError, i, count, key)
+		}
+		keys = append(keys, shared.KeyType(key))
+	}
+	return keys, nil
+}
+
+// WriteSOSD Writes keys in the binary format of the SOSD benchmark, see LoadSOSD.
+// Negative keys fail with KeyOutOfRangeError.
+func WriteSOSD(path string, keys []shared.KeyType) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := binary.Write(writer, binary.LittleEndian, uint64(len(keys))); err != nil {
+		file.Close()
+		return err
+	}
+	var buffer [8]byte
+	for i, key := range keys {
+		if key < 0 {
+			file.Close()
+			return fmt.Errorf("%w: key %d is negative: %d", shared.KeyOutOfRangeError, i, key)
+		}
+		binary.LittleEndian.PutUint64(buffer[:], uint64(key))
+		if _, err := writer.Write(buffer[:]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,172 @@
+package workload
+
+import (
+	"alex_go/shared"
+	"math/rand"
+)
+
+// KZipfianConstant Skew of the Zipfian request distributions of the workloads, the default of YCSB
+const KZipfianConstant = 0.99
+
+// KHotspotDataFraction Fraction of the records forming the hot set of the hotspot request distribution
+const KHotspotDataFraction = 0.2
+
+// KHotspotOpnFraction Fraction of the requests of the hotspot request distribution going to the hot set
+const KHotspotOpnFraction = 0.8
+
+// KMaxScanLength Maximum number of records read by a scan of a workload, scan lengths are uniform in [1, KMaxScanLength]
+const KMaxScanLength = 100
+
+// OperationKind Kind of an operation of a workload
+type OperationKind int
+
+const (
+	Read OperationKind = iota
+	Update
+	Insert
+	// Scan Reads ScanLength records in key order, starting from Key
+	Scan
+	// ReadModifyWrite Reads a record and writes it back
+	ReadModifyWrite
+)
+
+func (self OperationKind) String() string {
+	switch self {
+	case Read:
+		return "read"
+	case Update:
+		return "update"
+	case Insert:
+		return "insert"
+	case Scan:
+		return "scan"
+	case ReadModifyWrite:
+		return "read-modify-write"
+	default:
+		return "unknown"
+	}
+}
+
+// Operation An operation of a workload on the record of Key
+type Operation struct {
+	Kind       OperationKind
+	Key        shared.KeyType
+	ScanLength int
+}
+
+// RequestDistributionKind How a workload chooses the records its operations request
+type RequestDistributionKind int
+
+const (
+	UniformRequestDistribution RequestDistributionKind = iota
+	// ZipfianRequestDistribution Scrambled Zipfian, the popular records are spread over the key space
+	ZipfianRequestDistribution
+	LatestRequestDistribution
+	HotspotRequestDistribution
+)
+
+// Mix Fractions of the operations of each kind, which add up to 1, and distribution of the requested records
+type Mix struct {
+	ReadFrac            float64
+	UpdateFrac          float64
+	InsertFrac          float64
+	ScanFrac            float64
+	ReadModifyWriteFrac float64
+	Requests            RequestDistributionKind
+}
+
+// The core workloads of YCSB
+var (
+	// WorkloadA Update heavy
+	WorkloadA = Mix{ReadFrac: 0.5, UpdateFrac: 0.5, Requests: ZipfianRequestDistribution}
+	// WorkloadB Read mostly
+	WorkloadB = Mix{ReadFrac: 0.95, UpdateFrac: 0.05, Requests: ZipfianRequestDistribution}
+	// WorkloadC Read only
+	WorkloadC = Mix{ReadFrac: 1, Requests: ZipfianRequestDistribution}
+	// WorkloadD Read latest, the records inserted last are the most popular
+	WorkloadD = Mix{ReadFrac: 0.95, InsertFrac: 0.05, Requests: LatestRequestDistribution}
+	// WorkloadE Short ranges
+	WorkloadE = Mix{ScanFrac: 0.95, InsertFrac: 0.05, Requests: ZipfianRequestDistribution}
+	// WorkloadF Read-modify-write
+	WorkloadF = Mix{ReadFrac: 0.5, ReadModifyWriteFrac: 0.5, Requests: ZipfianRequestDistribution}
+)
+
+// Workload Deterministic stream of the operations of a mix.
+// Operations other than inserts request records among the loaded keys and the keys inserted so far, inserts take
+// the next key of the keys to insert. Once those run out, inserts are replaced by reads.
+type Workload struct {
+	mix      Mix
+	rng      *rand.Rand
+	requests RequestDistribution
+	// Loaded keys followed by the keys inserted so far, in insertion order
+	records    []shared.KeyType
+	insertKeys []shared.KeyType
+	nextInsert int
+}
+
+// NewWorkload Workload of mix over the records of loadedKeys, inserting the keys of insertKeys in order.
+// loadedKeys must not be empty. The same seed always gives the same operations.
+func NewWorkload(mix Mix, loadedKeys []shared.KeyType, insertKeys []shared.KeyType, seed int64) *Workload {
+	rng := rand.New(rand.NewSource(seed))
+	var requests RequestDistribution
+	switch mix.Requests {
+	case ZipfianRequestDistribution:
+		requests = NewScrambledZipfianRequests(rng, KZipfianConstant)
+	case LatestRequestDistribution:
+		requests = NewLatestRequests(rng, KZipfianConstant)
+	case HotspotRequestDistribution:
+		requests = NewHotspotRequests(rng, KHotspotDataFraction, KHotspotOpnFraction)
+	default:
+		requests = NewUniformRequests(rng)
+	}
+	records := make([]shared.KeyType, len(loadedKeys), len(loadedKeys)+len(insertKeys))
+	copy(records, loadedKeys)
+	return &Workload{mix: mix, rng: rng, requests: requests, records: records, insertKeys: insertKeys}
+}
+
+// Next Returns the next operation of the workload
+func (self *Workload) Next() Operation {
+	u := self.rng.Float64()
+	// Rounding errors in the fractions fall back to reads
+	kind := Read
+	for _, candidate := range []struct {
+		kind OperationKind
+		frac float64
+	}{
+		{Read, self.mix.ReadFrac},
+		{Update, self.mix.UpdateFrac},
+		{Insert, self.mix.InsertFrac},
+		{Scan, self.mix.ScanFrac},
+		{ReadModifyWrite, self.mix.ReadModifyWriteFrac},
+	} {
+		if u < candidate.frac {
+			kind = candidate.kind
+			break
+		}
+		u -= candidate.frac
+	}
+
+	if kind == Insert {
+		if self.nextInsert < len(self.insertKeys) {
+			key := self.insertKeys[self.nextInsert]
+			self.nextInsert++
+			self.records = append(self.records, key)
+			return Operation{Kind: Insert, Key: key}
+		}
+		kind = Read
+	}
+	operation := Operation{Kind: kind, Key: self.records[self.requests.Next(len(self.records))]}
+	if kind == Scan {
+		operation.ScanLength = 1 + self.rng.Intn(KMaxScanLength)
+	}
+	return operation
+}
+
+// Operations Returns the next n operations of the workload
+func (self *Workload) Operations(n int) []Operation {
+	operations := make([]Operation, n)
+	for i := range operations {
+		operations[i] = self.Next()
+	}
+	return operations
+}